@@ -5,17 +5,37 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 )
 
 // Config holds the application configuration.
 type Config struct {
-	BadgerDBPath    string // Path to BadgerDB storage directory
-	ServerPort      string // Port for the HTTP server
-	ChunkSize       int    // Size for content chunking (in bytes)
-	EthereumRPC     string // Ethereum node RPC URL
-	ContractAddress string // Address of the DecentralizedNamingSystem contract
-	PrivateKey      string // Private key for signing transactions
-	ChainID         int64  // Ethereum chain ID
+	StoreBackend    string        // Block store backend: badger, flatfs, memory or s3
+	BadgerDBPath    string        // Path to BadgerDB storage directory
+	FlatFSPath      string        // Path to the flat-file blockstore directory
+	S3Endpoint      string        // Host and port of the S3-compatible object store
+	S3Bucket        string        // Bucket holding the blocks
+	S3AccessKey     string        // S3 access key
+	S3SecretKey     string        // S3 secret key
+	S3Region        string        // S3 region
+	S3UseSSL        bool          // Connect to the object store over HTTPS
+	NameRegistry    string        // Name registry backend: contract or local
+	ServerPort      string        // Port for the HTTP server
+	ChunkSize       int           // Size for content chunking (in bytes)
+	EthereumRPC     string        // Ethereum node RPC URL
+	ContractAddress string        // Address of the DecentralizedNamingSystem contract
+	PrivateKey      string        // Private key for signing transactions when no API keys are configured
+	KeystoreDir     string        // Directory of the keystore holding the accounts of API keys
+	APIKeysFile     string        // JSON file mapping API keys to keystore accounts; empty uses PrivateKey for every request
+	ChainID         int64         // Ethereum chain ID
+	TxTimeout       time.Duration // How long a name update transaction may stay unmined before it is replaced
+	TxMaxAttempts   int           // Transactions sent per name update, replacements included
+	IndexerStart    uint64        // First block whose contract events are indexed
+	Confirmations   uint64        // Blocks on top of a block before its events are indexed
+	CacheTTL        time.Duration // How long resolved CIDs are cached; 0 caches them until the contract reports a change
+	PollInterval    time.Duration // How often contract logs are polled when the node does not support subscriptions
+	SessionTTL      time.Duration // How long a staging session may go without edits before it is closed
+	AdminToken      string        // Bearer token protecting the admin API
 }
 
 // LoadConfig loads and returns the application configuration.
@@ -26,6 +46,38 @@ func LoadConfig() *Config {
 		log.Fatalf("Failed to create database directory %s: %v", dbPath, err)
 	}
 
+	// Load block store backend
+	storeBackend := os.Getenv("STORE_BACKEND")
+	if storeBackend == "" {
+		storeBackend = "badger"
+	}
+
+	// Load flat-file blockstore path
+	flatfsPath := os.Getenv("FLATFS_PATH")
+	if flatfsPath == "" {
+		flatfsPath = filepath.Join(".", "data", "blocks")
+	}
+
+	// Load S3 settings, only used by the s3 backend
+	s3Endpoint := os.Getenv("S3_ENDPOINT")
+	if s3Endpoint == "" {
+		s3Endpoint = "127.0.0.1:9000"
+		if storeBackend == "s3" {
+			log.Println("Warning: S3_ENDPOINT not set, using default local MinIO endpoint 127.0.0.1:9000")
+		}
+	}
+	s3Bucket := os.Getenv("S3_BUCKET")
+	if s3Bucket == "" {
+		s3Bucket = "ipfs-blocks"
+	}
+	s3UseSSL, _ := strconv.ParseBool(os.Getenv("S3_USE_SSL"))
+
+	// Load name registry backend
+	nameRegistry := os.Getenv("NAME_REGISTRY")
+	if nameRegistry == "" {
+		nameRegistry = "contract"
+	}
+
 	// Load server port
 	serverPort := os.Getenv("SERVER_PORT")
 	if serverPort == "" {
@@ -54,6 +106,16 @@ func LoadConfig() *Config {
 		log.Println("Warning: PRIVATE_KEY not set, Using default PRIVATE_KEY")
 	}
 
+	// Load keystore directory and API keys file
+	keystoreDir := os.Getenv("KEYSTORE_DIR")
+	if keystoreDir == "" {
+		keystoreDir = filepath.Join(".", "data", "keystore")
+	}
+	apiKeysFile := os.Getenv("API_KEYS_FILE")
+	if apiKeysFile == "" {
+		log.Println("Warning: API_KEYS_FILE not set, all names are registered with PRIVATE_KEY")
+	}
+
 	// Load chain ID
 	chainIDStr := os.Getenv("CHAIN_ID")
 	chainID, err := strconv.ParseInt(chainIDStr, 10, 64)
@@ -62,13 +124,74 @@ func LoadConfig() *Config {
 		log.Println("Warning: CHAIN_ID not set or invalid, using default Ganache chain ID 1337")
 	}
 
+	// Load transaction timeout and retries
+	txTimeout, err := time.ParseDuration(os.Getenv("TX_TIMEOUT"))
+	if err != nil || txTimeout <= 0 {
+		txTimeout = 2 * time.Minute
+	}
+	txMaxAttempts, err := strconv.Atoi(os.Getenv("TX_MAX_ATTEMPTS"))
+	if err != nil || txMaxAttempts <= 0 {
+		txMaxAttempts = 3
+	}
+
+	// Load event indexer settings
+	indexerStart, err := strconv.ParseUint(os.Getenv("INDEXER_START_BLOCK"), 10, 64)
+	if err != nil {
+		indexerStart = 0
+	}
+	confirmations, err := strconv.ParseUint(os.Getenv("INDEXER_CONFIRMATIONS"), 10, 64)
+	if err != nil {
+		confirmations = 12
+	}
+
+	// Load resolver cache settings
+	cacheTTL, err := time.ParseDuration(os.Getenv("RESOLVER_CACHE_TTL"))
+	if err != nil || cacheTTL < 0 {
+		cacheTTL = 0
+	}
+	pollInterval, err := time.ParseDuration(os.Getenv("LOG_POLL_INTERVAL"))
+	if err != nil || pollInterval <= 0 {
+		pollInterval = 5 * time.Second
+	}
+
+	// Load staging session expiry
+	sessionTTL, err := time.ParseDuration(os.Getenv("SESSION_TTL"))
+	if err != nil || sessionTTL <= 0 {
+		sessionTTL = 24 * time.Hour
+	}
+
+	// Load admin token
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		log.Println("Warning: ADMIN_TOKEN not set, the admin API and /debug/vars are disabled")
+	}
+
 	return &Config{
+		StoreBackend:    storeBackend,
 		BadgerDBPath:    dbPath,
+		FlatFSPath:      flatfsPath,
+		S3Endpoint:      s3Endpoint,
+		S3Bucket:        s3Bucket,
+		S3AccessKey:     os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:     os.Getenv("S3_SECRET_KEY"),
+		S3Region:        os.Getenv("S3_REGION"),
+		S3UseSSL:        s3UseSSL,
+		NameRegistry:    nameRegistry,
 		ServerPort:      serverPort,
 		ChunkSize:       256 * 1024, // 256KB
 		EthereumRPC:     ethereumRPC,
 		ContractAddress: contractAddress,
 		PrivateKey:      privateKey,
+		KeystoreDir:     keystoreDir,
+		APIKeysFile:     apiKeysFile,
 		ChainID:         chainID,
+		TxTimeout:       txTimeout,
+		TxMaxAttempts:   txMaxAttempts,
+		IndexerStart:    indexerStart,
+		Confirmations:   confirmations,
+		CacheTTL:        cacheTTL,
+		PollInterval:    pollInterval,
+		SessionTTL:      sessionTTL,
+		AdminToken:      adminToken,
 	}
 }
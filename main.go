@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"time"
 
 	"ipfs-gin-example/config"
 	"ipfs-gin-example/pkg/api"
 	"ipfs-gin-example/pkg/contract"
+	"ipfs-gin-example/pkg/indexer"
+	"ipfs-gin-example/pkg/jobs"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
 	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/session"
+	"ipfs-gin-example/pkg/signer"
 	"ipfs-gin-example/pkg/storage"
 
 	"github.com/gin-gonic/gin"
@@ -19,34 +28,81 @@ func main() {
 	// Load configuration
 	cfg := config.LoadConfig()
 
-	// Initialize BadgerDB storage
-	store, err := storage.NewBadgerStore(cfg.BadgerDBPath)
+	// Initialize block storage
+	store, err := openStore(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 	defer store.Close()
-	log.Printf("BadgerDB initialized at %s", cfg.BadgerDBPath)
 
-	// Validate contract address
-	if cfg.ContractAddress == "" {
-		log.Fatal("CONTRACT_ADDRESS is required for smart contract interaction")
+	// Initialize name registry
+	registry, closeRegistry, err := openRegistry(cfg, store)
+	if err != nil {
+		log.Fatalf("Failed to initialize name registry: %v", err)
 	}
+	defer closeRegistry()
+
+	// Initialize pin set; roots mapped by the resolver are pinned automatically
+	pinner := pin.NewPinner(store)
 
-	// Initialize smart contract client
-	contractClient, err := contract.NewClient(cfg.EthereumRPC, cfg.ContractAddress)
+	// Initialize Resolver with the name registry
+	delegations := resolver.NewDelegations(store)
+	resolver := resolver.NewResolver(registry, pinner)
+	resolver.CacheTTL = cfg.CacheTTL
+	resolver.Delegations = delegations
+	log.Println("Resolver initialized with name registry and LRU cache.")
+
+	// Initialize the accounts name updates are signed with
+	signers, err := signer.NewSigners(cfg.KeystoreDir, cfg.APIKeysFile, cfg.PrivateKey, cfg.ChainID)
 	if err != nil {
-		log.Fatalf("Failed to initialize contract client: %v", err)
+		log.Fatalf("Failed to initialize signers: %v", err)
 	}
-	defer contractClient.Close()
-	log.Printf("Smart contract client initialized for address %s", cfg.ContractAddress)
 
-	// Initialize Resolver with contract client
-	resolver := resolver.NewResolver(contractClient)
-	log.Println("Resolver initialized with smart contract client and LRU cache.")
+	// Name updates sent to the contract are queued as jobs instead of blocking requests until mined,
+	// and the contract events are indexed into the history of each name
+	var queue *jobs.Queue
+	var eventIndexer *indexer.Indexer
+	contractClient, onChain := registry.(*contract.Client)
+	if onChain {
+		queue = jobs.NewQueue(store, contractClient, resolver, pinner, cfg.TxTimeout, cfg.TxMaxAttempts)
+		if err := queue.Resume(context.Background()); err != nil {
+			log.Fatalf("Failed to resume pending jobs: %v", err)
+		}
+		eventIndexer = indexer.NewIndexer(store, contractClient, cfg.IndexerStart, cfg.Confirmations)
+		eventIndexer.PollInterval = cfg.PollInterval
+		go eventIndexer.Run(context.Background())
+		// Names changed through other gateways or directly on the contract are refreshed in the cache
+		go resolver.Watch(context.Background(), contractClient, cfg.PollInterval)
+	}
+
+	// Names registered before name pins existed are pinned once; GC stays disabled until then
+	go backfillNamePins(context.Background(), cfg, registry, resolver, pinner, store)
+
+	// Staging sessions keep their working roots pinned until they are committed or closed;
+	// abandoned sessions expire, and committed ones are closed once their update is done
+	sessions := session.NewSessions(store, pinner)
+	sessions.TTL = cfg.SessionTTL
+	var jobDone func(string) (bool, error)
+	if queue != nil {
+		jobDone = queue.Done
+	}
+	go sessions.Run(context.Background(), time.Minute, jobDone)
 
 	// Initialize API Handlers
-	uploadHandler := api.NewUploadHandler(store, cfg.ChunkSize, resolver, cfg)
+	uploadHandler := api.NewUploadHandler(store, cfg.ChunkSize, resolver, pinner, signers, queue, sessions, cfg)
 	downloadHandler := api.NewDownloadHandler(store, resolver)
+	adminHandler := api.NewAdminHandler(store, pinner, cfg.AdminToken)
+	carHandler := api.NewCARHandler(store, resolver, pinner, signers, queue)
+	editHandler := api.NewEditHandler(store, resolver, pinner, signers, queue, sessions)
+	nameHandler := api.NewNameHandler(resolver, signers, queue, eventIndexer)
+
+	// Clients that sign their own transactions can only relay them to the contract
+	var relayHandler *api.RelayHandler
+	var jobHandler *api.JobHandler
+	if onChain {
+		relayHandler = api.NewRelayHandler(store, cfg.ChunkSize, resolver, pinner, contractClient, cfg.ChainID)
+		jobHandler = api.NewJobHandler(queue)
+	}
 
 	// Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
@@ -72,7 +128,17 @@ func main() {
 	{
 		uploadHandler.RegisterRoutes(apiGroup)
 		downloadHandler.RegisterRoutes(apiGroup)
+		adminHandler.RegisterRoutes(apiGroup)
+		carHandler.RegisterRoutes(apiGroup)
+		editHandler.RegisterRoutes(apiGroup)
+		nameHandler.RegisterRoutes(apiGroup)
+		if onChain {
+			relayHandler.RegisterRoutes(apiGroup)
+			jobHandler.RegisterRoutes(apiGroup)
+		}
 	}
+	// Expose runtime metrics, including the corrupt block counter, to admins
+	adminHandler.RegisterDebugRoutes(router)
 	router.GET("/health", func(c *gin.Context) {
 		c.String(http.StatusOK, "IPFS-like Gin Example Server is running!")
 	})
@@ -83,3 +149,90 @@ func main() {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
+
+// openStore initializes the block store backend selected by the configuration.
+func openStore(cfg *config.Config) (storage.Store, error) {
+	switch cfg.StoreBackend {
+	case "badger":
+		store, err := storage.NewBadgerStore(cfg.BadgerDBPath)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("BadgerDB initialized at %s", cfg.BadgerDBPath)
+		return store, nil
+	case "flatfs":
+		store, err := storage.NewFlatFSStore(cfg.FlatFSPath)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Flat-file blockstore initialized at %s", cfg.FlatFSPath)
+		return store, nil
+	case "memory":
+		log.Println("Warning: using in-memory block store, content is lost on shutdown")
+		return storage.NewMemoryStore(), nil
+	case "s3":
+		store, err := storage.NewS3Store(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			Region:    cfg.S3Region,
+			UseSSL:    cfg.S3UseSSL,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("S3 block store initialized at %s, bucket %s", cfg.S3Endpoint, cfg.S3Bucket)
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown STORE_BACKEND %q", cfg.StoreBackend)
+}
+
+// backfillNamePins pins the current roots of the names in registry, unless that already happened
+func backfillNamePins(ctx context.Context, cfg *config.Config, registry resolver.NameRegistry, nameResolver *resolver.Resolver, pinner *pin.Pinner, store storage.Store) {
+	backfilled, err := pinner.Backfilled()
+	if err != nil {
+		log.Printf("Warning: failed to check name pins, garbage collection is disabled: %v", err)
+		return
+	}
+	if backfilled {
+		return
+	}
+
+	var names []string
+	switch registry := registry.(type) {
+	case *contract.Client:
+		names, err = registry.RegisteredNames(ctx, cfg.IndexerStart)
+	case *resolver.LocalRegistry:
+		names, err = registry.Names(ctx)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to list names to pin, garbage collection is disabled: %v", err)
+		return
+	}
+	if err := nameResolver.BackfillPins(ctx, merkledag.NewDAGBuilder(store), names); err != nil {
+		log.Printf("Warning: failed to pin registered names, garbage collection is disabled: %v", err)
+		return
+	}
+	log.Printf("Name pins backfilled from %d registered names", len(names))
+}
+
+// openRegistry opens the name registry selected by NAME_REGISTRY and returns a function closing it
+func openRegistry(cfg *config.Config, store storage.Store) (resolver.NameRegistry, func(), error) {
+	switch cfg.NameRegistry {
+	case "contract":
+		if cfg.ContractAddress == "" {
+			return nil, nil, fmt.Errorf("CONTRACT_ADDRESS is required for smart contract interaction")
+		}
+		contractClient, err := contract.NewClient(cfg.EthereumRPC, cfg.ContractAddress)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize contract client: %w", err)
+		}
+		log.Printf("Smart contract client initialized for address %s", cfg.ContractAddress)
+		return contractClient, contractClient.Close, nil
+	case "local":
+		log.Println("Warning: using local name registry, names are kept in the block store and not on-chain")
+		return resolver.NewLocalRegistry(store), func() {}, nil
+	}
+	return nil, nil, fmt.Errorf("unknown NAME_REGISTRY %q", cfg.NameRegistry)
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler handles pin management and garbage collection.
+type AdminHandler struct {
+	DAGBuilder *merkledag.DAGBuilder
+	Pinner     *pin.Pinner
+	Token      string // Bearer token required for admin routes; empty disables them
+}
+
+// NewAdminHandler creates a new AdminHandler.
+func NewAdminHandler(store storage.Store, pinner *pin.Pinner, token string) *AdminHandler {
+	return &AdminHandler{
+		DAGBuilder: merkledag.NewDAGBuilder(store),
+		Pinner:     pinner,
+		Token:      token,
+	}
+}
+
+// RegisterRoutes registers admin routes.
+func (h *AdminHandler) RegisterRoutes(group *gin.RouterGroup) {
+	admin := group.Group("/admin", h.authorize)
+	admin.GET("/pins", h.ListPinsHandler)
+	admin.POST("/pins/:cid", h.PinHandler)
+	admin.DELETE("/pins/:cid", h.UnpinHandler)
+	admin.POST("/gc", h.GCHandler)
+	admin.POST("/verify", h.VerifyHandler)
+}
+
+// RegisterDebugRoutes registers /debug/vars, the expvar metrics, behind the admin token.
+func (h *AdminHandler) RegisterDebugRoutes(router gin.IRouter) {
+	router.GET("/debug/vars", h.authorize, gin.WrapH(expvar.Handler()))
+}
+
+// authorize rejects requests without the admin bearer token, and every request when no token
+// is configured.
+func (h *AdminHandler) authorize(c *gin.Context) {
+	if h.Token == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API is disabled, set ADMIN_TOKEN to enable it"})
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "admin token required"})
+	}
+}
+
+// ListPinsHandler lists the pin set.
+func (h *AdminHandler) ListPinsHandler(c *gin.Context) {
+	pins, err := h.Pinner.Pins(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list pins: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pins": pins})
+}
+
+// PinHandler pins a CID. ?mode=direct pins only the block itself; the default is recursive.
+func (h *AdminHandler) PinHandler(c *gin.Context) {
+	cid := c.Param("cid")
+	mode := c.DefaultQuery("mode", pin.Recursive)
+	if mode != pin.Recursive && mode != pin.Direct {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid pin mode %q", mode)})
+		return
+	}
+
+	if err := h.Pinner.Pin(cid, mode == pin.Recursive); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to pin %s: %v", cid, err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cid": cid, "mode": mode})
+}
+
+// UnpinHandler removes the recursive and direct pins of a CID.
+func (h *AdminHandler) UnpinHandler(c *gin.Context) {
+	cid := c.Param("cid")
+	if err := h.Pinner.Unpin(cid); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to unpin %s: %v", cid, err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cid": cid})
+}
+
+// GCHandler runs garbage collection. ?dry_run=true only reports unreachable blocks.
+func (h *AdminHandler) GCHandler(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+	report, err := h.Pinner.GC(c.Request.Context(), h.DAGBuilder, dryRun)
+	if errors.Is(err, pin.ErrNotBackfilled) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Garbage collection is disabled: %v", err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Garbage collection failed: %v", err), "report": report})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// VerifyHandler checks every block in the store against its CID.
+// ?quarantine=true moves corrupt blocks out of the way.
+func (h *AdminHandler) VerifyHandler(c *gin.Context) {
+	quarantine := c.Query("quarantine") == "true"
+	report, err := h.DAGBuilder.VerifyBlocks(c.Request.Context(), quarantine)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Verification failed: %v", err), "report": report})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
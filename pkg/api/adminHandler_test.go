@@ -0,0 +1,121 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ipfs-gin-example/pkg/api"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminRequiresToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tt := range []struct {
+		token, header string
+		want          int
+	}{
+		{"", "", http.StatusForbidden},
+		{"", "Bearer ", http.StatusForbidden},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "Bearer secret", http.StatusOK},
+	} {
+		store := storage.NewMemoryStore()
+		router := gin.New()
+		admin := api.NewAdminHandler(store, pin.NewPinner(store), tt.token)
+		admin.RegisterRoutes(router.Group("/api"))
+		admin.RegisterDebugRoutes(router)
+
+		for _, target := range []string{"/api/admin/pins", "/debug/vars"} {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("GET %s with token %q and header %q = %d, want %d", target, tt.token, tt.header, rec.Code, tt.want)
+			}
+		}
+	}
+}
+
+func TestVerifyQuarantinesCorruptBlock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	r := resolver.NewResolver(resolver.NewLocalRegistry(store), pinner)
+	router := gin.New()
+	admin := api.NewAdminHandler(store, pinner, "secret")
+	admin.RegisterRoutes(router.Group("/api"))
+	admin.RegisterDebugRoutes(router)
+	api.NewDownloadHandler(store, r).RegisterRoutes(router.Group("/api"))
+
+	dag := merkledag.NewDAGBuilder(store)
+	file, size, err := dag.BuildDAGFromReader(strings.NewReader("hello"), merkledag.NewChunker(1024))
+	if err != nil {
+		t.Fatalf("BuildDAGFromReader: %v", err)
+	}
+	root, err := dag.PutNodeAtPath("", "/hello.txt", file, size)
+	if err != nil {
+		t.Fatalf("PutNodeAtPath: %v", err)
+	}
+	mapName(t, r, "example.com", root)
+	if err := store.Put([]byte(file), []byte("tampered")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// The tampered bytes are refused on read rather than served
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/example.com/hello.txt", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "corrupt") {
+		t.Fatalf("GET of a tampered file = %d %s, want a corrupt block error", rec.Code, rec.Body.String())
+	}
+
+	verify := func(target string) map[string]any {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var report map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("POST %s = %d %s", target, rec.Code, rec.Body.String())
+		}
+		return report
+	}
+	report := verify("/api/admin/verify")
+	if corrupt, _ := report["corrupt"].([]any); len(corrupt) != 1 || corrupt[0] != file || report["quarantined"] != nil {
+		t.Fatalf("verify report = %v, want only %s corrupt and nothing quarantined", report, file)
+	}
+	report = verify("/api/admin/verify?quarantine=true")
+	if quarantined, _ := report["quarantined"].([]any); len(quarantined) != 1 || quarantined[0] != file {
+		t.Fatalf("verify report = %v, want %s quarantined", report, file)
+	}
+	if has, err := store.Has([]byte(file)); err != nil || has {
+		t.Fatalf("Has(%s) after quarantine = %v, %v", file, has, err)
+	}
+	if report := verify("/api/admin/verify"); len(report["corrupt"].([]any)) != 0 {
+		t.Fatalf("verify report after quarantine = %v, want nothing corrupt", report)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/vars", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var vars map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("/debug/vars: %v", err)
+	}
+	if count, _ := vars["merkledag_corrupt_blocks_total"].(float64); count < 1 {
+		t.Fatalf("merkledag_corrupt_blocks_total = %v, want the failures counted", vars["merkledag_corrupt_blocks_total"])
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/signer"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyHeader carries the API key that selects the account a request's name updates are signed with
+const apiKeyHeader = "X-API-Key"
+
+// requestTransactor returns the transactor of the account the request's API key maps to.
+// It writes an error response and returns nil when there is none.
+func requestTransactor(c *gin.Context, signers *signer.Signers) *bind.TransactOpts {
+	auth, err := signers.Transactor(c.GetHeader(apiKeyHeader))
+	if errors.Is(err, signer.ErrUnknownAPIKey) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("A valid %s header is required", apiKeyHeader)})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to prepare transaction: %v", err)})
+		return nil
+	}
+	return auth
+}
+
+// requestKeyedTransactor is like requestTransactor, but refuses to sign with the legacy server-wide
+// key: transfers and delegations give a name away, so only the account of an API key may do so.
+func requestKeyedTransactor(c *gin.Context, signers *signer.Signers) *bind.TransactOpts {
+	auth, err := signers.KeyedTransactor(c.GetHeader(apiKeyHeader))
+	if errors.Is(err, signer.ErrNoAPIKeys) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Transfers and delegations require API keys; configure API_KEYS_FILE"})
+		return nil
+	}
+	if errors.Is(err, signer.ErrUnknownAPIKey) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("A valid %s header is required", apiKeyHeader)})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to prepare transaction: %v", err)})
+		return nil
+	}
+	return auth
+}
+
+// updateMappingStatus returns the HTTP status for an error from Resolver.UpdateMapping
+// or Resolver.TransferOwnership
+func updateMappingStatus(err error) int {
+	if errors.Is(err, resolver.ErrNotAuthorized) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, resolver.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
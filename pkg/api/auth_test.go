@@ -0,0 +1,109 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ipfs-gin-example/config"
+	"ipfs-gin-example/pkg/api"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/session"
+	"ipfs-gin-example/pkg/signer"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/gin-gonic/gin"
+)
+
+// keyedSigners creates a keystore account for each API key and returns signers for them
+// with the account addresses by API key
+func keyedSigners(t *testing.T, apiKeys ...string) (*signer.Signers, map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	ks := keystore.NewKeyStore(filepath.Join(dir, "keystore"), keystore.LightScryptN, keystore.LightScryptP)
+	entries := make(map[string]map[string]string, len(apiKeys))
+	addresses := make(map[string]string, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		account, err := ks.NewAccount("password of " + apiKey)
+		if err != nil {
+			t.Fatalf("NewAccount: %v", err)
+		}
+		entries[apiKey] = map[string]string{"account": account.Address.Hex(), "password": "password of " + apiKey}
+		addresses[apiKey] = account.Address.Hex()
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	file := filepath.Join(dir, "api-keys.json")
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	signers, err := signer.NewSigners(filepath.Join(dir, "keystore"), file, "", 1337)
+	if err != nil {
+		t.Fatalf("NewSigners: %v", err)
+	}
+	return signers, addresses
+}
+
+func TestAPIKeysOwnTheirNames(t *testing.T) {
+	signers, addresses := keyedSigners(t, "alice-key", "bob-key")
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	r := resolver.NewResolver(resolver.NewLocalRegistry(store), pinner)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	sessions := session.NewSessions(store, pinner)
+	api.NewUploadHandler(store, 1024, r, pinner, signers, nil, sessions, &config.Config{ChunkSize: 1024}).RegisterRoutes(router.Group("/api"))
+	api.NewNameHandler(r, signers, nil, nil).RegisterRoutes(router.Group("/api"))
+
+	for _, apiKey := range []string{"", "unknown-key"} {
+		if status, body := serveKey(t, router, http.MethodPost, "/api/upload?name=site", apiKey, "v1"); status != http.StatusUnauthorized {
+			t.Fatalf("upload with API key %q = %d %v, want %d", apiKey, status, body, http.StatusUnauthorized)
+		}
+	}
+
+	// A name belongs to the account of the API key that registered it
+	if status, body := serveKey(t, router, http.MethodPost, "/api/upload?name=site", "alice-key", "v1"); status != http.StatusOK {
+		t.Fatalf("upload by alice = %d %v", status, body)
+	}
+	if status, info := serve(t, router, http.MethodGet, "/api/names/site"); status != http.StatusOK || info["owner"] != addresses["alice-key"] {
+		t.Fatalf("GET /api/names/site = %d %v, want owner %s", status, info, addresses["alice-key"])
+	}
+	if status, body := serveKey(t, router, http.MethodPost, "/api/upload?name=site", "bob-key", "v2"); status != http.StatusForbidden {
+		t.Fatalf("upload by bob over alice's name = %d %v, want %d", status, body, http.StatusForbidden)
+	}
+	if status, body := serveKey(t, router, http.MethodPost, "/api/names/site/transfer", "bob-key", `{"new_owner": "`+addresses["bob-key"]+`"}`); status != http.StatusForbidden {
+		t.Fatalf("transfer by bob = %d %v, want %d", status, body, http.StatusForbidden)
+	}
+
+	// Once transferred, only the new owner's key may update it
+	if status, body := serveKey(t, router, http.MethodPost, "/api/names/site/transfer", "alice-key", `{"new_owner": "`+addresses["bob-key"]+`"}`); status != http.StatusOK {
+		t.Fatalf("transfer by alice = %d %v", status, body)
+	}
+	if status, body := serveKey(t, router, http.MethodPost, "/api/upload?name=site", "bob-key", "v2"); status != http.StatusOK {
+		t.Fatalf("upload by bob after the transfer = %d %v", status, body)
+	}
+	if status, body := serveKey(t, router, http.MethodPost, "/api/upload?name=site", "alice-key", "v3"); status != http.StatusForbidden {
+		t.Fatalf("upload by alice after the transfer = %d %v, want %d", status, body, http.StatusForbidden)
+	}
+}
+
+func TestTransferRequiresAPIKeys(t *testing.T) {
+	router, r, _ := editServer(t)
+	signers, err := signer.NewSigners("", "", testKey, 1337)
+	if err != nil {
+		t.Fatalf("NewSigners: %v", err)
+	}
+	api.NewNameHandler(r, signers, nil, nil).RegisterRoutes(router.Group("/api"))
+
+	// The legacy server-wide key signs uploads, but never gives a name away
+	status, body := serveBody(t, router, http.MethodPost, "/api/names/example.com/transfer", `{"new_owner": "0x0000000000000000000000000000000000000001"}`)
+	if status != http.StatusForbidden {
+		t.Fatalf("transfer with the legacy key = %d %v, want %d", status, body, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"ipfs-gin-example/pkg/car"
+	"ipfs-gin-example/pkg/jobs"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/signer"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/gin-gonic/gin"
+)
+
+// CARHandler handles importing and exporting DAGs as CAR files.
+type CARHandler struct {
+	DAGBuilder *merkledag.DAGBuilder
+	Resolver   *resolver.Resolver
+	Pinner     *pin.Pinner
+	Signers    *signer.Signers
+	Jobs       *jobs.Queue // Queues name update transactions; nil updates synchronously
+}
+
+// NewCARHandler creates a new CARHandler.
+func NewCARHandler(store storage.Store, resolver *resolver.Resolver, pinner *pin.Pinner, signers *signer.Signers, queue *jobs.Queue) *CARHandler {
+	return &CARHandler{
+		DAGBuilder: merkledag.NewDAGBuilder(store),
+		Resolver:   resolver,
+		Pinner:     pinner,
+		Signers:    signers,
+		Jobs:       queue,
+	}
+}
+
+// RegisterRoutes registers CAR routes.
+func (h *CARHandler) RegisterRoutes(group *gin.RouterGroup) {
+	group.GET("/car/:cid", h.ExportHandler)
+	group.POST("/car", h.ImportHandler)
+}
+
+// ExportHandler streams the DAG rooted at a CID as a CAR file. ?version=2 writes CARv2 with an index.
+func (h *CARHandler) ExportHandler(c *gin.Context) {
+	cid := c.Param("cid")
+	version := c.DefaultQuery("version", "1")
+	if version != "1" && version != "2" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported CAR version %q", version)})
+		return
+	}
+
+	// Check the root before streaming; once the body has started, errors can only abort it
+	if _, _, err := h.DAGBuilder.GetBlock(cid); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, merkledag.ErrInvalidCID) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, storage.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": fmt.Sprintf("Failed to get root block %s: %v", cid, err)})
+		return
+	}
+
+	c.Header("Content-Type", "application/vnd.ipld.car; version="+version)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", cid+".car"))
+	c.Status(http.StatusOK)
+
+	export := car.Export
+	if version == "2" {
+		export = car.ExportV2
+	}
+	if err := export(c.Request.Context(), c.Writer, h.DAGBuilder, cid); err != nil {
+		log.Printf("CAR export of %s failed: %v", cid, err)
+		c.Abort()
+	}
+}
+
+// ImportHandler imports a CAR file from the request body. Its roots are pinned unless ?pin=false:
+// recursively when the CAR completed their DAG, otherwise only the root block itself, since a
+// recursive pin over missing blocks would stop garbage collection. ?name= binds the single root
+// to a name once the whole DAG is present.
+func (h *CARHandler) ImportHandler(c *gin.Context) {
+	name := c.Query("name")
+	var auth *bind.TransactOpts
+	if name != "" {
+		if auth = requestTransactor(c, h.Signers); auth == nil {
+			return
+		}
+	}
+
+	// GC keeps the imported blocks while the CAR streams in, and is held off from checking the
+	// roots until they are pinned
+	store, release := h.Pinner.TrackWrites()
+	defer release()
+	result, err := car.Import(c.Request.Body, merkledag.NewDAGBuilder(store))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to import CAR: %v", err), "imported": result})
+		return
+	}
+	defer h.Pinner.PinLock()()
+
+	complete := make(map[string]bool, len(result.Roots))
+	for _, root := range result.Roots {
+		if complete[root], err = h.DAGBuilder.HasDAG(c.Request.Context(), root); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to check DAG %s: %v", root, err), "imported": result})
+			return
+		}
+	}
+
+	pins := []pin.Pin{}
+	if c.DefaultQuery("pin", "true") != "false" {
+		for _, root := range result.Roots {
+			if has, err := h.DAGBuilder.HasNode(root); err != nil || !has {
+				continue // Nothing of this root is stored
+			}
+			mode := pin.Direct
+			if complete[root] {
+				mode = pin.Recursive
+			}
+			if err := h.Pinner.Pin(root, complete[root]); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to pin %s: %v", root, err), "imported": result})
+				return
+			}
+			pins = append(pins, pin.Pin{CID: root, Mode: mode})
+		}
+	}
+
+	if name == "" {
+		c.JSON(http.StatusOK, gin.H{"roots": result.Roots, "blocks": result.Blocks, "pins": pins})
+		return
+	}
+	if len(result.Roots) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Binding a name requires exactly one root, CAR has %d", len(result.Roots)), "imported": result})
+		return
+	}
+	rootCID := result.Roots[0]
+
+	// A CAR may hold a partial DAG; only a complete one can be served under a name
+	if !complete[rootCID] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("DAG %s is incomplete", rootCID), "imported": result})
+		return
+	}
+
+	job, err := updateName(h.Resolver, h.Jobs, auth, name, rootCID)
+	if err != nil {
+		c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to register/update CID: %v", err)})
+		return
+	}
+
+	log.Printf("Registered/Updated CID %s for name %s", rootCID, name)
+	c.JSON(http.StatusOK, addJob(gin.H{"roots": result.Roots, "blocks": result.Blocks, "pins": pins, "name": name}, job))
+}
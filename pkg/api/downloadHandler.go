@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // DownloadHandler handles all download-related API operations.
@@ -31,13 +32,17 @@ func (h *DownloadHandler) RegisterRoutes(group *gin.RouterGroup) {
 	group.GET("/:domain/*path", h.DownloadHandler)
 }
 
-// DownloadHandler handles content retrieval based on domain and path.
+// DownloadHandler handles content retrieval based on domain and path. The longest registered
+// prefix of domain + path is resolved, and the rest of the path inside that prefix's DAG.
 func (h *DownloadHandler) DownloadHandler(c *gin.Context) {
 	domain := c.Param("domain")
 	path := c.Param("path")
 
 	name := domain + path
-	cid, err := h.Resolver.ResolveDomain(name)
+	prefix, cid, err := h.Resolver.Resolve(name)
+	if err == nil && prefix != name {
+		cid, err = h.DAGBuilder.ResolvePath(cid, strings.TrimPrefix(name, prefix))
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Failed to resolve CID for %s: %v", name, err)})
 		return
@@ -49,7 +54,7 @@ func (h *DownloadHandler) DownloadHandler(c *gin.Context) {
 		return
 	}
 
-	if len(targetNode.Data) == 0 && len(targetNode.Links) > 0 && targetNode.Links[0].Name != "" {
+	if merkledag.IsDirectory(targetNode) {
 		links, err := h.DAGBuilder.ListDirectory(cid)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list directory %s: %v", cid, err)})
@@ -62,7 +67,7 @@ func (h *DownloadHandler) DownloadHandler(c *gin.Context) {
 		return
 	}
 
-	fileData, err := h.DAGBuilder.GetFileData(cid)
+	fileReader, err := h.DAGBuilder.NewFileReader(cid)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get file data for %s: %v", cid, err)})
 		return
@@ -86,5 +91,9 @@ func (h *DownloadHandler) DownloadHandler(c *gin.Context) {
 		contentType = "application/pdf"
 	}
 
-	c.Data(http.StatusOK, contentType, fileData)
+	// Content is immutable per CID, so the CID is a strong ETag. ServeContent uses it
+	// to answer Range and If-Range requests with 206 Partial Content.
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", fmt.Sprintf("%q", cid))
+	http.ServeContent(c.Writer, c.Request, filename, time.Time{}, fileReader)
 }
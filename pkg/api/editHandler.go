@@ -0,0 +1,468 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"ipfs-gin-example/pkg/jobs"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/session"
+	"ipfs-gin-example/pkg/signer"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+// EditHandler removes and moves paths inside a domain's directory DAG. Each edit copies the
+// directories along the path and points the domain at the new root, unless it is staged in a
+// session with ?session=; a session's edits are published together when it is committed.
+type EditHandler struct {
+	DAGBuilder *merkledag.DAGBuilder
+	Resolver   *resolver.Resolver
+	Pinner     *pin.Pinner
+	Signers    *signer.Signers
+	Jobs       *jobs.Queue // Queues name update transactions; nil updates synchronously
+	Sessions   *session.Sessions
+}
+
+// NewEditHandler creates a new EditHandler.
+func NewEditHandler(store storage.Store, resolver *resolver.Resolver, pinner *pin.Pinner, signers *signer.Signers, queue *jobs.Queue, sessions *session.Sessions) *EditHandler {
+	return &EditHandler{
+		DAGBuilder: merkledag.NewDAGBuilder(store),
+		Resolver:   resolver,
+		Pinner:     pinner,
+		Signers:    signers,
+		Jobs:       queue,
+		Sessions:   sessions,
+	}
+}
+
+// RegisterRoutes registers edit and session routes. MOVE is the WebDAV method; clients that
+// cannot send it use POST with ?op=mv. Sessions are opened with POST /:domain/sessions.
+func (h *EditHandler) RegisterRoutes(group *gin.RouterGroup) {
+	group.DELETE("/:domain/*path", h.DeleteHandler)
+	group.Handle("MOVE", "/:domain/*path", h.MoveHandler)
+	group.POST("/:domain/*path", h.PostPathHandler)
+	group.GET("/sessions/:id", h.GetSessionHandler)
+	group.POST("/sessions/:id", h.CommitSessionHandler)
+	group.DELETE("/sessions/:id", h.CloseSessionHandler)
+}
+
+// PostPathHandler dispatches POST requests on a path by their ?op= parameter.
+func (h *EditHandler) PostPathHandler(c *gin.Context) {
+	switch op := c.Query("op"); op {
+	case "mv":
+		h.MoveHandler(c)
+	case "":
+		if c.Param("path") == "/sessions" {
+			h.OpenSessionHandler(c)
+			return
+		}
+		fallthrough
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown operation %q", op)})
+	}
+}
+
+// DeleteHandler removes a path from the DAG of the name that holds it.
+func (h *EditHandler) DeleteHandler(c *gin.Context) {
+	auth := requestTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+	defer h.Pinner.PinLock()()
+
+	domain := c.Param("domain")
+	staged, ok := stagingSession(c, h.Sessions, auth, domain)
+	if !ok {
+		return
+	}
+	if staged != nil {
+		path := c.Param("path")
+		if path == "" || path == "/" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot delete the root of %s", staged.Name)})
+			return
+		}
+		staged, err := h.Sessions.Edit(staged.ID, session.Op{Op: session.OpRemove, Path: path}, func(root string) (string, error) {
+			return h.DAGBuilder.RemoveNodeAtPath(root, path)
+		})
+		if err != nil {
+			c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to delete %s from %s: %v", path, domain, err)})
+			return
+		}
+		c.JSON(http.StatusOK, stagedResponse(staged, gin.H{"path": path}))
+		return
+	}
+
+	defer h.Resolver.LockName(domain)()
+	name, root, path, err := editTarget(h.Resolver, h.Jobs, h.DAGBuilder, domain, c.Param("path"))
+	if err != nil {
+		c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to resolve %s: %v", domain+c.Param("path"), err)})
+		return
+	}
+	if path == "" || path == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot delete the root of %s", name)})
+		return
+	}
+
+	newRoot, err := h.DAGBuilder.RemoveNodeAtPath(root, path)
+	if err != nil {
+		c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to delete %s from %s: %v", path, name, err)})
+		return
+	}
+
+	job, err := updateName(h.Resolver, h.Jobs, auth, name, newRoot)
+	if err != nil {
+		c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to update CID of %s: %v", name, err)})
+		return
+	}
+
+	log.Printf("Deleted %s from %s, now %s", path, name, newRoot)
+	c.JSON(http.StatusOK, addJob(gin.H{"name": name, "path": path, "root": newRoot}, job))
+}
+
+// MoveHandler moves a path to ?to=, another path under the same domain. Both must be held by
+// the same name, and nothing may exist at the destination yet.
+func (h *EditHandler) MoveHandler(c *gin.Context) {
+	auth := requestTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+	defer h.Pinner.PinLock()()
+
+	domain := c.Param("domain")
+	to := c.Query("to")
+	if to == "" || to == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must name the destination path"})
+		return
+	}
+	if !strings.HasPrefix(to, "/") {
+		to = "/" + to
+	}
+
+	staged, ok := stagingSession(c, h.Sessions, auth, domain)
+	if !ok {
+		return
+	}
+	if staged != nil {
+		from := c.Param("path")
+		op := session.Op{Op: session.OpMove, Path: from, To: to}
+		staged, err := h.Sessions.Edit(staged.ID, op, func(root string) (string, error) {
+			return h.DAGBuilder.MoveNodeAtPath(root, from, to)
+		})
+		if err != nil {
+			c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to move %s to %s in %s: %v", from, to, domain, err)})
+			return
+		}
+		c.JSON(http.StatusOK, stagedResponse(staged, gin.H{"path": from, "to": to}))
+		return
+	}
+
+	defer h.Resolver.LockName(domain)()
+	name, root, from, err := editTarget(h.Resolver, h.Jobs, h.DAGBuilder, domain, c.Param("path"))
+	if err != nil {
+		c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to resolve %s: %v", domain+c.Param("path"), err)})
+		return
+	}
+	toName, _, toPath, err := editTarget(h.Resolver, h.Jobs, h.DAGBuilder, domain, to)
+	if err != nil {
+		c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to resolve %s: %v", domain+to, err)})
+		return
+	}
+	if toName != name {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot move %s from %s to %s", from, name, toName)})
+		return
+	}
+	if from == "" || from == "/" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot move the root of %s", name)})
+		return
+	}
+
+	newRoot, err := h.DAGBuilder.MoveNodeAtPath(root, from, toPath)
+	if err != nil {
+		c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to move %s to %s in %s: %v", from, toPath, name, err)})
+		return
+	}
+
+	job, err := updateName(h.Resolver, h.Jobs, auth, name, newRoot)
+	if err != nil {
+		c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to update CID of %s: %v", name, err)})
+		return
+	}
+
+	log.Printf("Moved %s to %s in %s, now %s", from, toPath, name, newRoot)
+	c.JSON(http.StatusOK, addJob(gin.H{"name": name, "path": from, "to": toPath, "root": newRoot}, job))
+}
+
+// OpenSessionHandler opens a session staging edits of a domain from its current root. The
+// domain's CID is read from the registry, not the cache, as the commit compares against it.
+// While an update of the domain is queued it answers 409: the registry's CID is about to
+// change, and a session opened on it could never commit.
+func (h *EditHandler) OpenSessionHandler(c *gin.Context) {
+	auth := requestTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+	defer h.Pinner.PinLock()()
+
+	domain := c.Param("domain")
+	owner, err := h.Resolver.GetOwner(domain)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get owner of %s: %v", domain, err)})
+		return
+	}
+	if owner != (common.Address{}) && owner != auth.From {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Failed to open session: %v", resolver.ErrNotAuthorized)})
+		return
+	}
+	// No update of the domain may be queued between the check and reading its CID
+	defer h.Resolver.LockName(domain)()
+	if h.Jobs != nil {
+		if pending, ok := h.Jobs.PendingRoot(domain); ok {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":       fmt.Sprintf("Failed to open session: an update of %s is still pending", domain),
+				"pending_cid": pending,
+			})
+			return
+		}
+	}
+	baseCID, err := h.Resolver.Refresh(domain)
+	if errors.Is(err, resolver.ErrNotFound) {
+		baseCID, err = "", nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to resolve %s: %v", domain, err)})
+		return
+	}
+	if baseCID != "" {
+		// Edits staged on a root that is not stored here would drop its content
+		has, err := h.DAGBuilder.HasNode(baseCID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to look up root %s of %s: %v", baseCID, domain, err)})
+			return
+		}
+		if !has {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Failed to open session: root %s of %s is not stored on this node", baseCID, domain)})
+			return
+		}
+	}
+
+	opened, err := h.Sessions.Open(domain, auth.From.Hex(), baseCID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to open session: %v", err)})
+		return
+	}
+	log.Printf("Opened session %s for %s at %s", opened.ID, domain, baseCID)
+	c.JSON(http.StatusOK, opened)
+}
+
+// GetSessionHandler returns a session and the operations staged in it.
+func (h *EditHandler) GetSessionHandler(c *gin.Context) {
+	staged, err := h.Sessions.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to get session %s: %v", c.Param("id"), err)})
+		return
+	}
+	c.JSON(http.StatusOK, staged)
+}
+
+// CommitSessionHandler points the session's name at its working root in a single update. The
+// commit fails with 409 if the name's CID on the registry changed since the session opened, or
+// an update of the name is still queued; the session then stays open so its operations can be
+// inspected. Once the name's CID moved on, it can never commit.
+func (h *EditHandler) CommitSessionHandler(c *gin.Context) {
+	auth := requestTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+	id := c.Param("id")
+	owned := ownSession(c, h.Sessions, auth, id)
+	if owned == nil {
+		return
+	}
+	// No other edit of the name may be submitted between the check and the update
+	defer h.Resolver.LockName(owned.Name)()
+	staged, err := h.Sessions.StartCommit(id)
+	if err != nil {
+		c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to commit session %s: %v", id, err)})
+		return
+	}
+
+	currentCID, err := h.Resolver.Refresh(staged.Name)
+	if errors.Is(err, resolver.ErrNotFound) {
+		currentCID, err = "", nil
+	}
+	if err != nil {
+		h.abortCommit(id)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to resolve %s: %v", staged.Name, err)})
+		return
+	}
+	if h.Jobs != nil {
+		if pending, ok := h.Jobs.PendingRoot(staged.Name); ok {
+			h.abortCommit(id)
+			c.JSON(http.StatusConflict, gin.H{
+				"error":       fmt.Sprintf("Failed to commit session %s: an update of %s is still pending", id, staged.Name),
+				"base_cid":    staged.BaseCID,
+				"pending_cid": pending,
+			})
+			return
+		}
+	}
+	if currentCID != staged.BaseCID {
+		h.abortCommit(id)
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    fmt.Sprintf("Failed to commit session %s: %s changed since the session opened", id, staged.Name),
+			"base_cid": staged.BaseCID,
+			"cid":      currentCID,
+		})
+		return
+	}
+
+	// A session without changes has nothing to publish
+	var job *jobs.Job
+	if staged.Root != staged.BaseCID {
+		job, err = updateName(h.Resolver, h.Jobs, auth, staged.Name, staged.Root)
+		if err != nil {
+			h.abortCommit(id)
+			c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to update CID of %s: %v", staged.Name, err)})
+			return
+		}
+	}
+
+	jobID := ""
+	if job != nil {
+		jobID = job.ID
+	}
+	committed, err := h.Sessions.FinishCommit(id, jobID)
+	if err != nil {
+		// The root is published already, so this is only logged
+		log.Printf("Warning: failed to record commit of session %s: %v", id, err)
+		committed = staged
+	}
+	log.Printf("Committed session %s: %s is now %s after %d operations", id, staged.Name, staged.Root, len(staged.Ops))
+	c.JSON(http.StatusOK, addJob(gin.H{"session": committed}, job))
+}
+
+// abortCommit reopens a session whose commit failed
+func (h *EditHandler) abortCommit(id string) {
+	if err := h.Sessions.AbortCommit(id); err != nil {
+		log.Printf("Warning: failed to reopen session %s: %v", id, err)
+	}
+}
+
+// CloseSessionHandler discards a session and its staged operations. A committed session whose
+// update was queued keeps its root pinned until it is closed, or until the job is done and the
+// session is reaped.
+func (h *EditHandler) CloseSessionHandler(c *gin.Context) {
+	auth := requestTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+	id := c.Param("id")
+	if ownSession(c, h.Sessions, auth, id) == nil {
+		return
+	}
+	if err := h.Sessions.Close(id); err != nil {
+		c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to close session %s: %v", id, err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "closed": true})
+}
+
+// ownSession returns session id if auth opened it. It writes an error response and returns
+// nil otherwise.
+func ownSession(c *gin.Context, sessions *session.Sessions, auth *bind.TransactOpts, id string) *session.Session {
+	staged, err := sessions.Get(id)
+	if err != nil {
+		c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to get session %s: %v", id, err)})
+		return nil
+	}
+	if common.HexToAddress(staged.Account) != auth.From {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Session %s was opened by another account", id)})
+		return nil
+	}
+	return staged
+}
+
+// stagingSession returns the session named by ?session=, or nil if the request has none and
+// edits the domain directly. ok is false when an error response was written.
+func stagingSession(c *gin.Context, sessions *session.Sessions, auth *bind.TransactOpts, domain string) (staged *session.Session, ok bool) {
+	id := c.Query("session")
+	if id == "" {
+		return nil, true
+	}
+	if staged = ownSession(c, sessions, auth, id); staged == nil {
+		return nil, false
+	}
+	if staged.Name != domain {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Session %s edits %s, not %s", id, staged.Name, domain)})
+		return nil, false
+	}
+	return staged, true
+}
+
+// stagedResponse adds the session an operation was staged in to a response
+func stagedResponse(staged *session.Session, response gin.H) gin.H {
+	response["session"] = staged.ID
+	response["name"] = staged.Name
+	response["root"] = staged.Root
+	response["ops"] = len(staged.Ops)
+	return response
+}
+
+// editTarget returns the name whose DAG holds domain + path: its longest registered prefix, or
+// the domain itself when none is registered. It also returns the name's current root, "" for
+// an unregistered domain, and the path below the name, "" when the name is the path itself.
+// The current root is that of the newest queued update of the name, if one is not mined yet,
+// so an edit keeps the edits before it; callers hold Resolver.LockName(domain) until the
+// update is submitted. An edit below the name fails with storage.ErrNotFound if the root is
+// not stored on this node, rather than publishing a root that holds only the edit.
+func editTarget(r *resolver.Resolver, queue *jobs.Queue, dag *merkledag.DAGBuilder, domain, path string) (name, root, namePath string, err error) {
+	name, root, err = r.Resolve(domain + path)
+	switch {
+	case errors.Is(err, resolver.ErrNotFound):
+		name, root, namePath = domain, "", path
+	case err != nil:
+		return "", "", "", err
+	default:
+		namePath = strings.TrimPrefix(domain+path, name)
+	}
+	if queue != nil {
+		if pending, ok := queue.PendingRoot(name); ok {
+			root = pending
+		}
+	}
+	if root != "" && namePath != "" {
+		has, err := dag.HasNode(root)
+		if err != nil {
+			return "", "", "", fmt.Errorf("failed to look up root %s of %s: %w", root, name, err)
+		}
+		if !has {
+			return "", "", "", fmt.Errorf("%w: root %s of %s", storage.ErrNotFound, root, name)
+		}
+	}
+	return name, root, namePath, nil
+}
+
+// editStatus returns the HTTP status for an error from editing a DAG path or a session. A
+// missing block means the DAG being edited is not (fully) stored on this node.
+func editStatus(err error) int {
+	if errors.Is(err, merkledag.ErrMoveIntoItself) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, merkledag.ErrPathNotFound) || errors.Is(err, session.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, merkledag.ErrNotDirectory) || errors.Is(err, merkledag.ErrPathExists) ||
+		errors.Is(err, session.ErrNotOpen) || errors.Is(err, storage.ErrNotFound) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
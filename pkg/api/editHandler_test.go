@@ -0,0 +1,285 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ipfs-gin-example/config"
+	"ipfs-gin-example/pkg/api"
+	"ipfs-gin-example/pkg/contract/contracttest"
+	"ipfs-gin-example/pkg/jobs"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/session"
+	"ipfs-gin-example/pkg/signer"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/gin-gonic/gin"
+)
+
+// testKey is the legacy server-wide key the requests are signed with
+const testKey = "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"
+
+// editServer serves an EditHandler, an UploadHandler and a DownloadHandler over a local
+// registry in which example.com maps to a site holding /docs/a.txt and /docs/b.txt
+func editServer(t *testing.T) (*gin.Engine, *resolver.Resolver, *merkledag.DAGBuilder) {
+	t.Helper()
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	r := resolver.NewResolver(resolver.NewLocalRegistry(store), pinner)
+	signers, err := signer.NewSigners("", "", testKey, 1337)
+	if err != nil {
+		t.Fatalf("NewSigners: %v", err)
+	}
+	dag := merkledag.NewDAGBuilder(store)
+
+	var root string
+	for path, content := range map[string]string{"/docs/a.txt": "aaaa", "/docs/b.txt": "bb"} {
+		cid, size, err := dag.BuildDAGFromReader(strings.NewReader(content), merkledag.NewChunker(1024))
+		if err != nil {
+			t.Fatalf("BuildDAGFromReader: %v", err)
+		}
+		if root, err = dag.PutNodeAtPath(root, path, cid, size); err != nil {
+			t.Fatalf("PutNodeAtPath: %v", err)
+		}
+	}
+	auth, err := signers.Transactor("")
+	if err != nil {
+		t.Fatalf("Transactor: %v", err)
+	}
+	if err := r.UpdateMapping(auth, "example.com", root); err != nil {
+		t.Fatalf("UpdateMapping: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	sessions := session.NewSessions(store, pinner)
+	api.NewEditHandler(store, r, pinner, signers, nil, sessions).RegisterRoutes(router.Group("/api"))
+	api.NewUploadHandler(store, 1024, r, pinner, signers, nil, sessions, &config.Config{ChunkSize: 1024}).RegisterRoutes(router.Group("/api"))
+	api.NewDownloadHandler(store, r).RegisterRoutes(router.Group("/api"))
+	return router, r, dag
+}
+
+// queueServer serves an EditHandler and an UploadHandler that queue name updates as
+// transactions on a simulated chain, with the test key funded
+func queueServer(t *testing.T) (*gin.Engine, *contracttest.Chain, *jobs.Queue) {
+	t.Helper()
+	chain := contracttest.New(t, 1)
+	signers, err := signer.NewSigners("", "", testKey, contracttest.ChainID)
+	if err != nil {
+		t.Fatalf("NewSigners: %v", err)
+	}
+	auth, err := signers.Transactor("")
+	if err != nil {
+		t.Fatalf("Transactor: %v", err)
+	}
+	fund(t, chain, auth.From)
+
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	r := resolver.NewResolver(chain.Client, pinner)
+	queue := jobs.NewQueue(store, chain.Client, r, pinner, time.Minute, 3)
+	queue.PollInterval = 10 * time.Millisecond
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	sessions := session.NewSessions(store, pinner)
+	api.NewEditHandler(store, r, pinner, signers, queue, sessions).RegisterRoutes(router.Group("/api"))
+	api.NewUploadHandler(store, 1024, r, pinner, signers, queue, sessions, &config.Config{ChunkSize: 1024}).RegisterRoutes(router.Group("/api"))
+	return router, chain, queue
+}
+
+// fund sends ether to account from the chain's first account
+func fund(t *testing.T, chain *contracttest.Chain, account common.Address) {
+	t.Helper()
+	ctx := context.Background()
+	client := chain.Backend.Client()
+	from := chain.Accounts[0]
+	nonce, err := client.PendingNonceAt(ctx, from.From)
+	if err != nil {
+		t.Fatalf("PendingNonceAt: %v", err)
+	}
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		t.Fatalf("SuggestGasPrice: %v", err)
+	}
+	tx, err := from.Signer(from.From, types.NewTransaction(nonce, account, big.NewInt(params.Ether), 21000, gasPrice, nil))
+	if err != nil {
+		t.Fatalf("signing transfer: %v", err)
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		t.Fatalf("SendTransaction: %v", err)
+	}
+	chain.Backend.Commit()
+}
+
+// waitMined polls a queued job until it is mined
+func waitMined(t *testing.T, queue *jobs.Queue, id string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := queue.Get(id)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", id, err)
+		}
+		if job.State == jobs.Mined {
+			return
+		}
+		if job.State != jobs.Pending {
+			t.Fatalf("job %s = %+v, want it mined", id, job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s still pending", id)
+}
+
+// serve sends a request to router and returns the status and decoded JSON body
+func serve(t *testing.T, router *gin.Engine, method, target string) (int, map[string]any) {
+	t.Helper()
+	return serveBody(t, router, method, target, "")
+}
+
+// serveBody is serve for a request with a body
+func serveBody(t *testing.T, router *gin.Engine, method, target, content string) (int, map[string]any) {
+	t.Helper()
+	return serveKey(t, router, method, target, "", content)
+}
+
+// serveKey is serveBody for a request sent with apiKey, or without a key if it is ""
+func serveKey(t *testing.T, router *gin.Engine, method, target, apiKey, content string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(content))
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: invalid JSON %q", method, target, rec.Body.String())
+	}
+	return rec.Code, body
+}
+
+func TestDeletePath(t *testing.T) {
+	router, r, dag := editServer(t)
+
+	status, body := serve(t, router, http.MethodDelete, "/api/example.com/docs/a.txt")
+	if status != http.StatusOK {
+		t.Fatalf("DELETE = %d %v", status, body)
+	}
+	root, err := r.ResolveDomain("example.com")
+	if err != nil || root != body["root"] {
+		t.Fatalf("example.com = %s, %v; want the new root %v", root, err, body["root"])
+	}
+	entries, err := dag.ListDirectory(mustResolve(t, dag, root, "/docs"))
+	if err != nil || len(entries) != 1 || entries[0].Name != "b.txt" || entries[0].Size != 2 {
+		t.Fatalf("ListDirectory(/docs) = %+v, %v; want only b.txt", entries, err)
+	}
+	if size, err := dag.GetNodeSize(root); err != nil || size != 2 {
+		t.Fatalf("root size = %d, %v; want 2", size, err)
+	}
+
+	// Removing the last entry leaves an empty directory
+	if status, body := serve(t, router, http.MethodDelete, "/api/example.com/docs/b.txt"); status != http.StatusOK {
+		t.Fatalf("DELETE of the last entry = %d %v", status, body)
+	}
+	root, _ = r.ResolveDomain("example.com")
+	if entries, err := dag.ListDirectory(mustResolve(t, dag, root, "/docs")); err != nil || len(entries) != 0 {
+		t.Fatalf("ListDirectory(/docs) = %+v, %v; want it empty", entries, err)
+	}
+
+	for target, want := range map[string]int{
+		"/api/example.com/docs/missing.txt": http.StatusNotFound,
+		"/api/example.com/":                 http.StatusBadRequest,
+	} {
+		if status, body := serve(t, router, http.MethodDelete, target); status != want {
+			t.Fatalf("DELETE %s = %d %v, want %d", target, status, body, want)
+		}
+	}
+}
+
+func TestMovePath(t *testing.T) {
+	router, r, dag := editServer(t)
+
+	status, body := serve(t, router, "MOVE", "/api/example.com/docs?to=/archive/docs")
+	if status != http.StatusOK {
+		t.Fatalf("MOVE = %d %v", status, body)
+	}
+	root, _ := r.ResolveDomain("example.com")
+	if _, err := dag.ResolvePath(root, "/archive/docs/a.txt"); err != nil {
+		t.Fatalf("ResolvePath of the moved file: %v", err)
+	}
+	if size, err := dag.GetNodeSize(root); err != nil || size != 6 {
+		t.Fatalf("root size = %d, %v; want 6", size, err)
+	}
+
+	for target, want := range map[string]int{
+		"/api/example.com/archive/docs/a.txt?op=mv&to=/archive/docs/b.txt": http.StatusConflict,   // Existing destination
+		"/api/example.com/archive?op=mv&to=/archive/docs/old":              http.StatusBadRequest, // Into itself
+		"/api/example.com/missing.txt?op=mv&to=/x.txt":                     http.StatusNotFound,
+		"/api/example.com/archive?op=mv":                                   http.StatusBadRequest, // No destination
+	} {
+		if status, body := serve(t, router, http.MethodPost, target); status != want {
+			t.Fatalf("POST %s = %d %v, want %d", target, status, body, want)
+		}
+	}
+}
+
+// mustResolve resolves path under root
+func mustResolve(t *testing.T, dag *merkledag.DAGBuilder, root, path string) string {
+	t.Helper()
+	cid, err := dag.ResolvePath(root, path)
+	if err != nil {
+		t.Fatalf("ResolvePath(%s): %v", path, err)
+	}
+	return cid
+}
+
+func TestOpenSessionWhileUpdatePending(t *testing.T) {
+	router, chain, queue := queueServer(t)
+
+	status, body := serveBody(t, router, http.MethodPut, "/api/example.com/index.html", "<html>")
+	if status != http.StatusOK {
+		t.Fatalf("PUT = %d %v", status, body)
+	}
+	waitMined(t, queue, body["job_id"].(string))
+
+	// A session opened now would start from the registry's CID, which the queued update replaces
+	resume := chain.HoldMining()
+	status, body = serveBody(t, router, http.MethodPut, "/api/example.com/about.html", "<html>")
+	if status != http.StatusOK {
+		t.Fatalf("PUT = %d %v", status, body)
+	}
+	pending := body["root"]
+	if status, body := serve(t, router, http.MethodPost, "/api/example.com/sessions"); status != http.StatusConflict || body["pending_cid"] != pending {
+		t.Fatalf("opening a session = %d %v, want %d with pending_cid %v", status, body, http.StatusConflict, pending)
+	}
+
+	resume()
+	chain.Backend.Commit()
+	waitMined(t, queue, body["job_id"].(string))
+	status, body = serve(t, router, http.MethodPost, "/api/example.com/sessions")
+	if status != http.StatusOK || body["base_cid"] != pending {
+		t.Fatalf("opening a session = %d %v, want it based on %v", status, body, pending)
+	}
+	id := body["id"].(string)
+	if status, body := serveBody(t, router, http.MethodPut, "/api/example.com/new.html?session="+id, "<html>"); status != http.StatusOK {
+		t.Fatalf("PUT in the session = %d %v", status, body)
+	}
+	status, body = serve(t, router, http.MethodPost, "/api/sessions/"+id)
+	if status != http.StatusOK {
+		t.Fatalf("commit = %d %v", status, body)
+	}
+	waitMined(t, queue, body["job_id"].(string))
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"ipfs-gin-example/pkg/jobs"
+	"ipfs-gin-example/pkg/resolver"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/gin-gonic/gin"
+)
+
+// JobHandler reports the state of queued name update transactions.
+type JobHandler struct {
+	Jobs *jobs.Queue
+}
+
+// NewJobHandler creates a new JobHandler.
+func NewJobHandler(queue *jobs.Queue) *JobHandler {
+	return &JobHandler{Jobs: queue}
+}
+
+// RegisterRoutes registers job routes.
+func (h *JobHandler) RegisterRoutes(group *gin.RouterGroup) {
+	group.GET("/jobs/:id", h.GetJobHandler)
+}
+
+// GetJobHandler returns a job: pending, mined or failed, with the receipt once mined.
+func (h *JobHandler) GetJobHandler(c *gin.Context) {
+	job, err := h.Jobs.Get(c.Param("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Job %s not found", c.Param("id"))})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get job: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// updateName points name at cid. With a job queue the transaction is only submitted and its
+// pending job is returned; without one (the local registry) the update completes and job is nil.
+func updateName(r *resolver.Resolver, queue *jobs.Queue, auth *bind.TransactOpts, name, cid string) (*jobs.Job, error) {
+	if queue == nil {
+		return nil, r.UpdateMapping(auth, name, cid)
+	}
+	return queue.Submit(auth, name, cid)
+}
+
+// addJob adds the ID and transaction of a queued name update to a response
+func addJob(response gin.H, job *jobs.Job) gin.H {
+	if job != nil {
+		response["job_id"] = job.ID
+		response["tx_hash"] = job.TxHash
+	}
+	return response
+}
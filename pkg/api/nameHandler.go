@@ -0,0 +1,251 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ipfs-gin-example/pkg/contract"
+	"ipfs-gin-example/pkg/indexer"
+	"ipfs-gin-example/pkg/jobs"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/signer"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+// NameHandler serves the records of names. Names may contain "/", so sub-resources such as
+// /history are matched as suffixes of the catch-all name parameter.
+type NameHandler struct {
+	Resolver *resolver.Resolver
+	Signers  *signer.Signers
+	Jobs     *jobs.Queue      // nil when the registry is local and transfers apply at once
+	Indexer  *indexer.Indexer // nil when the registry has no events to index
+}
+
+// NewNameHandler creates a new NameHandler.
+func NewNameHandler(resolver *resolver.Resolver, signers *signer.Signers, queue *jobs.Queue, ix *indexer.Indexer) *NameHandler {
+	return &NameHandler{
+		Resolver: resolver,
+		Signers:  signers,
+		Jobs:     queue,
+		Indexer:  ix,
+	}
+}
+
+// RegisterRoutes registers name routes.
+func (h *NameHandler) RegisterRoutes(group *gin.RouterGroup) {
+	group.GET("/names/*name", h.GetNameHandler)
+	group.POST("/names/*name", h.PostNameHandler)
+	group.DELETE("/names/*name", h.DeleteNameHandler)
+}
+
+// GetNameHandler dispatches GET requests under /names/.
+func (h *NameHandler) GetNameHandler(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("name"), "/")
+	if name, ok := strings.CutSuffix(name, "/history"); ok && name != "" {
+		h.HistoryHandler(c, name)
+		return
+	}
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	h.InfoHandler(c, name)
+}
+
+// PostNameHandler dispatches POST requests under /names/.
+func (h *NameHandler) PostNameHandler(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("name"), "/")
+	if name, ok := strings.CutSuffix(name, "/transfer"); ok && name != "" {
+		h.TransferHandler(c, name)
+		return
+	}
+	if name, ok := strings.CutSuffix(name, "/delegate"); ok && name != "" {
+		h.DelegateHandler(c, name)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Unknown name resource %s", c.Param("name"))})
+}
+
+// DeleteNameHandler dispatches DELETE requests under /names/.
+func (h *NameHandler) DeleteNameHandler(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("name"), "/")
+	if name, ok := strings.CutSuffix(name, "/delegate"); ok && name != "" {
+		h.RevokeHandler(c, name)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Unknown name resource %s", c.Param("name"))})
+}
+
+// InfoHandler returns the CID and owner of a name, and the block it was registered in once the
+// registration is indexed.
+func (h *NameHandler) InfoHandler(c *gin.Context, name string) {
+	owner, err := h.Resolver.GetOwner(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get owner of %s: %v", name, err)})
+		return
+	}
+	if owner == (common.Address{}) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Name %s is not registered", name)})
+		return
+	}
+	cid, _, err := h.Resolver.GetMapping(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get CID of %s: %v", name, err)})
+		return
+	}
+
+	response := gin.H{"name": name, "cid": cid, "owner": owner.Hex()}
+	if err := h.addParent(response, name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get parent of %s: %v", name, err)})
+		return
+	}
+	if h.Indexer != nil {
+		events, err := h.Indexer.History(c.Request.Context(), name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get history of %s: %v", name, err)})
+			return
+		}
+		for _, event := range events {
+			if event.Type == contract.EventNameRegistered {
+				response["registration_block"] = event.BlockNumber
+				response["registration_tx"] = event.TxHash.Hex()
+				break
+			}
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// TransferHandler transfers a name to the address in the JSON body {"new_owner": "0x..."}.
+// The transaction is signed with the account of the request's API key, which must own the name,
+// and is queued as a job whose ID is returned.
+func (h *NameHandler) TransferHandler(c *gin.Context, name string) {
+	auth := requestKeyedTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+
+	var body struct {
+		NewOwner string `json:"new_owner"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse request body: %v", err)})
+		return
+	}
+	if !common.IsHexAddress(body.NewOwner) || common.HexToAddress(body.NewOwner) == (common.Address{}) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid new owner address %q", body.NewOwner)})
+		return
+	}
+	newOwner := common.HexToAddress(body.NewOwner)
+	response := gin.H{"name": name, "old_owner": auth.From.Hex(), "owner": newOwner.Hex()}
+
+	if h.Jobs != nil {
+		job, err := h.Jobs.SubmitTransfer(auth, name, newOwner)
+		if err != nil {
+			c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to transfer %s: %v", name, err)})
+			return
+		}
+		c.JSON(http.StatusOK, addJob(response, job))
+		return
+	}
+
+	auth.Context = c.Request.Context()
+	if err := h.Resolver.TransferOwnership(auth, name, newOwner); err != nil {
+		c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to transfer %s: %v", name, err)})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DelegateHandler lets the address in the JSON body {"delegate": "0x..."} own the subname.
+// The request's API key must map to the owner of the subname's nearest registered parent.
+// The delegate may then register the subname; a subname that is already registered must also be
+// transferred to them on the contract.
+func (h *NameHandler) DelegateHandler(c *gin.Context, name string) {
+	auth := requestKeyedTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+
+	var body struct {
+		Delegate string `json:"delegate"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse request body: %v", err)})
+		return
+	}
+	if !common.IsHexAddress(body.Delegate) || common.HexToAddress(body.Delegate) == (common.Address{}) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid delegate address %q", body.Delegate)})
+		return
+	}
+
+	delegation, err := h.Resolver.Delegate(auth, name, common.HexToAddress(body.Delegate))
+	if err != nil {
+		c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to delegate %s: %v", name, err)})
+		return
+	}
+	c.JSON(http.StatusOK, delegation)
+}
+
+// RevokeHandler removes the delegation of a subname. Once revoked, a subname registered by the
+// former delegate is no longer resolved, and paths below it resolve inside the parent's DAG.
+func (h *NameHandler) RevokeHandler(c *gin.Context, name string) {
+	auth := requestKeyedTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+	if err := h.Resolver.Revoke(auth, name); err != nil {
+		c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to revoke delegation of %s: %v", name, err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"name": name, "revoked": true})
+}
+
+// addParent adds the registered parent of a subname and its delegation, if any, to a response
+func (h *NameHandler) addParent(response gin.H, name string) error {
+	parent, parentOwner, err := h.Resolver.RegisteredParent(name)
+	if err != nil || parent == "" {
+		return err
+	}
+	response["parent"] = parent
+	response["parent_owner"] = parentOwner.Hex()
+	if h.Resolver.Delegations != nil {
+		delegation, err := h.Resolver.Delegations.Get(name)
+		if err != nil {
+			return err
+		}
+		if delegation != nil {
+			response["delegation"] = delegation
+		}
+	}
+	return nil
+}
+
+// HistoryHandler returns every indexed event of a name, oldest first: its registration, each CID
+// it pointed to and each owner change. Events appear once their block has enough confirmations.
+func (h *NameHandler) HistoryHandler(c *gin.Context, name string) {
+	if h.Indexer == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Name history requires the contract name registry"})
+		return
+	}
+
+	events, err := h.Indexer.History(c.Request.Context(), name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get history of %s: %v", name, err)})
+		return
+	}
+	indexed, ok, err := h.Indexer.IndexedBlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get indexed block: %v", err)})
+		return
+	}
+
+	response := gin.H{"name": name, "name_hash": contract.NameHash(name).Hex(), "events": events}
+	if ok {
+		response["indexed_block"] = indexed
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"ipfs-gin-example/pkg/contract"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gin-gonic/gin"
+)
+
+// RelayHandler lets clients that keep their own keys sign name updates: the gateway prepares
+// the unsigned contract call and broadcasts the transaction the client signed.
+type RelayHandler struct {
+	DAGBuilder *merkledag.DAGBuilder
+	Chunker    merkledag.Chunker
+	ChunkSize  int
+	Resolver   *resolver.Resolver
+	Pinner     *pin.Pinner
+	Contract   *contract.Client
+	ChainID    *big.Int
+	PinTTL     time.Duration // How long a prepared root is kept for its signed transaction
+}
+
+// relayPinTTL is the default RelayHandler.PinTTL
+const relayPinTTL = time.Hour
+
+// NewRelayHandler creates a new RelayHandler.
+func NewRelayHandler(store storage.Store, chunkSize int, resolver *resolver.Resolver, pinner *pin.Pinner, contractClient *contract.Client, chainID int64) *RelayHandler {
+	return &RelayHandler{
+		DAGBuilder: merkledag.NewDAGBuilder(store),
+		Chunker:    merkledag.NewChunker(chunkSize),
+		ChunkSize:  chunkSize,
+		Resolver:   resolver,
+		Pinner:     pinner,
+		Contract:   contractClient,
+		ChainID:    big.NewInt(chainID),
+		PinTTL:     relayPinTTL,
+	}
+}
+
+// RegisterRoutes registers relay routes.
+func (h *RelayHandler) RegisterRoutes(group *gin.RouterGroup) {
+	group.POST("/relay/prepare", h.PrepareHandler)
+	group.POST("/relay/submit", h.SubmitHandler)
+}
+
+// PrepareHandler returns the unsigned register or updateCID transaction that points ?name= at
+// a root CID, to be signed by ?from=. The root is ?cid= if given; otherwise the request body
+// is uploaded as a file. The root is pinned for PinTTL, so it survives GC until the signed
+// transaction is submitted; a transaction that is never submitted leaves nothing pinned.
+func (h *RelayHandler) PrepareHandler(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if !common.IsHexAddress(c.Query("from")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be the address that will sign the transaction"})
+		return
+	}
+	from := common.HexToAddress(c.Query("from"))
+
+	var rootCID string
+	var size uint64
+	if cid := c.Query("cid"); cid != "" {
+		// The DAG must stay complete until it is pinned
+		defer h.Pinner.PinLock()()
+		normalized, err := merkledag.NormalizeCID(cid)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid CID: %v", err)})
+			return
+		}
+		// The root is pinned for its name once relayed, and a pin needs the whole DAG here
+		complete, err := h.DAGBuilder.HasDAG(c.Request.Context(), normalized)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to check DAG %s: %v", normalized, err)})
+			return
+		}
+		if !complete {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("CID %s is not stored on this node in full", normalized)})
+			return
+		}
+		rootCID = normalized
+	} else {
+		chunker := h.Chunker
+		if spec := c.Query("chunker"); spec != "" {
+			var err error
+			if chunker, err = merkledag.ParseChunker(spec, h.ChunkSize); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		// The body streams in without holding off GC, which keeps its blocks until they are pinned
+		store, release := h.Pinner.TrackWrites()
+		defer release()
+		var err error
+		rootCID, size, err = merkledag.NewDAGBuilder(store).BuildDAGFromReader(c.Request.Body, chunker)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to build DAG: %v", err)})
+			return
+		}
+		defer h.Pinner.PinLock()()
+	}
+
+	// Same choice UpdateMapping makes for server-signed updates
+	owner, err := h.Contract.GetOwner(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get owner of %s: %v", name, err)})
+		return
+	}
+	method := contract.MethodRegister
+	if owner != (common.Address{}) {
+		if owner != from {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("%s is owned by %s", name, owner.Hex())})
+			return
+		}
+		method = contract.MethodUpdateCID
+	}
+
+	tx, err := h.Contract.PrepareTx(c.Request.Context(), from, method, name, rootCID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to prepare transaction: %v", err)})
+		return
+	}
+
+	signingHash := types.LatestSignerForChainID(h.ChainID).Hash(tx)
+	expires := time.Now().Add(h.PinTTL)
+	if err := h.Pinner.PinTemporary(relayPinID(signingHash), rootCID, expires); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to pin %s: %v", rootCID, err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":         name,
+		"cid":          rootCID,
+		"size":         size,
+		"method":       method,
+		"from":         from.Hex(),
+		"tx":           tx,
+		"signing_hash": signingHash.Hex(),
+		"pin_expires":  expires.UTC(),
+	})
+}
+
+// SubmitHandler broadcasts a signed transaction from PrepareHandler, waits for it to be mined
+// and refreshes the resolver's view of the name. The temporary pin of the prepared root is
+// replaced by the name's pin once the transaction is mined, and dropped if it reverts.
+func (h *RelayHandler) SubmitHandler(c *gin.Context) {
+	var request struct {
+		RawTx string `json:"raw_tx"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse request body: %v", err)})
+		return
+	}
+
+	raw, err := hexutil.Decode(request.RawTx)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("raw_tx must be 0x-prefixed hex: %v", err)})
+		return
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid transaction: %v", err)})
+		return
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(h.ChainID), tx)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid transaction signature: %v", err)})
+		return
+	}
+	method, name, callCID, err := h.Contract.DecodeCall(tx.Data())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported transaction: %v", err)})
+		return
+	}
+
+	// The signed transaction hashes for signing like the prepared one it was signed from
+	pinID := relayPinID(types.LatestSignerForChainID(h.ChainID).Hash(tx))
+
+	receipt, err := h.Contract.SendSignedTx(c.Request.Context(), tx)
+	if errors.Is(err, contract.ErrTxReverted) {
+		if err := h.Pinner.UnpinTemporary(pinID); err != nil {
+			log.Printf("Warning: failed to unpin prepared root of transaction %s: %v", tx.Hash().Hex(), err)
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Transaction %s reverted", tx.Hash().Hex()), "receipt": receipt})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cid, err := h.Resolver.Refresh(name)
+	if err != nil {
+		log.Printf("Warning: failed to refresh %s after transaction %s: %v", name, tx.Hash().Hex(), err)
+	}
+	h.pinRelayed(pinID, name, callCID)
+
+	log.Printf("Relayed %s of %s to %s by %s in transaction %s", method, name, cid, from.Hex(), tx.Hash().Hex())
+	c.JSON(http.StatusOK, gin.H{
+		"tx_hash":      tx.Hash().Hex(),
+		"block_number": receipt.BlockNumber,
+		"gas_used":     receipt.GasUsed,
+		"from":         from.Hex(),
+		"method":       method,
+		"name":         name,
+		"cid":          cid,
+	})
+}
+
+// pinRelayed pins the root a relayed transaction mapped name to, if it was prepared here, and
+// drops its temporary pin
+func (h *RelayHandler) pinRelayed(pinID, name, cid string) {
+	prepared, err := h.Pinner.TemporaryPin(pinID)
+	if err != nil {
+		log.Printf("Warning: failed to read pin %s: %v", pinID, err)
+		return
+	}
+	if prepared == "" {
+		return // Not prepared here, or expired; the content may not be stored here
+	}
+	if err := h.Pinner.PinName(name, cid); err != nil {
+		log.Printf("Warning: failed to pin %s for name %s: %v", cid, name, err)
+		return
+	}
+	if err := h.Pinner.UnpinTemporary(pinID); err != nil {
+		log.Printf("Warning: failed to unpin %s: %v", pinID, err)
+	}
+}
+
+// relayPinID returns the ID of the temporary pin of a prepared transaction
+func relayPinID(signingHash common.Hash) string {
+	return "relay/" + signingHash.Hex()
+}
@@ -1,41 +1,49 @@
 package api
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"math/big"
 	"net/http"
-	"strings"
 
 	"ipfs-gin-example/config"
+	"ipfs-gin-example/pkg/jobs"
 	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
 	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/session"
+	"ipfs-gin-example/pkg/signer"
 	"ipfs-gin-example/pkg/storage"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/gin-gonic/gin"
 )
 
 // UploadHandler handles all upload-related API operations.
 type UploadHandler struct {
 	Store      storage.Store
-	Chunker    *merkledag.Chunker
+	Chunker    merkledag.Chunker // Default chunker, used when an upload does not choose one
 	DAGBuilder *merkledag.DAGBuilder
 	Resolver   *resolver.Resolver
+	Pinner     *pin.Pinner
+	Signers    *signer.Signers // Accounts name updates are signed with, selected by API key
+	Jobs       *jobs.Queue     // Queues name update transactions; nil updates synchronously
+	Sessions   *session.Sessions
 	Config     *config.Config
 }
 
 // NewUploadHandler creates a new UploadHandler.
-func NewUploadHandler(store storage.Store, chunkSize int, resolver *resolver.Resolver, cfg *config.Config) *UploadHandler {
+func NewUploadHandler(store storage.Store, chunkSize int, resolver *resolver.Resolver, pinner *pin.Pinner, signers *signer.Signers, queue *jobs.Queue, sessions *session.Sessions, cfg *config.Config) *UploadHandler {
 	dagBuilder := merkledag.NewDAGBuilder(store)
 	return &UploadHandler{
 		Store:      store,
 		Chunker:    merkledag.NewChunker(chunkSize),
 		DAGBuilder: dagBuilder,
 		Resolver:   resolver,
+		Pinner:     pinner,
+		Signers:    signers,
+		Jobs:       queue,
+		Sessions:   sessions,
 		Config:     cfg,
 	}
 }
@@ -46,81 +54,83 @@ func (h *UploadHandler) RegisterRoutes(group *gin.RouterGroup) {
 	group.POST("/upload/multipart", h.MultipartUploadHandler)
 	group.POST("/upload/dag", h.DAGUploadHandler)
 	group.PUT("/:domain/*path", h.PutHandler)
+	group.POST("/migrate", h.MigrateHandler)
+}
+
+// trackedDAG returns a DAGBuilder for an upload to store its blocks through. GC keeps them until
+// release is called, so the upload streams without holding off GC and takes PinLock only to
+// pin its root and map it to a name.
+func (h *UploadHandler) trackedDAG() (dag *merkledag.DAGBuilder, release func()) {
+	store, release := h.Pinner.TrackWrites()
+	return merkledag.NewDAGBuilder(store), release
+}
+
+// updateNameLocked points name at cid under PinLock; from then on the name or job pin keeps it
+func (h *UploadHandler) updateNameLocked(auth *bind.TransactOpts, name, cid string) (*jobs.Job, error) {
+	defer h.Pinner.PinLock()()
+	return updateName(h.Resolver, h.Jobs, auth, name, cid)
 }
 
 // UploadHandler handles single file upload via request body.
 func (h *UploadHandler) UploadHandler(c *gin.Context) {
-	content, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read request body: %v", err)})
+	auth := requestTransactor(c, h.Signers)
+	if auth == nil {
 		return
 	}
 
-	reader := bytes.NewReader(content)
-	leaves, err := h.Chunker.Chunk(reader)
+	name := c.Query("name")
+	chunker, err := h.chunkerFor(c, name)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to chunk content: %v", err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	rootCID, size, err := h.DAGBuilder.BuildDAGFromLeaves(leaves)
+	dag, release := h.trackedDAG()
+	defer release()
+	rootCID, size, err := dag.BuildDAGFromReader(c.Request.Body, chunker)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to build DAG: %v", err)})
 		return
 	}
 
-	name := c.Query("name")
 	if name == "" {
-		name = fmt.Sprintf("file-%s", rootCID[:8])
+		name = fmt.Sprintf("file-%s", shortCID(rootCID))
 	}
 
-	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(h.Config.PrivateKey, "0x"))
+	job, err := h.updateNameLocked(auth, name, rootCID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Invalid private key: %v", err)})
-		return
-	}
-
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(h.Config.ChainID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to prepare transaction: %v", err)})
-		return
-	}
-
-	err = h.Resolver.UpdateMapping(auth, name, rootCID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to register/update CID: %v", err)})
+		c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to register/update CID: %v", err)})
 		return
 	}
 
 	log.Printf("Registered/Updated CID %s for name %s", rootCID, name)
-	c.JSON(http.StatusOK, gin.H{"cid": rootCID, "size": size, "name": name})
+	c.JSON(http.StatusOK, addJob(gin.H{"cid": rootCID, "size": size, "name": name, "chunker": chunker.String()}, job))
 }
 
-// MultipartUploadHandler handles uploading multiple files via multipart form.
+// MultipartUploadHandler handles uploading multiple files via multipart form. Each file name is
+// registered along with the directory unless ?batch=true, which registers only the directory
+// name; its files are then served by path inside the directory DAG, in a single transaction.
 func (h *UploadHandler) MultipartUploadHandler(c *gin.Context) {
+	auth := requestTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+
 	form, err := c.MultipartForm()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse multipart form: %v", err)})
 		return
 	}
 
+	batch := c.Query("batch") == "true"
 	files := form.File
 	itemCIDs := make(map[string]struct {
 		CID  string
 		Size uint64
 	})
-
-	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(h.Config.PrivateKey, "0x"))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Invalid private key: %v", err)})
-		return
-	}
-
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(h.Config.ChainID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to prepare transaction: %v", err)})
-		return
-	}
+	itemJobs := make(map[string]string) // File name -> job ID, when updates are queued
+	dag, release := h.trackedDAG()
+	defer release()
 
 	for _, fileHeaders := range files {
 		for _, fileHeader := range fileHeaders {
@@ -131,23 +141,28 @@ func (h *UploadHandler) MultipartUploadHandler(c *gin.Context) {
 			}
 			defer file.Close()
 
-			leaves, err := h.Chunker.Chunk(file)
+			name := fileHeader.Filename
+			chunker, err := h.chunkerFor(c, name)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to chunk file %s: %v", fileHeader.Filename, err)})
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
 
-			fileRootCID, fileSize, err := h.DAGBuilder.BuildDAGFromLeaves(leaves)
+			fileRootCID, fileSize, err := dag.BuildDAGFromReader(file, chunker)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to build DAG for file %s: %v", fileHeader.Filename, err)})
 				return
 			}
 
-			name := fileHeader.Filename
-			err = h.Resolver.UpdateMapping(auth, name, fileRootCID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to register/update CID for %s: %v", name, err)})
-				return
+			if !batch {
+				job, err := h.updateNameLocked(auth, name, fileRootCID)
+				if err != nil {
+					c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to register/update CID for %s: %v", name, err)})
+					return
+				}
+				if job != nil {
+					itemJobs[fileHeader.Filename] = job.ID
+				}
 			}
 
 			itemCIDs[fileHeader.Filename] = struct {
@@ -158,7 +173,7 @@ func (h *UploadHandler) MultipartUploadHandler(c *gin.Context) {
 	}
 
 	if len(itemCIDs) > 0 {
-		dirRootCID, dirSize, err := h.DAGBuilder.BuildDirectoryDAG(itemCIDs)
+		dirRootCID, dirSize, err := dag.BuildDirectoryDAG(itemCIDs)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to build directory DAG: %v", err)})
 			return
@@ -166,16 +181,20 @@ func (h *UploadHandler) MultipartUploadHandler(c *gin.Context) {
 
 		name := c.Query("name")
 		if name == "" {
-			name = fmt.Sprintf("dir-%s", dirRootCID[:8])
+			name = fmt.Sprintf("dir-%s", shortCID(dirRootCID))
 		}
 
-		err = h.Resolver.UpdateMapping(auth, name, dirRootCID)
+		job, err := h.updateNameLocked(auth, name, dirRootCID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to register/update directory CID: %v", err)})
+			c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to register/update directory CID: %v", err)})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"directory_cid": dirRootCID, "size": dirSize, "files": itemCIDs, "name": name})
+		response := addJob(gin.H{"directory_cid": dirRootCID, "size": dirSize, "files": itemCIDs, "name": name}, job)
+		if len(itemJobs) > 0 {
+			response["file_jobs"] = itemJobs
+		}
+		c.JSON(http.StatusOK, response)
 	} else {
 		c.JSON(http.StatusOK, gin.H{"message": "No files uploaded"})
 	}
@@ -183,6 +202,11 @@ func (h *UploadHandler) MultipartUploadHandler(c *gin.Context) {
 
 // DAGUploadHandler handles pre-built DAG upload.
 func (h *UploadHandler) DAGUploadHandler(c *gin.Context) {
+	auth := requestTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+
 	var uploadData struct {
 		Root  string            `json:"root"`
 		Nodes []*merkledag.Node `json:"nodes"`
@@ -197,18 +221,30 @@ func (h *UploadHandler) DAGUploadHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Root CID is required"})
 		return
 	}
+	rootCID, err := merkledag.NormalizeCID(uploadData.Root)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid root CID: %v", err)})
+		return
+	}
+	uploadData.Root = rootCID
 	if len(uploadData.Nodes) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Node list is empty"})
 		return
 	}
 
+	dag, release := h.trackedDAG()
+	defer release()
+	cids, err := dag.AddNodes(uploadData.Nodes)
+	if errors.Is(err, merkledag.ErrNotUnixFS) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to store node: %v", err)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to store node: %v", err)})
+		return
+	}
 	storedNodes := make(map[string]bool)
-	for _, node := range uploadData.Nodes {
-		cid, err := h.DAGBuilder.AddNode(node)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to store node: %v", err)})
-			return
-		}
+	for _, cid := range cids {
 		storedNodes[cid] = true
 	}
 
@@ -219,24 +255,12 @@ func (h *UploadHandler) DAGUploadHandler(c *gin.Context) {
 
 	name := c.Query("name")
 	if name == "" {
-		name = fmt.Sprintf("dag-%s", uploadData.Root[:8])
-	}
-
-	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(h.Config.PrivateKey, "0x"))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Invalid private key: %v", err)})
-		return
-	}
-
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(h.Config.ChainID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to prepare transaction: %v", err)})
-		return
+		name = fmt.Sprintf("dag-%s", shortCID(uploadData.Root))
 	}
 
-	err = h.Resolver.UpdateMapping(auth, name, uploadData.Root)
+	job, err := h.updateNameLocked(auth, name, uploadData.Root)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to register/update CID: %v", err)})
+		c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to register/update CID: %v", err)})
 		return
 	}
 
@@ -246,11 +270,19 @@ func (h *UploadHandler) DAGUploadHandler(c *gin.Context) {
 		rootSize = h.DAGBuilder.CalculateNodeSize(rootNode)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"root_cid": uploadData.Root, "root_size": rootSize, "stored_node_count": len(storedNodes), "name": name})
+	c.JSON(http.StatusOK, addJob(gin.H{"root_cid": uploadData.Root, "root_size": rootSize, "stored_node_count": len(storedNodes), "name": name}, job))
 }
 
-// PutHandler handles putting content at a specific path under a domain.
+// PutHandler puts content at a path under a domain. The file is spliced into the DAG of the
+// longest registered prefix of domain + path, or of a new domain when none is registered, and
+// only that name is pointed at the new root, so a site edit is a single name update. With
+// ?session= the file is staged in that session's root instead.
 func (h *UploadHandler) PutHandler(c *gin.Context) {
+	auth := requestTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+
 	domain := c.Param("domain")
 	path := c.Param("path")
 
@@ -259,43 +291,162 @@ func (h *UploadHandler) PutHandler(c *gin.Context) {
 		return
 	}
 
-	content, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to read request body: %v", err)})
+	staged, ok := stagingSession(c, h.Sessions, auth, domain)
+	if !ok {
 		return
 	}
+	var name, currentRoot, filePath string
+	var err error
+	if staged != nil {
+		name, currentRoot, filePath = staged.Name, staged.Root, path
+	} else {
+		defer h.Resolver.LockName(domain)()
+		if name, currentRoot, filePath, err = editTarget(h.Resolver, h.Jobs, h.DAGBuilder, domain, path); err != nil {
+			c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to resolve %s: %v", domain+path, err)})
+			return
+		}
+	}
 
-	reader := bytes.NewReader(content)
-	leaves, err := h.Chunker.Chunk(reader)
+	// Keep the chunker of the file being replaced
+	var currentCID string
+	if currentRoot != "" {
+		currentCID, _ = h.DAGBuilder.ResolvePath(currentRoot, filePath)
+	}
+	chunker, err := h.chunkerReplacing(c, currentCID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to chunk content: %v", err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	rootCID, size, err := h.DAGBuilder.BuildDAGFromLeaves(leaves)
+	dag, release := h.trackedDAG()
+	defer release()
+	fileCID, size, err := dag.BuildDAGFromReader(c.Request.Body, chunker)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to build DAG: %v", err)})
 		return
 	}
+	// The file is spliced into the name's DAG and pinned with it from here on
+	defer h.Pinner.PinLock()()
+
+	if staged != nil {
+		op := session.Op{Op: session.OpPut, Path: filePath, CID: fileCID}
+		staged, err = h.Sessions.Edit(staged.ID, op, func(root string) (string, error) {
+			return h.DAGBuilder.PutNodeAtPath(root, filePath, fileCID, size)
+		})
+		if err != nil {
+			c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to put %s in %s: %v", filePath, name, err)})
+			return
+		}
+		c.JSON(http.StatusOK, stagedResponse(staged, gin.H{"cid": fileCID, "size": size, "path": filePath, "chunker": chunker.String()}))
+		return
+	}
+
+	// A name registered for the path itself is replaced rather than edited
+	rootCID := fileCID
+	if filePath != "" {
+		rootCID, err = h.DAGBuilder.PutNodeAtPath(currentRoot, filePath, fileCID, size)
+		if err != nil {
+			c.JSON(editStatus(err), gin.H{"error": fmt.Sprintf("Failed to put %s in %s: %v", filePath, name, err)})
+			return
+		}
+	}
 
-	name := domain + path
-	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(h.Config.PrivateKey, "0x"))
+	job, err := updateName(h.Resolver, h.Jobs, auth, name, rootCID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Invalid private key: %v", err)})
+		c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to register/update CID: %v", err)})
+		return
+	}
+
+	log.Printf("Put %s at %s%s, %s is now %s", fileCID, name, filePath, name, rootCID)
+	c.JSON(http.StatusOK, addJob(gin.H{
+		"cid":     fileCID,
+		"size":    size,
+		"name":    name,
+		"path":    filePath,
+		"root":    rootCID,
+		"chunker": chunker.String(),
+	}, job))
+}
+
+// MigrateHandler re-encodes the JSON blocks of a name's DAG, and dag-pb blocks without UnixFS
+// Data, in the current encoding and points the name at the new root.
+func (h *UploadHandler) MigrateHandler(c *gin.Context) {
+	auth := requestTransactor(c, h.Signers)
+	if auth == nil {
+		return
+	}
+
+	name := c.Query("name")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
 		return
 	}
 
-	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(h.Config.ChainID))
+	defer h.Resolver.LockName(name)()
+	oldCID, err := h.Resolver.ResolveDomain(name)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to prepare transaction: %v", err)})
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Failed to resolve CID for %s: %v", name, err)})
 		return
 	}
+	if h.Jobs != nil {
+		// Migrate the newest root, queued updates included
+		if pending, ok := h.Jobs.PendingRoot(name); ok {
+			oldCID = pending
+		}
+	}
 
-	err = h.Resolver.UpdateMapping(auth, name, rootCID)
+	dag, release := h.trackedDAG()
+	defer release()
+	newCID, err := dag.MigrateDAG(oldCID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to register/update CID: %v", err)})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to migrate DAG %s: %v", oldCID, err)})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"cid": rootCID, "size": size, "name": name})
+	var job *jobs.Job
+	if newCID != oldCID {
+		job, err = h.updateNameLocked(auth, name, newCID)
+		if err != nil {
+			c.JSON(updateMappingStatus(err), gin.H{"error": fmt.Sprintf("Failed to register/update CID: %v", err)})
+			return
+		}
+		log.Printf("Migrated %s from %s to %s", name, oldCID, newCID)
+	}
+
+	c.JSON(http.StatusOK, addJob(gin.H{"name": name, "old_cid": oldCID, "cid": newCID}, job))
+}
+
+// chunkerFor picks the chunker for an upload to name. An explicit ?chunker= spec wins;
+// otherwise the chunker recorded for the name's current content is reused, so re-uploading
+// the same file yields the same root CID. It falls back to the default chunker.
+func (h *UploadHandler) chunkerFor(c *gin.Context, name string) (merkledag.Chunker, error) {
+	var currentCID string
+	if c.Query("chunker") == "" && name != "" {
+		if cid, found, err := h.Resolver.GetMapping(name); err == nil && found {
+			currentCID = cid
+		}
+	}
+	return h.chunkerReplacing(c, currentCID)
+}
+
+// chunkerReplacing returns the chunker for a file that replaces currentCID, which may be "":
+// the ?chunker= query parameter, else the chunker currentCID was built with, else the default.
+func (h *UploadHandler) chunkerReplacing(c *gin.Context, currentCID string) (merkledag.Chunker, error) {
+	spec := c.Query("chunker")
+	if spec == "" && currentCID != "" {
+		spec = h.DAGBuilder.ChunkerSpec(currentCID)
+	}
+	if spec == "" {
+		return h.Chunker, nil
+	}
+	return merkledag.ParseChunker(spec, h.Config.ChunkSize)
+}
+
+// shortCID returns the last eight characters of a CID for use in generated names.
+// CIDv1 strings share their leading characters, so the tail is the distinctive part.
+func shortCID(cid string) string {
+	if len(cid) <= 8 {
+		return cid
+	}
+	return cid[len(cid)-8:]
 }
@@ -0,0 +1,205 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ipfs-gin-example/pkg/api"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/signer"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mapName points name at cid, signed with the test key
+func mapName(t *testing.T, r *resolver.Resolver, name, cid string) {
+	t.Helper()
+	signers, err := signer.NewSigners("", "", testKey, 1337)
+	if err != nil {
+		t.Fatalf("NewSigners: %v", err)
+	}
+	auth, err := signers.Transactor("")
+	if err != nil {
+		t.Fatalf("Transactor: %v", err)
+	}
+	if err := r.UpdateMapping(auth, name, cid); err != nil {
+		t.Fatalf("UpdateMapping(%s): %v", name, err)
+	}
+}
+
+func TestPutPath(t *testing.T) {
+	router, r, dag := editServer(t)
+
+	status, body := serveBody(t, router, http.MethodPut, "/api/example.com/docs/c.txt", "cccccc")
+	if status != http.StatusOK {
+		t.Fatalf("PUT = %d %v", status, body)
+	}
+	root, err := r.ResolveDomain("example.com")
+	if err != nil || root != body["root"] {
+		t.Fatalf("example.com = %s, %v; want the new root %v", root, err, body["root"])
+	}
+	entries, err := dag.ListDirectory(mustResolve(t, dag, root, "/docs"))
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("ListDirectory(/docs) = %+v, %v; want a.txt, b.txt and c.txt", entries, err)
+	}
+	if data, err := dag.GetFileData(mustResolve(t, dag, root, "/docs/c.txt")); err != nil || string(data) != "cccccc" {
+		t.Fatalf("GetFileData(/docs/c.txt) = %q, %v", data, err)
+	}
+}
+
+func TestPutMissingRoot(t *testing.T) {
+	router, r, dag := editServer(t)
+
+	// The name's root was published by another node and is not stored here
+	missing := merkledag.NewCID(merkledag.CodecDagPB, []byte("elsewhere")).String()
+	if has, err := dag.HasNode(missing); err != nil || has {
+		t.Fatalf("HasNode(%s) = %v, %v", missing, has, err)
+	}
+	mapName(t, r, "remote.example", missing)
+
+	for _, target := range []string{"/api/remote.example/index.html", "/api/remote.example/docs/index.html"} {
+		if status, body := serveBody(t, router, http.MethodPut, target, "<html>"); status != http.StatusConflict {
+			t.Fatalf("PUT %s = %d %v, want %d", target, status, body, http.StatusConflict)
+		}
+		if root, err := r.ResolveDomain("remote.example"); err != nil || root != missing {
+			t.Fatalf("remote.example = %s, %v; want it unchanged at %s", root, err, missing)
+		}
+	}
+	if status, body := serve(t, router, http.MethodDelete, "/api/remote.example/index.html"); status != http.StatusConflict {
+		t.Fatalf("DELETE = %d %v, want %d", status, body, http.StatusConflict)
+	}
+	if status, body := serve(t, router, http.MethodPost, "/api/remote.example/sessions"); status != http.StatusConflict {
+		t.Fatalf("opening a session = %d %v, want %d", status, body, http.StatusConflict)
+	}
+}
+
+func TestUploadReusesChunker(t *testing.T) {
+	router, r, dag := editServer(t)
+	signers, err := signer.NewSigners("", "", testKey, 1337)
+	if err != nil {
+		t.Fatalf("NewSigners: %v", err)
+	}
+	api.NewNameHandler(r, signers, nil, nil).RegisterRoutes(router.Group("/api"))
+	content := strings.Repeat("content-defined chunks ", 100)
+
+	// A new version of a name is chunked like the one it replaces unless ?chunker= says otherwise
+	for _, tt := range []struct {
+		name, chunker, want string
+	}{
+		{"notes.txt", "rabin-256", "rabin-64-256-1024"},
+		{"notes.txt", "", "rabin-64-256-1024"},
+		{"other.txt", "", "size-1024"},
+		{"notes.txt", "size-512", "size-512"},
+		{"notes.txt", "", "size-512"},
+	} {
+		target := "/api/upload?name=" + tt.name
+		if tt.chunker != "" {
+			target += "&chunker=" + tt.chunker
+		}
+		status, body := serveBody(t, router, http.MethodPost, target, content)
+		if status != http.StatusOK || body["chunker"] != tt.want {
+			t.Fatalf("POST %s = %d %v, want chunker %s", target, status, body, tt.want)
+		}
+		if spec := dag.ChunkerSpec(body["cid"].(string)); spec != tt.want {
+			t.Fatalf("recorded chunker of %s = %q, want %q", body["cid"], spec, tt.want)
+		}
+		if status, info := serve(t, router, http.MethodGet, "/api/names/"+tt.name); status != http.StatusOK || info["cid"] != body["cid"] {
+			t.Fatalf("GET /api/names/%s = %d %v, want cid %v", tt.name, status, info, body["cid"])
+		}
+	}
+	if status, body := serveBody(t, router, http.MethodPost, "/api/upload?name=notes.txt&chunker=bogus", content); status != http.StatusBadRequest {
+		t.Fatalf("upload with an invalid chunker = %d %v, want %d", status, body, http.StatusBadRequest)
+	}
+
+	// A file replaced in place keeps the chunker of the file at its path
+	for _, target := range []string{"/api/example.com/docs/c.txt?chunker=rabin-256", "/api/example.com/docs/c.txt"} {
+		if status, body := serveBody(t, router, http.MethodPut, target, content); status != http.StatusOK {
+			t.Fatalf("PUT %s = %d %v", target, status, body)
+		}
+		root, _ := r.ResolveDomain("example.com")
+		if spec := dag.ChunkerSpec(mustResolve(t, dag, root, "/docs/c.txt")); spec != "rabin-64-256-1024" {
+			t.Fatalf("chunker of /docs/c.txt after PUT %s = %q, want rabin-64-256-1024", target, spec)
+		}
+	}
+}
+
+// serveFiles posts files as a multipart form and returns the status and decoded JSON body
+func serveFiles(t *testing.T, router *gin.Engine, target string, files map[string]string) (int, map[string]any) {
+	t.Helper()
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	for name, content := range files {
+		part, err := writer.CreateFormFile("files", name)
+		if err != nil {
+			t.Fatalf("CreateFormFile: %v", err)
+		}
+		if _, err := part.Write([]byte(content)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, target, &form)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("POST %s: invalid JSON %q", target, rec.Body.String())
+	}
+	return rec.Code, body
+}
+
+func TestMultipartBatchRegistersOnlyTheDirectory(t *testing.T) {
+	router, r, _ := editServer(t)
+	signers, err := signer.NewSigners("", "", testKey, 1337)
+	if err != nil {
+		t.Fatalf("NewSigners: %v", err)
+	}
+	api.NewNameHandler(r, signers, nil, nil).RegisterRoutes(router.Group("/api"))
+
+	status, body := serveFiles(t, router, "/api/upload/multipart?batch=true&name=gallery", map[string]string{"a.txt": "aaa", "b.txt": "bbbb"})
+	if status != http.StatusOK {
+		t.Fatalf("batch upload = %d %v", status, body)
+	}
+	if root, err := r.ResolveDomain("gallery"); err != nil || root != body["directory_cid"] {
+		t.Fatalf("gallery = %s, %v; want the directory %v", root, err, body["directory_cid"])
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if status, info := serve(t, router, http.MethodGet, "/api/names/"+name); status != http.StatusNotFound {
+			t.Fatalf("GET /api/names/%s after a batch upload = %d %v, want %d", name, status, info, http.StatusNotFound)
+		}
+	}
+	// Its files are served by path inside the directory
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/gallery/b.txt", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "bbbb" {
+		t.Fatalf("GET /api/gallery/b.txt = %d %q, want bbbb", rec.Code, rec.Body.String())
+	}
+
+	// Without batch mode every file gets a name of its own as well
+	status, body = serveFiles(t, router, "/api/upload/multipart?name=album", map[string]string{"c.txt": "cc"})
+	if status != http.StatusOK {
+		t.Fatalf("upload = %d %v", status, body)
+	}
+	file := body["files"].(map[string]any)["c.txt"].(map[string]any)["CID"]
+	if status, info := serve(t, router, http.MethodGet, "/api/names/c.txt"); status != http.StatusOK || info["cid"] != file {
+		t.Fatalf("GET /api/names/c.txt = %d %v, want cid %v", status, info, file)
+	}
+}
+
+func TestDAGUploadRejectsDataWithLinks(t *testing.T) {
+	router, _, _ := editServer(t)
+	leaf := merkledag.NewCID(merkledag.CodecRaw, []byte("leaf")).String()
+	upload := `{"root": "` + leaf + `", "nodes": [{"data": "ZGF0YQ==", "links": [{"name": "x", "hash": "` + leaf + `", "size": 4}]}]}`
+	if status, body := serveBody(t, router, http.MethodPost, "/api/upload/dag", upload); status != http.StatusBadRequest {
+		t.Fatalf("DAG upload of a node with data and links = %d %v, want %d", status, body, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,186 @@
+package car
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"ipfs-gin-example/pkg/merkledag"
+)
+
+// maxSectionSize bounds a single CAR section (header or block) read from untrusted input
+const maxSectionSize = 2 << 20 // 2MB, twice the largest chunk
+
+// carV2Pragma is the fixed prefix of a CARv2 file: a CARv1-style header { version: 2 }
+var carV2Pragma = []byte{0x0a, 0xa1, 0x67, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x02}
+
+// carV2HeaderSize is the size of the CARv2 header that follows the pragma
+const carV2HeaderSize = 40
+
+// Writer writes a CARv1 stream: a header naming the roots, then one section per block
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter writes the CARv1 header for roots to w and returns a Writer for the blocks
+func NewWriter(w io.Writer, roots []merkledag.CID) (*Writer, error) {
+	// dag-cbor map keys are sorted by length, so "roots" comes before "version"
+	var header []byte
+	header = appendCBORHead(header, cborMap, 2)
+	header = appendCBORText(header, "roots")
+	header = appendCBORHead(header, cborArray, uint64(len(roots)))
+	for _, root := range roots {
+		// CIDs in dag-cbor are tag 42 over the binary CID prefixed with the identity multibase
+		cidBytes := append([]byte{0x00}, root.Bytes()...)
+		header = appendCBORHead(header, cborTag, cborTagCID)
+		header = appendCBORHead(header, cborBytes, uint64(len(cidBytes)))
+		header = append(header, cidBytes...)
+	}
+	header = appendCBORText(header, "version")
+	header = appendCBORHead(header, cborUint, 1)
+
+	cw := &Writer{w: w}
+	if err := cw.writeSection(header); err != nil {
+		return nil, fmt.Errorf("failed to write CAR header: %w", err)
+	}
+	return cw, nil
+}
+
+// WriteBlock writes one block section
+func (cw *Writer) WriteBlock(c merkledag.CID, data []byte) error {
+	return cw.writeSection(c.Bytes(), data)
+}
+
+// writeSection writes a varint length prefix followed by parts
+func (cw *Writer) writeSection(parts ...[]byte) error {
+	var length int
+	for _, part := range parts {
+		length += len(part)
+	}
+	if _, err := cw.w.Write(binary.AppendUvarint(nil, uint64(length))); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if _, err := cw.w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reader reads blocks from a CARv1 stream, or from the CARv1 payload of a CARv2 file
+type Reader struct {
+	r     *bufio.Reader
+	Roots []merkledag.CID
+}
+
+// NewReader reads the CAR header from r
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	prefix, err := br.Peek(len(carV2Pragma))
+	if err == nil && bytes.Equal(prefix, carV2Pragma) {
+		payload, err := carV2Payload(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(payload)
+	}
+
+	cr := &Reader{r: br}
+	header, err := cr.readSection()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CAR header: %w", err)
+	}
+	if err := cr.parseHeader(header); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// carV2Payload skips the CARv2 pragma and header and returns a reader limited to the inner CARv1 data.
+// The index that may follow the data is not needed to import every block, so it is ignored.
+func carV2Payload(br *bufio.Reader) (io.Reader, error) {
+	if _, err := br.Discard(len(carV2Pragma)); err != nil {
+		return nil, err
+	}
+	header := make([]byte, carV2HeaderSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("failed to read CARv2 header: %w", err)
+	}
+	// 16 bytes of characteristics, then little-endian data offset, data size and index offset
+	dataOffset := binary.LittleEndian.Uint64(header[16:24])
+	dataSize := binary.LittleEndian.Uint64(header[24:32])
+
+	consumed := uint64(len(carV2Pragma) + carV2HeaderSize)
+	if dataOffset < consumed {
+		return nil, errors.New("invalid CARv2 data offset")
+	}
+	if _, err := br.Discard(int(dataOffset - consumed)); err != nil {
+		return nil, fmt.Errorf("failed to seek to CARv2 data: %w", err)
+	}
+	return io.LimitReader(br, int64(dataSize)), nil
+}
+
+// parseHeader decodes the dag-cbor header { roots: [CID], version: 1 }
+func (cr *Reader) parseHeader(header []byte) error {
+	d := &cborDecoder{data: header}
+	value, err := d.decode()
+	if err != nil {
+		return fmt.Errorf("invalid CAR header: %w", err)
+	}
+	entries, ok := value.(map[string]any)
+	if !ok {
+		return errors.New("invalid CAR header: not a map")
+	}
+	if version, _ := entries["version"].(uint64); version != 1 {
+		return fmt.Errorf("unsupported CAR version %v", entries["version"])
+	}
+
+	roots, _ := entries["roots"].([]any)
+	for _, root := range roots {
+		tagged, ok := root.(cborTagged)
+		cidBytes, isBytes := tagged.value.([]byte)
+		if !ok || tagged.tag != cborTagCID || !isBytes || len(cidBytes) == 0 || cidBytes[0] != 0x00 {
+			return errors.New("invalid CAR header: root is not a CID")
+		}
+		c, n, err := merkledag.DecodeCID(cidBytes[1:])
+		if err != nil || n != len(cidBytes)-1 {
+			return fmt.Errorf("invalid CAR root: %v", err)
+		}
+		cr.Roots = append(cr.Roots, c)
+	}
+	return nil
+}
+
+// Next returns the next block, or io.EOF at the end of the stream
+func (cr *Reader) Next() (merkledag.CID, []byte, error) {
+	section, err := cr.readSection()
+	if err != nil {
+		return merkledag.CID{}, nil, err
+	}
+	c, n, err := merkledag.DecodeCID(section)
+	if err != nil {
+		return merkledag.CID{}, nil, fmt.Errorf("invalid block CID: %w", err)
+	}
+	return c, section[n:], nil
+}
+
+// readSection reads one varint length-prefixed section
+func (cr *Reader) readSection() ([]byte, error) {
+	length, err := binary.ReadUvarint(cr.r)
+	if err != nil {
+		return nil, err // io.EOF at a section boundary is the end of the stream
+	}
+	if length == 0 || length > maxSectionSize {
+		return nil, fmt.Errorf("invalid CAR section length %d", length)
+	}
+	section := make([]byte, length)
+	if _, err := io.ReadFull(cr.r, section); err != nil {
+		return nil, fmt.Errorf("truncated CAR section: %w", err)
+	}
+	return section, nil
+}
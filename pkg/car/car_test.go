@@ -0,0 +1,198 @@
+package car_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"ipfs-gin-example/pkg/car"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/storage"
+)
+
+// buildDirectory stores a directory with two files sharing a subtree and returns its root
+func buildDirectory(t *testing.T, dag *merkledag.DAGBuilder) string {
+	t.Helper()
+	file, size, err := dag.BuildDAGFromReader(strings.NewReader(strings.Repeat("car round trip ", 20)), merkledag.NewChunker(16))
+	if err != nil {
+		t.Fatalf("BuildDAGFromReader: %v", err)
+	}
+	root, err := dag.PutNodeAtPath("", "/docs/a.txt", file, size)
+	if err != nil {
+		t.Fatalf("PutNodeAtPath: %v", err)
+	}
+	if root, err = dag.PutNodeAtPath(root, "/b.txt", file, size); err != nil {
+		t.Fatalf("PutNodeAtPath: %v", err)
+	}
+	return root
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, export := range []struct {
+		name string
+		fn   func(context.Context, io.Writer, *merkledag.DAGBuilder, string) error
+	}{{"v1", car.Export}, {"v2", car.ExportV2}} {
+		t.Run(export.name, func(t *testing.T) {
+			src := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+			root := buildDirectory(t, src)
+
+			var buf bytes.Buffer
+			if err := export.fn(context.Background(), &buf, src, root); err != nil {
+				t.Fatalf("export: %v", err)
+			}
+
+			dst := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+			result, err := car.Import(&buf, dst)
+			if err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			if len(result.Roots) != 1 || result.Roots[0] != root {
+				t.Fatalf("roots = %v, want [%s]", result.Roots, root)
+			}
+			complete, err := dst.HasDAG(context.Background(), root)
+			if err != nil || !complete {
+				t.Fatalf("HasDAG after import = %v, %v, want a complete DAG", complete, err)
+			}
+			for _, path := range []string{"/docs/a.txt", "/b.txt"} {
+				cid, err := dst.ResolvePath(root, path)
+				if err != nil {
+					t.Fatalf("ResolvePath(%s): %v", path, err)
+				}
+				data, err := dst.GetFileData(cid)
+				if err != nil || string(data) != strings.Repeat("car round trip ", 20) {
+					t.Fatalf("%s = %q, %v", path, data, err)
+				}
+			}
+
+			// Shared subtrees are written once
+			var again bytes.Buffer
+			if err := car.Export(context.Background(), &again, dst, root); err != nil {
+				t.Fatalf("Export: %v", err)
+			}
+			reader, err := car.NewReader(&again)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			blocks := 0
+			for {
+				if _, _, err := reader.Next(); errors.Is(err, io.EOF) {
+					break
+				} else if err != nil {
+					t.Fatalf("Next: %v", err)
+				}
+				blocks++
+			}
+			if blocks != result.Blocks {
+				t.Fatalf("re-export has %d blocks, import stored %d", blocks, result.Blocks)
+			}
+		})
+	}
+}
+
+func TestImportPartialDAG(t *testing.T) {
+	src := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+	root := buildDirectory(t, src)
+	rootCID, data, err := src.GetBlock(root)
+	if err != nil {
+		t.Fatalf("GetBlock: %v", err)
+	}
+
+	var buf bytes.Buffer
+	writer, err := car.NewWriter(&buf, []merkledag.CID{rootCID})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err := writer.WriteBlock(rootCID, data); err != nil {
+		t.Fatalf("WriteBlock: %v", err)
+	}
+
+	dst := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+	result, err := car.Import(&buf, dst)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Blocks != 1 {
+		t.Fatalf("imported %d blocks, want 1", result.Blocks)
+	}
+	complete, err := dst.HasDAG(context.Background(), root)
+	if err != nil || complete {
+		t.Fatalf("HasDAG of a partial import = %v, %v, want incomplete", complete, err)
+	}
+}
+
+func TestImportRejectsCorruptBlock(t *testing.T) {
+	src := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+	root := buildDirectory(t, src)
+	rootCID, data, err := src.GetBlock(root)
+	if err != nil {
+		t.Fatalf("GetBlock: %v", err)
+	}
+
+	var buf bytes.Buffer
+	writer, err := car.NewWriter(&buf, []merkledag.CID{rootCID})
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	corrupt := append([]byte{}, data...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	if err := writer.WriteBlock(rootCID, corrupt); err != nil {
+		t.Fatalf("WriteBlock: %v", err)
+	}
+
+	dst := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+	if _, err := car.Import(&buf, dst); err == nil {
+		t.Fatal("Import of a block not matching its CID succeeded")
+	}
+	if has, _ := dst.HasNode(root); has {
+		t.Fatal("corrupt block was stored")
+	}
+}
+
+// The header is dag-cbor; root counts cross the CBOR argument widths
+func TestHeaderRoots(t *testing.T) {
+	for _, count := range []int{0, 1, 23, 24, 255, 256} {
+		t.Run(fmt.Sprint(count), func(t *testing.T) {
+			roots := make([]merkledag.CID, count)
+			for i := range roots {
+				roots[i] = merkledag.NewCID(merkledag.CodecRaw, []byte(fmt.Sprint(i)))
+			}
+			var buf bytes.Buffer
+			if _, err := car.NewWriter(&buf, roots); err != nil {
+				t.Fatalf("NewWriter: %v", err)
+			}
+			reader, err := car.NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			if len(reader.Roots) != count {
+				t.Fatalf("read %d roots, want %d", len(reader.Roots), count)
+			}
+			for i, root := range reader.Roots {
+				if root.String() != roots[i].String() {
+					t.Fatalf("root %d = %s, want %s", i, root, roots[i])
+				}
+			}
+		})
+	}
+}
+
+func TestHeaderRejectsMalformedCBOR(t *testing.T) {
+	for name, header := range map[string][]byte{
+		"not a map":       {0x01},
+		"truncated":       {0xa2, 0x65, 'r', 'o'},
+		"version 3":       {0xa1, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x03},
+		"nested too deep": append(bytes.Repeat([]byte{0x81}, 64), 0x00),
+		"root not a CID":  {0xa2, 0x65, 'r', 'o', 'o', 't', 's', 0x81, 0x01, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x01},
+	} {
+		t.Run(name, func(t *testing.T) {
+			section := append([]byte{byte(len(header))}, header...)
+			if _, err := car.NewReader(bytes.NewReader(section)); err == nil {
+				t.Fatal("NewReader accepted a malformed header")
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package car
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The CAR header is a small dag-cbor map. Only the subset of CBOR needed to
+// write and read it is implemented here.
+
+// CBOR major types
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborMap   = 5
+	cborTag   = 6
+)
+
+// cborTagCID is the CBOR tag dag-cbor uses for CIDs
+const cborTagCID = 42
+
+// appendCBORHead appends a CBOR item head with the shortest argument encoding, as dag-cbor requires
+func appendCBORHead(buf []byte, major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return append(buf, major<<5|byte(arg))
+	case arg <= 0xff:
+		return append(buf, major<<5|24, byte(arg))
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(buf, major<<5|25), uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(buf, major<<5|26), uint32(arg))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, major<<5|27), arg)
+}
+
+// appendCBORText appends a text string
+func appendCBORText(buf []byte, s string) []byte {
+	return append(appendCBORHead(buf, cborText, uint64(len(s))), s...)
+}
+
+// cborTagged is a decoded tagged CBOR item
+type cborTagged struct {
+	tag   uint64
+	value any
+}
+
+// cborDecoder decodes CBOR items into uint64, []byte, string, []any, map[string]any and cborTagged
+type cborDecoder struct {
+	data  []byte
+	depth int
+}
+
+// maxCBORDepth bounds nesting so malformed headers cannot exhaust the stack
+const maxCBORDepth = 16
+
+// readHead reads the head of the next item
+func (d *cborDecoder) readHead() (byte, uint64, error) {
+	if len(d.data) == 0 {
+		return 0, 0, errors.New("unexpected end of CBOR data")
+	}
+	major, info := d.data[0]>>5, d.data[0]&0x1f
+	d.data = d.data[1:]
+
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, fmt.Errorf("unsupported CBOR additional info %d", info)
+	}
+	if len(d.data) < size {
+		return 0, 0, errors.New("unexpected end of CBOR data")
+	}
+	var arg uint64
+	for _, b := range d.data[:size] {
+		arg = arg<<8 | uint64(b)
+	}
+	d.data = d.data[size:]
+	return major, arg, nil
+}
+
+// decode decodes the next item
+func (d *cborDecoder) decode() (any, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxCBORDepth {
+		return nil, errors.New("CBOR data nested too deeply")
+	}
+
+	major, arg, err := d.readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case cborUint:
+		return arg, nil
+	case cborBytes, cborText:
+		if arg > uint64(len(d.data)) {
+			return nil, errors.New("unexpected end of CBOR data")
+		}
+		value := d.data[:arg]
+		d.data = d.data[arg:]
+		if major == cborText {
+			return string(value), nil
+		}
+		return append([]byte{}, value...), nil
+	case cborArray:
+		if arg > uint64(len(d.data)) {
+			return nil, errors.New("CBOR array longer than data")
+		}
+		items := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case cborMap:
+		if arg > uint64(len(d.data)) {
+			return nil, errors.New("CBOR map longer than data")
+		}
+		entries := make(map[string]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, errors.New("CBOR map key is not a string")
+			}
+			value, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			entries[keyString] = value
+		}
+		return entries, nil
+	case cborTag:
+		value, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		return cborTagged{tag: arg, value: value}, nil
+	}
+	return nil, fmt.Errorf("unsupported CBOR major type %d", major)
+}
@@ -0,0 +1,169 @@
+package car
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"ipfs-gin-example/pkg/merkledag"
+)
+
+// multihashIndexSorted is the multicodec of the CARv2 index format written by Export
+const multihashIndexSorted = 0x0401
+
+// sha256Code is the multihash code of sha2-256, the only hash CIDs here use
+const sha256Code = 0x12
+
+// walkDAG visits every block of the DAG rooted at rootCID once, parents before children
+// and children in link order, which is the order CAR consumers expect.
+func walkDAG(ctx context.Context, dag *merkledag.DAGBuilder, rootCID string, visit func(c merkledag.CID, data []byte) error) error {
+	seen := make(map[string]bool)
+	stack := []string{rootCID}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cid := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		c, err := merkledag.ParseCID(cid)
+		if err != nil {
+			return err
+		}
+		if seen[c.String()] {
+			continue // Shared subtree, already written
+		}
+		seen[c.String()] = true
+
+		c, data, err := dag.GetBlock(cid)
+		if err != nil {
+			return err
+		}
+		if err := visit(c, data); err != nil {
+			return err
+		}
+		if c.Codec == merkledag.CodecRaw {
+			continue // Raw leaves have no links
+		}
+
+		node, err := merkledag.DecodeNode(c, data)
+		if err != nil {
+			return fmt.Errorf("failed to decode node %s: %w", cid, err)
+		}
+		for i := len(node.Links) - 1; i >= 0; i-- {
+			stack = append(stack, node.Links[i].Hash)
+		}
+	}
+	return nil
+}
+
+// Export writes the DAG rooted at rootCID to w as a CARv1 stream
+func Export(ctx context.Context, w io.Writer, dag *merkledag.DAGBuilder, rootCID string) error {
+	root, err := merkledag.ParseCID(rootCID)
+	if err != nil {
+		return err
+	}
+	cw, err := NewWriter(w, []merkledag.CID{root})
+	if err != nil {
+		return err
+	}
+	return walkDAG(ctx, dag, rootCID, cw.WriteBlock)
+}
+
+// indexEntry locates a block section within the CARv1 payload of a CARv2 file
+type indexEntry struct {
+	digest []byte
+	offset uint64
+}
+
+// ExportV2 writes the DAG rooted at rootCID to w as a CARv2 file with a multihash-sorted index.
+// The header records the payload size, so the CARv1 payload is spooled to a temporary file first.
+func ExportV2(ctx context.Context, w io.Writer, dag *merkledag.DAGBuilder, rootCID string) error {
+	root, err := merkledag.ParseCID(rootCID)
+	if err != nil {
+		return err
+	}
+
+	payload, err := os.CreateTemp("", "car-export-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(payload.Name())
+	defer payload.Close()
+
+	counter := &countingWriter{w: payload}
+	cw, err := NewWriter(counter, []merkledag.CID{root})
+	if err != nil {
+		return err
+	}
+	var entries []indexEntry
+	err = walkDAG(ctx, dag, rootCID, func(c merkledag.CID, data []byte) error {
+		entries = append(entries, indexEntry{digest: c.Digest, offset: counter.n})
+		return cw.WriteBlock(c, data)
+	})
+	if err != nil {
+		return err
+	}
+
+	dataOffset := uint64(len(carV2Pragma) + carV2HeaderSize)
+	header := make([]byte, 16, carV2HeaderSize) // Characteristics: none set
+	header = binary.LittleEndian.AppendUint64(header, dataOffset)
+	header = binary.LittleEndian.AppendUint64(header, counter.n)
+	header = binary.LittleEndian.AppendUint64(header, dataOffset+counter.n)
+
+	if _, err := w.Write(carV2Pragma); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := payload.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind temporary file: %w", err)
+	}
+	if _, err := io.Copy(w, payload); err != nil {
+		return err
+	}
+	_, err = w.Write(encodeIndex(entries))
+	return err
+}
+
+// encodeIndex encodes entries in the MultihashIndexSorted format: the index codec, then one
+// sorted bucket of fixed-width (digest, offset) records per multihash code and digest width.
+func encodeIndex(entries []indexEntry) []byte {
+	sort.Slice(entries, func(i, j int) bool {
+		return string(entries[i].digest) < string(entries[j].digest)
+	})
+
+	width := uint32(0)
+	if len(entries) > 0 {
+		width = uint32(len(entries[0].digest)) + 8
+	}
+
+	buf := binary.AppendUvarint(nil, multihashIndexSorted)
+	buf = binary.LittleEndian.AppendUint32(buf, 1) // One multihash code
+	buf = binary.LittleEndian.AppendUint64(buf, sha256Code)
+	buf = binary.LittleEndian.AppendUint32(buf, 1) // One digest width
+	buf = binary.LittleEndian.AppendUint32(buf, width)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(entries))*uint64(width))
+	for _, entry := range entries {
+		buf = append(buf, entry.digest...)
+		buf = binary.LittleEndian.AppendUint64(buf, entry.offset)
+	}
+	return buf
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+// Write implements io.Writer
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += uint64(n)
+	return n, err
+}
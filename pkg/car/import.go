@@ -0,0 +1,48 @@
+package car
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"ipfs-gin-example/pkg/merkledag"
+)
+
+// ImportResult describes an imported CAR file
+type ImportResult struct {
+	Roots  []string `json:"roots"`
+	Blocks int      `json:"blocks"`
+}
+
+// Import reads a CARv1 or CARv2 file from r and stores its blocks. Every block is verified against
+// its CID and must use a codec the DAG can read; the import stops at the first bad block.
+// Blocks stored before the failure are left for garbage collection.
+func Import(r io.Reader, dag *merkledag.DAGBuilder) (*ImportResult, error) {
+	cr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{Roots: make([]string, 0, len(cr.Roots))}
+	for _, root := range cr.Roots {
+		result.Roots = append(result.Roots, root.String())
+	}
+
+	for {
+		c, data, err := cr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read block %d: %w", result.Blocks, err)
+		}
+		if _, err := merkledag.DecodeNode(c, data); err != nil {
+			return result, fmt.Errorf("unsupported block %s: %w", c, err)
+		}
+		if err := dag.PutBlock(c, data); err != nil {
+			return result, err
+		}
+		result.Blocks++
+	}
+	return result, nil
+}
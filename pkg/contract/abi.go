@@ -175,10 +175,15 @@ const abiJSON = `[
     }
   ]`
 
+// parseABI parses the contract ABI.
+func parseABI() (abi.ABI, error) {
+	return abi.JSON(strings.NewReader(abiJSON))
+}
+
 // NewDecentralizedNamingSystem creates a new instance of the contract binding.
 func NewDecentralizedNamingSystem(address common.Address, backend bind.ContractBackend) (*DecentralizedNamingSystem, error) {
 	// Parse the ABI
-	parsedABI, err := abi.JSON(strings.NewReader(abiJSON))
+	parsedABI, err := parseABI()
 	if err != nil {
 		return nil, err
 	}
@@ -188,6 +193,20 @@ func NewDecentralizedNamingSystem(address common.Address, backend bind.ContractB
 	return &DecentralizedNamingSystem{BoundContract: contract}, nil
 }
 
+// DeployDecentralizedNamingSystem deploys the contract from its creation bytecode and returns a binding to it.
+func DeployDecentralizedNamingSystem(auth *bind.TransactOpts, backend bind.ContractBackend, bytecode []byte) (common.Address, *types.Transaction, *DecentralizedNamingSystem, error) {
+	parsedABI, err := parseABI()
+	if err != nil {
+		return common.Address{}, nil, nil, err
+	}
+
+	address, tx, contract, err := bind.DeployContract(auth, parsedABI, bytecode, backend)
+	if err != nil {
+		return common.Address{}, nil, nil, err
+	}
+	return address, tx, &DecentralizedNamingSystem{BoundContract: contract}, nil
+}
+
 // Register calls the register function on the contract.
 func (c *DecentralizedNamingSystem) Register(opts *bind.TransactOpts, name, cid string) (*types.Transaction, error) {
 	return c.Transact(opts, "register", name, cid)
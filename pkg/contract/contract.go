@@ -2,15 +2,33 @@ package contract
 
 import (
 	"context"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
+// Backend is the chain access a Client needs. *ethclient.Client and the client of
+// go-ethereum's simulated backend both implement it.
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+	ChainID(ctx context.Context) (*big.Int, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error)
+}
+
 // Client manages interactions with the DecentralizedNamingSystem smart contract.
+// Every transaction it sends gets its nonce from a NonceManager shared by all callers.
 type Client struct {
-	client   *ethclient.Client
+	client   Backend
 	contract *DecentralizedNamingSystem
+	address  common.Address
+	abi      abi.ABI
+	nonces   *NonceManager
 }
 
 // NewClient initializes a new contract client.
@@ -21,58 +39,101 @@ func NewClient(rpcURL, contractAddress string) (*Client, error) {
 		return nil, err
 	}
 
-	// Initialize contract instance
-	contract, err := NewDecentralizedNamingSystem(common.HexToAddress(contractAddress), client)
+	contractClient, err := NewClientWithBackend(client, common.HexToAddress(contractAddress))
 	if err != nil {
 		client.Close()
 		return nil, err
 	}
+	return contractClient, nil
+}
+
+// NewClientWithBackend initializes a contract client on an existing backend.
+func NewClientWithBackend(backend Backend, contractAddress common.Address) (*Client, error) {
+	// Initialize contract instance
+	contract, err := NewDecentralizedNamingSystem(contractAddress, backend)
+	if err != nil {
+		return nil, err
+	}
+	parsedABI, err := parseABI()
+	if err != nil {
+		return nil, err
+	}
 
 	return &Client{
-		client:   client,
+		client:   backend,
 		contract: contract,
+		address:  contractAddress,
+		abi:      parsedABI,
+		nonces:   NewNonceManager(backend),
 	}, nil
 }
 
-// Close closes the Ethereum client connection.
+// Close closes the Ethereum client connection, if the backend has one.
 func (c *Client) Close() {
-	c.client.Close()
+	if closer, ok := c.client.(interface{ Close() }); ok {
+		closer.Close()
+	}
 }
 
 // RegisterName registers a name and CID in the smart contract.
 func (c *Client) RegisterName(auth *bind.TransactOpts, name, cid string) error {
-	tx, err := c.contract.Register(auth, name, cid)
+	tx, err := c.nonces.Send(auth, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.contract.Register(opts, name, cid)
+	})
 	if err != nil {
 		return err
 	}
 	// Wait for transaction to be mined
-	_, err = bind.WaitMined(context.Background(), c.client, tx)
-	return err
+	return c.waitMined(auth, tx)
 }
 
-// ResolveCID resolves a name to its CID.
+// ResolveCID resolves a name to its CID. Unregistered names resolve to "".
 func (c *Client) ResolveCID(name string) (string, error) {
-	return c.contract.ResolveCID(&bind.CallOpts{}, name)
+	cid, err := c.contract.ResolveCID(&bind.CallOpts{}, name)
+	if err != nil && strings.Contains(err.Error(), "Name not registered") {
+		// The contract reverts instead of returning an empty CID
+		return "", nil
+	}
+	return cid, err
 }
 
 // UpdateCID updates the CID for a name in the smart contract.
 func (c *Client) UpdateCID(auth *bind.TransactOpts, name, newCID string) error {
-	tx, err := c.contract.UpdateCID(auth, name, newCID)
+	tx, err := c.nonces.Send(auth, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.contract.UpdateCID(opts, name, newCID)
+	})
 	if err != nil {
 		return err
 	}
-	_, err = bind.WaitMined(context.Background(), c.client, tx)
-	return err
+	return c.waitMined(auth, tx)
 }
 
 // TransferOwnership transfers ownership of a name to another address.
 func (c *Client) TransferOwnership(auth *bind.TransactOpts, name string, newOwner common.Address) error {
-	tx, err := c.contract.TransferOwnership(auth, name, newOwner)
+	tx, err := c.nonces.Send(auth, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.contract.TransferOwnership(opts, name, newOwner)
+	})
 	if err != nil {
 		return err
 	}
-	_, err = bind.WaitMined(context.Background(), c.client, tx)
-	return err
+	return c.waitMined(auth, tx)
+}
+
+// waitMined waits until tx is mined and succeeded. It stops waiting when auth.Context is done;
+// without a context it waits until the transaction is mined.
+func (c *Client) waitMined(auth *bind.TransactOpts, tx *types.Transaction) error {
+	ctx := auth.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	receipt, err := bind.WaitMined(ctx, c.client, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return ErrTxReverted
+	}
+	return nil
 }
 
 // GetOwner retrieves the owner of a name.
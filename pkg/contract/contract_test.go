@@ -0,0 +1,142 @@
+package contract_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"ipfs-gin-example/pkg/contract"
+	"ipfs-gin-example/pkg/contract/contracttest"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	cidA = "bafkreifhfgbgpbk3tj6jnkd5vhl67jnbnclsxqrpmo3zk4qqe7gel2tfta"
+	cidB = "bafkreidd3lbo3mrsutwru2tib4h6d3ivi73nb4ss74lkoi63jiq5vhxc5y"
+)
+
+func TestRegisterName(t *testing.T) {
+	chain := contracttest.New(t, 2)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+
+	if err := chain.Client.RegisterName(alice, "example.com", cidA); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+
+	cid, err := chain.Client.ResolveCID("example.com")
+	if err != nil || cid != cidA {
+		t.Fatalf("ResolveCID = %q, %v; want %q", cid, err, cidA)
+	}
+	owner, err := chain.Client.GetOwner("example.com")
+	if err != nil || owner != alice.From {
+		t.Fatalf("GetOwner = %s, %v; want %s", owner, err, alice.From)
+	}
+
+	err = chain.Client.RegisterName(bob, "example.com", cidB)
+	if err == nil || !strings.Contains(err.Error(), "Name already registered") {
+		t.Fatalf("registering a taken name: got %v, want revert", err)
+	}
+}
+
+func TestUnregisteredName(t *testing.T) {
+	chain := contracttest.New(t, 1)
+
+	cid, err := chain.Client.ResolveCID("missing.com")
+	if err != nil || cid != "" {
+		t.Fatalf("ResolveCID = %q, %v; want empty", cid, err)
+	}
+	owner, err := chain.Client.GetOwner("missing.com")
+	if err != nil || owner != (common.Address{}) {
+		t.Fatalf("GetOwner = %s, %v; want zero address", owner, err)
+	}
+}
+
+func TestUpdateCID(t *testing.T) {
+	chain := contracttest.New(t, 2)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+
+	if err := chain.Client.RegisterName(alice, "example.com", cidA); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+	if err := chain.Client.UpdateCID(alice, "example.com", cidB); err != nil {
+		t.Fatalf("UpdateCID: %v", err)
+	}
+	if cid, _ := chain.Client.ResolveCID("example.com"); cid != cidB {
+		t.Fatalf("ResolveCID = %q, want %q", cid, cidB)
+	}
+
+	err := chain.Client.UpdateCID(bob, "example.com", cidA)
+	if err == nil || !strings.Contains(err.Error(), "Not the owner of this name") {
+		t.Fatalf("update by non-owner: got %v, want revert", err)
+	}
+	if cid, _ := chain.Client.ResolveCID("example.com"); cid != cidB {
+		t.Fatalf("ResolveCID after rejected update = %q, want %q", cid, cidB)
+	}
+}
+
+func TestTransferOwnership(t *testing.T) {
+	chain := contracttest.New(t, 2)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+
+	if err := chain.Client.RegisterName(alice, "example.com", cidA); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+
+	err := chain.Client.TransferOwnership(alice, "example.com", common.Address{})
+	if err == nil || !strings.Contains(err.Error(), "New owner is zero address") {
+		t.Fatalf("transfer to zero address: got %v, want revert", err)
+	}
+	err = chain.Client.TransferOwnership(bob, "example.com", bob.From)
+	if err == nil || !strings.Contains(err.Error(), "Not the owner of this name") {
+		t.Fatalf("transfer by non-owner: got %v, want revert", err)
+	}
+
+	if err := chain.Client.TransferOwnership(alice, "example.com", bob.From); err != nil {
+		t.Fatalf("TransferOwnership: %v", err)
+	}
+	if owner, _ := chain.Client.GetOwner("example.com"); owner != bob.From {
+		t.Fatalf("GetOwner = %s, want %s", owner, bob.From)
+	}
+	if err := chain.Client.UpdateCID(bob, "example.com", cidB); err != nil {
+		t.Fatalf("UpdateCID by new owner: %v", err)
+	}
+	if err := chain.Client.UpdateCID(alice, "example.com", cidA); err == nil {
+		t.Fatal("UpdateCID by previous owner succeeded")
+	}
+}
+
+func TestRelaySignedTx(t *testing.T) {
+	chain := contracttest.New(t, 2)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+	ctx := context.Background()
+
+	tx, err := chain.Client.PrepareTx(ctx, alice.From, contract.MethodRegister, "example.com", cidA)
+	if err != nil {
+		t.Fatalf("PrepareTx: %v", err)
+	}
+	signed, err := alice.Signer(alice.From, tx)
+	if err != nil {
+		t.Fatalf("signing: %v", err)
+	}
+	if _, err := chain.Client.SendSignedTx(ctx, signed); err != nil {
+		t.Fatalf("SendSignedTx: %v", err)
+	}
+	if owner, _ := chain.Client.GetOwner("example.com"); owner != alice.From {
+		t.Fatalf("GetOwner = %s, want %s", owner, alice.From)
+	}
+
+	// The contract would reject the call, so it cannot be prepared
+	if _, err := chain.Client.PrepareTx(ctx, bob.From, contract.MethodUpdateCID, "example.com", cidB); err == nil {
+		t.Fatal("PrepareTx for a non-owner succeeded")
+	}
+	// Only calls to the naming contract are relayed
+	other := types.NewTx(&types.DynamicFeeTx{ChainID: tx.ChainId(), Nonce: 1, Gas: 21000, GasFeeCap: tx.GasFeeCap(), To: &bob.From})
+	if signed, err = alice.Signer(alice.From, other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.Client.SendSignedTx(ctx, signed); err == nil {
+		t.Fatal("SendSignedTx relayed a transaction to another address")
+	}
+}
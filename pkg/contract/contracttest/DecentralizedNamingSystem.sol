@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.0;
+
+contract DecentralizedNamingSystem {
+    struct Record {
+        string cid;
+        address owner;
+    }
+
+    mapping(string => Record) private records;
+
+    event NameRegistered(string indexed name, address indexed owner);
+    event CIDUpdated(string indexed name, string cid);
+    event OwnershipTransferred(string indexed name, address indexed oldOwner, address indexed newOwner);
+
+    modifier onlyOwner(string memory name) {
+        require(records[name].owner == msg.sender, "Not the owner of this name");
+        _;
+    }
+
+    function register(string calldata name, string calldata cid) external {
+        require(records[name].owner == address(0), "Name already registered");
+        records[name] = Record({cid: cid, owner: msg.sender});
+        emit NameRegistered(name, msg.sender);
+    }
+
+    function updateCID(string calldata name, string calldata newCID) external onlyOwner(name) {
+        records[name] = Record({cid: newCID, owner: msg.sender});
+        emit CIDUpdated(name, newCID);
+    }
+
+    function transferOwnership(string calldata name, address newOwner) external onlyOwner(name) {
+        require(newOwner != address(0), "New owner is zero address");
+        address oldOwner = records[name].owner;
+        records[name].owner = newOwner;
+        emit OwnershipTransferred(name, oldOwner, newOwner);
+    }
+
+    function resolveCID(string calldata name) external view returns (string memory) {
+        require(records[name].owner != address(0), "Name not registered");
+        return records[name].cid;
+    }
+
+    function getOwner(string calldata name) external view returns (address) {
+        return records[name].owner;
+    }
+}
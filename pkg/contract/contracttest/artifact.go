@@ -0,0 +1,77 @@
+package contracttest
+
+import (
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// artifactName is the compiled contract looked up in testdata
+const artifactName = "testdata/DecentralizedNamingSystem.json"
+
+//go:embed testdata
+var testdata embed.FS
+
+// Bytecode returns the creation code of the DecentralizedNamingSystem contract: solc's output
+// from the artifact CONTRACT_ARTIFACT names or testdata/DecentralizedNamingSystem.json, or the
+// assembly transcription of DecentralizedNamingSystem.sol when neither exists.
+func Bytecode() ([]byte, error) {
+	code, _, err := bytecode()
+	return code, err
+}
+
+// bytecode returns the creation code and whether it was compiled by solc
+func bytecode() ([]byte, bool, error) {
+	var data []byte
+	var err error
+	if path := os.Getenv("CONTRACT_ARTIFACT"); path != "" {
+		data, err = os.ReadFile(path)
+	} else {
+		data, err = testdata.ReadFile(artifactName)
+		if errors.Is(err, fs.ErrNotExist) {
+			code, err := assembledBytecode()
+			return code, false, err
+		}
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read contract artifact: %w", err)
+	}
+	code, err := parseArtifact(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return code, true, nil
+}
+
+// parseArtifact extracts the creation code from a truffle or hardhat artifact, or from
+// solc --combined-json output
+func parseArtifact(data []byte) ([]byte, error) {
+	var artifact struct {
+		Bytecode  string `json:"bytecode"`
+		Contracts map[string]struct {
+			Bin string `json:"bin"`
+		} `json:"contracts"`
+	}
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return nil, fmt.Errorf("failed to parse contract artifact: %w", err)
+	}
+	bin := artifact.Bytecode
+	for name, contract := range artifact.Contracts {
+		if strings.HasSuffix(name, ":DecentralizedNamingSystem") {
+			bin = contract.Bin
+		}
+	}
+	if strings.TrimPrefix(bin, "0x") == "" {
+		return nil, errors.New("contract artifact has no DecentralizedNamingSystem bytecode")
+	}
+	code, err := hex.DecodeString(strings.TrimPrefix(bin, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode contract bytecode: %w", err)
+	}
+	return code, nil
+}
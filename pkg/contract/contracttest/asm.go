@@ -0,0 +1,83 @@
+package contracttest
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// assembler builds EVM bytecode. Jump targets are named labels that may be referenced
+// before they are defined; they are pushed as PUSH2 and patched by bytes.
+type assembler struct {
+	code   []byte
+	labels map[string]int
+	refs   map[int]string // Offset of a PUSH2 argument -> label it refers to
+}
+
+func newAssembler() *assembler {
+	return &assembler{labels: make(map[string]int), refs: make(map[int]string)}
+}
+
+// op appends opcodes
+func (a *assembler) op(ops ...vm.OpCode) *assembler {
+	for _, op := range ops {
+		a.code = append(a.code, byte(op))
+	}
+	return a
+}
+
+// push appends the shortest PUSH of v
+func (a *assembler) push(v uint64) *assembler {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	if len(b) == 0 {
+		b = []byte{0}
+	}
+	return a.pushBytes(b)
+}
+
+// pushBytes appends a PUSHn of b, 1 <= len(b) <= 32
+func (a *assembler) pushBytes(b []byte) *assembler {
+	a.code = append(a.code, byte(vm.PUSH1)+byte(len(b)-1))
+	a.code = append(a.code, b...)
+	return a
+}
+
+// pushLabel appends a PUSH2 of the offset of label
+func (a *assembler) pushLabel(label string) *assembler {
+	a.code = append(a.code, byte(vm.PUSH2))
+	a.refs[len(a.code)] = label
+	a.code = append(a.code, 0, 0)
+	return a
+}
+
+// label defines label at the current offset
+func (a *assembler) label(label string) *assembler {
+	a.labels[label] = len(a.code)
+	return a.op(vm.JUMPDEST)
+}
+
+// jump jumps to label
+func (a *assembler) jump(label string) *assembler {
+	return a.pushLabel(label).op(vm.JUMP)
+}
+
+// jumpi pops a condition and jumps to label if it is non-zero
+func (a *assembler) jumpi(label string) *assembler {
+	return a.pushLabel(label).op(vm.JUMPI)
+}
+
+// bytes resolves label references and returns the code
+func (a *assembler) bytes() ([]byte, error) {
+	code := append([]byte{}, a.code...)
+	for offset, label := range a.refs {
+		target, ok := a.labels[label]
+		if !ok {
+			return nil, fmt.Errorf("undefined label %q", label)
+		}
+		code[offset], code[offset+1] = byte(target>>8), byte(target)
+	}
+	return code, nil
+}
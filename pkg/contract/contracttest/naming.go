@@ -0,0 +1,192 @@
+package contracttest
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Memory used by the contract code
+const (
+	memArg    = 0x80 // String arguments are copied here
+	memResult = 0x80 // ABI-encoded string results and event data start here
+)
+
+// assembledBytecode returns the creation code of DecentralizedNamingSystem.sol transcribed
+// to EVM assembly, used when no compiled artifact is available: the same ABI, ownership
+// checks, revert reasons and events. Only the private storage layout differs from solc's
+// output: a name's owner is stored at keccak256(name), its CID length at the next slot and
+// the CID bytes from keccak256(that slot) on.
+func assembledBytecode() ([]byte, error) {
+	runtime, err := namingRuntime()
+	if err != nil {
+		return nil, err
+	}
+	if len(runtime) > 0xffff {
+		return nil, fmt.Errorf("runtime code too large: %d bytes", len(runtime))
+	}
+
+	// Copy the runtime code that follows this 13-byte prefix into memory and return it
+	a := newAssembler()
+	size := []byte{byte(len(runtime) >> 8), byte(len(runtime))}
+	a.pushBytes(size).op(vm.DUP1).pushBytes([]byte{0, 13}).push(0).op(vm.CODECOPY)
+	a.push(0).op(vm.RETURN)
+	init, err := a.bytes()
+	if err != nil {
+		return nil, err
+	}
+	return append(init, runtime...), nil
+}
+
+// namingRuntime assembles the deployed contract code
+func namingRuntime() ([]byte, error) {
+	a := newAssembler()
+
+	// Functions are not payable
+	a.op(vm.CALLVALUE).jumpi("revert")
+
+	// Dispatch on the function selector
+	a.push(0).op(vm.CALLDATALOAD).push(0xe0).op(vm.SHR)
+	for _, fn := range []string{
+		"register(string,string)",
+		"updateCID(string,string)",
+		"transferOwnership(string,address)",
+		"resolveCID(string)",
+		"getOwner(string)",
+	} {
+		a.op(vm.DUP1).pushBytes(crypto.Keccak256([]byte(fn))[:4]).op(vm.EQ).jumpi(fn)
+	}
+	a.label("revert").push(0).op(vm.DUP1).op(vm.REVERT)
+
+	// register(name, cid): require no owner, then record the caller and the CID
+	a.label("register(string,string)").op(vm.POP)
+	hashName(a)
+	a.op(vm.DUP1, vm.SLOAD).jumpi("errTaken")
+	a.op(vm.CALLER, vm.DUP2, vm.SSTORE)
+	storeCID(a, "register")
+	a.op(vm.CALLER, vm.DUP2).pushBytes(eventTopic("NameRegistered(string,address)")).push(0).push(0).op(vm.LOG3)
+	a.op(vm.STOP)
+
+	// updateCID(name, newCID): only the owner
+	a.label("updateCID(string,string)").op(vm.POP)
+	hashName(a)
+	requireOwner(a)
+	storeCID(a, "updateCID")
+	loadString(a, 1, memResult+0x40)
+	encodeString(a)
+	a.op(vm.DUP2, vm.SWAP1).pushBytes(eventTopic("CIDUpdated(string,string)")).op(vm.SWAP1).push(memResult).op(vm.LOG2)
+	a.op(vm.STOP)
+
+	// transferOwnership(name, newOwner): only the owner, never to the zero address
+	a.label("transferOwnership(string,address)").op(vm.POP)
+	hashName(a)
+	requireOwner(a)
+	a.push(36).op(vm.CALLDATALOAD)
+	a.op(vm.DUP1, vm.DUP1).pushBytes(addressMask()).op(vm.AND, vm.EQ, vm.ISZERO).jumpi("revert")
+	a.op(vm.DUP1, vm.ISZERO).jumpi("errZeroOwner")
+	a.op(vm.DUP1, vm.DUP3, vm.SSTORE)
+	a.op(vm.DUP1, vm.CALLER, vm.DUP4).pushBytes(eventTopic("OwnershipTransferred(string,address,address)")).push(0).push(0).op(vm.LOG4)
+	a.op(vm.STOP)
+
+	// resolveCID(name): reverts for unregistered names
+	a.label("resolveCID(string)").op(vm.POP)
+	hashName(a)
+	a.op(vm.DUP1, vm.SLOAD, vm.ISZERO).jumpi("errNotRegistered")
+	a.op(vm.DUP1).push(1).op(vm.ADD)            // key slot
+	a.op(vm.DUP1, vm.SLOAD)                     // key slot len
+	a.op(vm.SWAP1).push(0).op(vm.MSTORE)        // key len
+	a.push(32).push(0).op(vm.KECCAK256).push(0) // key len base i
+	a.label("resolveLoop")
+	a.op(vm.DUP1).push(5).op(vm.SHL) // key len base i off
+	a.op(vm.DUP4, vm.DUP2, vm.LT, vm.ISZERO).jumpi("resolveDone")
+	a.op(vm.DUP3, vm.DUP3, vm.ADD, vm.SLOAD) // key len base i off word
+	a.op(vm.SWAP1).push(memResult+0x40).op(vm.ADD, vm.MSTORE)
+	a.push(1).op(vm.ADD).jump("resolveLoop")
+	a.label("resolveDone").op(vm.POP, vm.POP, vm.POP) // key len
+	encodeString(a)
+	a.push(memResult).op(vm.RETURN)
+
+	// getOwner(name): the zero address for unregistered names
+	a.label("getOwner(string)").op(vm.POP)
+	hashName(a)
+	a.op(vm.SLOAD).push(0).op(vm.MSTORE)
+	a.push(32).push(0).op(vm.RETURN)
+
+	revertWith(a, "errTaken", "Name already registered")
+	revertWith(a, "errNotOwner", "Not the owner of this name")
+	revertWith(a, "errZeroOwner", "New owner is zero address")
+	revertWith(a, "errNotRegistered", "Name not registered")
+
+	return a.bytes()
+}
+
+// loadString copies string argument arg to memory at dest, zeroes the word after it
+// and leaves its length on the stack
+func loadString(a *assembler, arg, dest uint64) {
+	a.push(4 + 32*arg).op(vm.CALLDATALOAD).push(4).op(vm.ADD) // pos
+	a.op(vm.DUP1, vm.CALLDATALOAD)                            // pos len
+	a.op(vm.SWAP1).push(32).op(vm.ADD)                        // len src
+	a.op(vm.DUP2, vm.SWAP1).push(dest).op(vm.CALLDATACOPY)    // len
+	a.push(0).op(vm.DUP2).push(dest).op(vm.ADD, vm.MSTORE)    // len
+}
+
+// hashName leaves keccak256 of the name argument on the stack. It is both the
+// name's storage key and the indexed event topic Solidity emits for it.
+func hashName(a *assembler) {
+	loadString(a, 0, memArg)
+	a.push(memArg).op(vm.KECCAK256)
+}
+
+// requireOwner reverts unless the caller owns the name whose key is on the stack
+func requireOwner(a *assembler) {
+	a.op(vm.DUP1, vm.SLOAD, vm.CALLER, vm.EQ, vm.ISZERO).jumpi("errNotOwner")
+}
+
+// storeCID stores the CID argument for the name whose key is on the stack
+func storeCID(a *assembler, fn string) {
+	loop, end := fn+"StoreLoop", fn+"StoreDone"
+	loadString(a, 1, memArg)                             // key len
+	a.op(vm.DUP1, vm.DUP3).push(1).op(vm.ADD, vm.SSTORE) // key len
+	a.op(vm.DUP2).push(1).op(vm.ADD).push(0).op(vm.MSTORE)
+	a.push(32).push(0).op(vm.KECCAK256).push(0) // key len base i
+	a.label(loop)
+	a.op(vm.DUP1).push(5).op(vm.SHL) // key len base i off
+	a.op(vm.DUP4, vm.DUP2, vm.LT, vm.ISZERO).jumpi(end)
+	a.push(memArg).op(vm.ADD, vm.MLOAD)       // key len base i word
+	a.op(vm.DUP3, vm.DUP3, vm.ADD, vm.SSTORE) // key len base i
+	a.push(1).op(vm.ADD).jump(loop)
+	a.label(end).op(vm.POP, vm.POP, vm.POP, vm.POP) // key
+}
+
+// encodeString ABI-encodes the string of the length on the stack whose bytes are at
+// memResult+0x40, replacing the length with the encoded size
+func encodeString(a *assembler) {
+	a.op(vm.DUP1).push(memResult + 0x20).op(vm.MSTORE)
+	a.push(0x20).push(memResult).op(vm.MSTORE)
+	a.push(31).op(vm.ADD).push(5).op(vm.SHR).push(5).op(vm.SHL).push(0x40).op(vm.ADD)
+}
+
+// revertWith defines label as a revert with Error(reason), reason at most 32 bytes
+func revertWith(a *assembler, label, reason string) {
+	a.label(label)
+	a.pushBytes(append(crypto.Keccak256([]byte("Error(string)"))[:4], make([]byte, 28)...)).push(0).op(vm.MSTORE)
+	a.push(0x20).push(4).op(vm.MSTORE)
+	a.push(uint64(len(reason))).push(36).op(vm.MSTORE)
+	a.pushBytes(append([]byte(reason), make([]byte, 32-len(reason))...)).push(68).op(vm.MSTORE)
+	a.push(100).push(0).op(vm.REVERT)
+}
+
+// eventTopic returns the topic of an event signature
+func eventTopic(signature string) []byte {
+	return crypto.Keccak256([]byte(signature))
+}
+
+// addressMask is the low 160 bits set
+func addressMask() []byte {
+	mask := make([]byte, 20)
+	for i := range mask {
+		mask[i] = 0xff
+	}
+	return mask
+}
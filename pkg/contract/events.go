@@ -0,0 +1,230 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// Event names, as in the contract ABI
+const (
+	EventNameRegistered       = "NameRegistered"
+	EventCIDUpdated           = "CIDUpdated"
+	EventOwnershipTransferred = "OwnershipTransferred"
+)
+
+// Event is a decoded contract log. The name is an indexed string, so logs only carry its
+// keccak256 hash; see NameHash.
+type Event struct {
+	Type        string         `json:"type"`
+	NameHash    common.Hash    `json:"name_hash"`
+	CID         string         `json:"cid,omitempty"`       // New CID, also set for registrations when the call can be decoded
+	Owner       common.Address `json:"owner"`               // Owner after the event
+	OldOwner    common.Address `json:"old_owner,omitempty"` // Previous owner of a transfer
+	BlockNumber uint64         `json:"block_number"`
+	BlockHash   common.Hash    `json:"block_hash"`
+	TxHash      common.Hash    `json:"tx_hash"`
+	LogIndex    uint           `json:"log_index"`
+}
+
+// maxLogRange bounds the blocks requested in one log query
+const maxLogRange = 2000
+
+// NameHash returns the topic a name is indexed under in contract logs
+func NameHash(name string) common.Hash {
+	return crypto.Keccak256Hash([]byte(name))
+}
+
+// Header returns the header of a block, or of the latest block if number is nil
+func (c *Client) Header(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return c.client.HeaderByNumber(ctx, number)
+}
+
+// FilterEvents returns the contract events in blocks from to to, inclusive, in log order
+func (c *Client) FilterEvents(ctx context.Context, from, to uint64) ([]Event, error) {
+	registered := c.abi.Events[EventNameRegistered].ID
+	updated := c.abi.Events[EventCIDUpdated].ID
+	transferred := c.abi.Events[EventOwnershipTransferred].ID
+
+	logs, err := c.client.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []common.Address{c.address},
+		Topics:    [][]common.Hash{{registered, updated, transferred}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter logs: %w", err)
+	}
+
+	events := make([]Event, 0, len(logs))
+	for _, l := range logs {
+		if l.Removed || len(l.Topics) < 2 {
+			continue
+		}
+		event := Event{
+			NameHash:    l.Topics[1],
+			BlockNumber: l.BlockNumber,
+			BlockHash:   l.BlockHash,
+			TxHash:      l.TxHash,
+			LogIndex:    l.Index,
+		}
+		switch l.Topics[0] {
+		case registered:
+			if len(l.Topics) != 3 {
+				return nil, fmt.Errorf("malformed %s log in transaction %s", EventNameRegistered, l.TxHash.Hex())
+			}
+			event.Type = EventNameRegistered
+			event.Owner = common.BytesToAddress(l.Topics[2].Bytes())
+			// register does not log the CID; recover it from the call
+			if event.CID, err = c.registeredCID(ctx, l.TxHash); err != nil {
+				return nil, err
+			}
+		case updated:
+			values, err := c.abi.Unpack(EventCIDUpdated, l.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode %s log in transaction %s: %w", EventCIDUpdated, l.TxHash.Hex(), err)
+			}
+			event.Type = EventCIDUpdated
+			event.CID, _ = values[0].(string)
+		case transferred:
+			if len(l.Topics) != 4 {
+				return nil, fmt.Errorf("malformed %s log in transaction %s", EventOwnershipTransferred, l.TxHash.Hex())
+			}
+			event.Type = EventOwnershipTransferred
+			event.OldOwner = common.BytesToAddress(l.Topics[2].Bytes())
+			event.Owner = common.BytesToAddress(l.Topics[3].Bytes())
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// RegisteredNames returns the names registered in blocks from on. Logs only carry name hashes,
+// so names are read from the register calls; registrations made through another contract
+// cannot be decoded and are missing.
+func (c *Client) RegisteredNames(ctx context.Context, from uint64) ([]string, error) {
+	latest, err := c.Header(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+	registered := c.abi.Events[EventNameRegistered].ID
+
+	var names []string
+	for start := from; start <= latest.Number.Uint64(); start += maxLogRange {
+		logs, err := c.client.FilterLogs(ctx, ethereum.FilterQuery{
+			FromBlock: new(big.Int).SetUint64(start),
+			ToBlock:   new(big.Int).SetUint64(min(start+maxLogRange-1, latest.Number.Uint64())),
+			Addresses: []common.Address{c.address},
+			Topics:    [][]common.Hash{{registered}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter logs: %w", err)
+		}
+		for _, l := range logs {
+			if l.Removed || len(l.Topics) < 2 {
+				continue
+			}
+			tx, _, err := c.client.TransactionByHash(ctx, l.TxHash)
+			if errors.Is(err, ethereum.NotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get transaction %s: %w", l.TxHash.Hex(), err)
+			}
+			method, name, _, err := c.DecodeCall(tx.Data())
+			if err != nil || method != MethodRegister || NameHash(name) != l.Topics[1] {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// registeredCID returns the CID a register transaction set. Registrations made through
+// another contract cannot be decoded and return "".
+func (c *Client) registeredCID(ctx context.Context, txHash common.Hash) (string, error) {
+	tx, _, err := c.client.TransactionByHash(ctx, txHash)
+	if errors.Is(err, ethereum.NotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get transaction %s: %w", txHash.Hex(), err)
+	}
+	method, _, cid, err := c.DecodeCall(tx.Data())
+	if err != nil || method != MethodRegister {
+		return "", nil
+	}
+	return cid, nil
+}
+
+// nameChangeQuery returns the filter for logs that register a name or change its CID or owner
+func (c *Client) nameChangeQuery() ethereum.FilterQuery {
+	return ethereum.FilterQuery{
+		Addresses: []common.Address{c.address},
+		Topics: [][]common.Hash{{
+			c.abi.Events[EventNameRegistered].ID,
+			c.abi.Events[EventCIDUpdated].ID,
+			c.abi.Events[EventOwnershipTransferred].ID,
+		}},
+	}
+}
+
+// ChangedNames returns the hashes of the names registered, or whose CID or owner changed, in
+// blocks from to to
+func (c *Client) ChangedNames(ctx context.Context, from, to uint64) ([]common.Hash, error) {
+	query := c.nameChangeQuery()
+	query.FromBlock = new(big.Int).SetUint64(from)
+	query.ToBlock = new(big.Int).SetUint64(to)
+	logs, err := c.client.FilterLogs(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to filter logs: %w", err)
+	}
+	hashes := make([]common.Hash, 0, len(logs))
+	for _, l := range logs {
+		if len(l.Topics) > 1 {
+			hashes = append(hashes, l.Topics[1])
+		}
+	}
+	return hashes, nil
+}
+
+// SubscribeChangedNames sends the hash of each name registered, or whose CID or owner changes,
+// to sink as the change is mined. Subscriptions need a websocket or IPC connection to the node;
+// over HTTP it fails and callers poll ChangedNames instead.
+func (c *Client) SubscribeChangedNames(ctx context.Context, sink chan<- common.Hash) (ethereum.Subscription, error) {
+	logs := make(chan types.Log)
+	sub, err := c.client.SubscribeFilterLogs(ctx, c.nameChangeQuery(), logs)
+	if err != nil {
+		return nil, err
+	}
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case l := <-logs:
+				if len(l.Topics) < 2 {
+					continue
+				}
+				select {
+				case sink <- l.Topics[1]:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
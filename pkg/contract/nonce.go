@@ -0,0 +1,135 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// NonceManager assigns nonces to the transactions the server signs. go-ethereum fetches the
+// pending nonce for every transaction, so concurrent sends from one account can pick the same
+// nonce and fail with "nonce too low" or replace each other. NonceManager serializes sends per
+// account and hands out consecutive nonces from its own count.
+type NonceManager struct {
+	backend Backend
+
+	mu       sync.Mutex
+	accounts map[common.Address]*accountNonces
+}
+
+// accountNonces is the nonce state of one account
+type accountNonces struct {
+	mu     sync.Mutex             // Held while a transaction of the account is signed and sent
+	next   uint64                 // Next nonce to assign; 0 until synced from the node
+	synced bool                   // Whether next is known
+	sent   map[uint64]common.Hash // Latest transaction sent per nonce not yet known to be mined
+}
+
+// NewNonceManager creates a NonceManager for transactions sent through backend
+func NewNonceManager(backend Backend) *NonceManager {
+	return &NonceManager{
+		backend:  backend,
+		accounts: make(map[common.Address]*accountNonces),
+	}
+}
+
+// account returns the nonce state of an address
+func (m *NonceManager) account(from common.Address) *accountNonces {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[from]
+	if !ok {
+		a = &accountNonces{sent: make(map[uint64]common.Hash)}
+		m.accounts[from] = a
+	}
+	return a
+}
+
+// Send calls send with a copy of auth carrying the account's next nonce. Only one transaction per
+// account is sent at a time. If auth already has a nonce, as a replacement does, it is kept.
+// A send that fails with "nonce too low" is retried once after resyncing with the node.
+func (m *NonceManager) Send(auth *bind.TransactOpts, send func(*bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	a := m.account(auth.From)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if auth.Nonce != nil {
+		tx, err := send(auth)
+		if err == nil {
+			a.sent[tx.Nonce()] = tx.Hash()
+		}
+		return tx, err
+	}
+
+	ctx := auth.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for attempt := 0; ; attempt++ {
+		if err := m.sync(ctx, auth.From, a); err != nil {
+			return nil, err
+		}
+
+		opts := *auth
+		opts.Nonce = new(big.Int).SetUint64(a.next)
+		tx, err := send(&opts)
+		if err == nil {
+			a.sent[a.next] = tx.Hash()
+			a.next++
+			return tx, nil
+		}
+
+		// The node did not take the nonce; count from its view again next time
+		a.synced = false
+		if attempt > 0 || !strings.Contains(err.Error(), "nonce too low") {
+			return nil, err
+		}
+	}
+}
+
+// sync reconciles the account's nonce count with the node. Nonces the node reports as used,
+// for example by another process signing with the same key, are skipped. If the node's pending
+// nonce is behind the count and the transaction holding that nonce is unknown to it, the
+// transaction was dropped; every later transaction is stuck behind the gap, so the count
+// restarts at the gap and the next transaction fills it.
+func (m *NonceManager) sync(ctx context.Context, from common.Address, a *accountNonces) error {
+	pending, err := m.backend.PendingNonceAt(ctx, from)
+	if err != nil {
+		return err
+	}
+	for nonce := range a.sent {
+		if nonce < pending {
+			delete(a.sent, nonce) // Mined or pending in order; no longer needed for gap checks
+		}
+	}
+
+	if !a.synced || pending >= a.next {
+		a.next, a.synced = pending, true
+		return nil
+	}
+
+	hash, ok := a.sent[pending]
+	if ok {
+		_, _, err := m.backend.TransactionByHash(ctx, hash)
+		if err == nil {
+			return nil // Known to the node, which lags behind our count
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return err
+		}
+	}
+	for nonce := range a.sent {
+		if nonce >= pending {
+			delete(a.sent, nonce)
+		}
+	}
+	a.next = pending
+	return nil
+}
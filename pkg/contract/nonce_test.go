@@ -0,0 +1,93 @@
+package contract_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"ipfs-gin-example/pkg/contract"
+	"ipfs-gin-example/pkg/contract/contracttest"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+func TestConcurrentSendsFromOneAccount(t *testing.T) {
+	chain := contracttest.New(t, 1)
+	alice := chain.Accounts[0]
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			opts := *alice
+			errs <- chain.Client.RegisterName(&opts, fmt.Sprintf("name%d.com", i), cidA)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("RegisterName: %v", err)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("name%d.com", i)
+		if owner, err := chain.Client.GetOwner(name); err != nil || owner != alice.From {
+			t.Fatalf("GetOwner(%s) = %s, %v; want %s", name, owner, err, alice.From)
+		}
+	}
+}
+
+// droppingBackend mines every transaction it sends, except that it silently drops the next one
+// when drop is set, like a node evicting a transaction from its pool
+type droppingBackend struct {
+	simulated.Client
+	backend *simulated.Backend
+	drop    bool
+}
+
+func (d *droppingBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if d.drop {
+		d.drop = false
+		return nil
+	}
+	if err := d.Client.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	d.backend.Commit()
+	return nil
+}
+
+func TestNonceGapAfterDroppedTransaction(t *testing.T) {
+	chain := contracttest.New(t, 1)
+	alice := chain.Accounts[0]
+	backend := &droppingBackend{Client: chain.Backend.Client(), backend: chain.Backend}
+	client, err := contract.NewClientWithBackend(backend, chain.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.drop = true
+	dropped, err := client.Send(alice, contract.MethodRegister, "dropped.com", cidA)
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	// The next transaction must reuse the dropped nonce, or it would wait behind the gap forever
+	if err := client.RegisterName(alice, "example.com", cidA); err != nil {
+		t.Fatalf("RegisterName after a dropped transaction: %v", err)
+	}
+	if owner, err := client.GetOwner("example.com"); err != nil || owner != alice.From {
+		t.Fatalf("GetOwner = %s, %v; want %s", owner, err, alice.From)
+	}
+	nonce, err := backend.NonceAt(context.Background(), alice.From, nil)
+	if err != nil || nonce != dropped.Nonce()+1 {
+		t.Fatalf("account nonce = %d, %v; want %d", nonce, err, dropped.Nonce()+1)
+	}
+}
@@ -0,0 +1,158 @@
+package contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Methods a client may sign and relay through the gateway
+const (
+	MethodRegister  = "register"
+	MethodUpdateCID = "updateCID"
+)
+
+// MethodTransferOwnership is sent by the gateway's job queue; it is not relayed
+const MethodTransferOwnership = "transferOwnership"
+
+// ErrTxReverted is returned when a transaction was mined but failed
+var ErrTxReverted = errors.New("transaction reverted")
+
+// PrepareTx builds an unsigned register or updateCID call from the given account, with its
+// pending nonce, current fees and an estimated gas limit, for the account to sign itself.
+// Gas estimation runs the call, so a call the contract would reject fails here.
+func (c *Client) PrepareTx(ctx context.Context, from common.Address, method, name, cid string) (*types.Transaction, error) {
+	if method != MethodRegister && method != MethodUpdateCID {
+		return nil, fmt.Errorf("unsupported method %q", method)
+	}
+	data, err := c.abi.Pack(method, name, cid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s call: %w", method, err)
+	}
+
+	chainID, err := c.client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	nonce, err := c.client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	gas, err := c.client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &c.address, Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate gas: %w", err)
+	}
+
+	head, err := c.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest header: %w", err)
+	}
+	if head.BaseFee == nil {
+		// Pre-London chain: legacy transaction
+		gasPrice, err := c.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to suggest gas price: %w", err)
+		}
+		return types.NewTx(&types.LegacyTx{Nonce: nonce, GasPrice: gasPrice, Gas: gas, To: &c.address, Data: data}), nil
+	}
+	tip, err := c.client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest gas tip: %w", err)
+	}
+	// Same fee cap as bind uses: room for the base fee to double
+	feeCap := new(big.Int).Add(tip, new(big.Int).Mul(head.BaseFee, big.NewInt(2)))
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       gas,
+		To:        &c.address,
+		Data:      data,
+	}), nil
+}
+
+// DecodeCall returns the method and arguments of a register or updateCID call
+func (c *Client) DecodeCall(data []byte) (method, name, cid string, err error) {
+	if len(data) < 4 {
+		return "", "", "", errors.New("calldata too short")
+	}
+	m, err := c.abi.MethodById(data[:4])
+	if err != nil {
+		return "", "", "", err
+	}
+	if m.Name != MethodRegister && m.Name != MethodUpdateCID {
+		return "", "", "", fmt.Errorf("unsupported method %q", m.Name)
+	}
+	args, err := m.Inputs.Unpack(data[4:])
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to decode %s call: %w", m.Name, err)
+	}
+	return m.Name, args[0].(string), args[1].(string), nil
+}
+
+// SendSignedTx broadcasts a transaction a client signed itself and waits until it is mined.
+// Only register and updateCID calls to the contract are relayed.
+func (c *Client) SendSignedTx(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	if tx.To() == nil || *tx.To() != c.address {
+		return nil, fmt.Errorf("transaction is not addressed to the naming contract %s", c.address)
+	}
+	if _, _, _, err := c.DecodeCall(tx.Data()); err != nil {
+		return nil, err
+	}
+
+	if err := c.client.SendTransaction(ctx, tx); err != nil {
+		return nil, fmt.Errorf("failed to send transaction: %w", err)
+	}
+	receipt, err := bind.WaitMined(ctx, c.client, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for transaction %s: %w", tx.Hash().Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, ErrTxReverted
+	}
+	return receipt, nil
+}
+
+// Send signs and sends a register or updateCID call without waiting for it to be mined.
+// Fields set on auth, such as the nonce and fees of a replacement, are used as given; otherwise
+// the nonce comes from the client's NonceManager.
+func (c *Client) Send(auth *bind.TransactOpts, method, name, cid string) (*types.Transaction, error) {
+	var send func(*bind.TransactOpts) (*types.Transaction, error)
+	switch method {
+	case MethodRegister:
+		send = func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return c.contract.Register(opts, name, cid)
+		}
+	case MethodUpdateCID:
+		send = func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return c.contract.UpdateCID(opts, name, cid)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported method %q", method)
+	}
+	return c.nonces.Send(auth, send)
+}
+
+// SendTransfer signs and sends a transferOwnership call handing name to newOwner without waiting
+// for it to be mined. Fields set on auth are used as in Send.
+func (c *Client) SendTransfer(auth *bind.TransactOpts, name string, newOwner common.Address) (*types.Transaction, error) {
+	return c.nonces.Send(auth, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return c.contract.TransferOwnership(opts, name, newOwner)
+	})
+}
+
+// Receipt returns the receipt of a transaction, or nil if it is not mined yet
+func (c *Client) Receipt(ctx context.Context, hash common.Hash) (*types.Receipt, error) {
+	receipt, err := c.client.TransactionReceipt(ctx, hash)
+	if errors.Is(err, ethereum.NotFound) {
+		return nil, nil
+	}
+	return receipt, err
+}
@@ -0,0 +1,343 @@
+// Package indexer follows the events of the naming contract and keeps the history of every name.
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ipfs-gin-example/pkg/contract"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Store keys. History entries are keyed by name hash, block and log index, so the entries of
+// a name share a prefix and those above a block can be found when rewinding a reorg.
+const (
+	historyKeyPrefix    = "/history/"        // /history/<name hash>/<block>/<log index> -> Event
+	headKey             = "/indexer/head"    // Last indexed block
+	checkpointKeyPrefix = "/indexer/blocks/" // /indexer/blocks/<block> -> block hash
+)
+
+// maxBlockRange bounds the blocks requested in one log query
+const maxBlockRange = 2000
+
+// maxCheckpoints is how many indexed block hashes are kept to find where a reorg forked
+const maxCheckpoints = 256
+
+// block identifies an indexed block
+type block struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+}
+
+// Indexer stores contract events once they are Confirmations blocks deep. Each indexed range
+// records the hash of its last block; if that block is later replaced by a reorg, the events
+// above the newest block still on the chain are dropped and indexed again.
+type Indexer struct {
+	store         storage.Store
+	contract      *contract.Client
+	StartBlock    uint64        // First block to index, usually the contract deployment block
+	Confirmations uint64        // Blocks on top of a block before its events are indexed
+	PollInterval  time.Duration // How often new blocks are checked for
+}
+
+// NewIndexer creates an Indexer
+func NewIndexer(store storage.Store, contractClient *contract.Client, startBlock, confirmations uint64) *Indexer {
+	return &Indexer{
+		store:         store,
+		contract:      contractClient,
+		StartBlock:    startBlock,
+		Confirmations: confirmations,
+		PollInterval:  5 * time.Second,
+	}
+}
+
+// Run indexes new blocks every PollInterval until ctx is done
+func (ix *Indexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(ix.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := ix.Sync(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Indexer: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync indexes the events of every confirmed block not indexed yet, after rewinding a reorg
+func (ix *Indexer) Sync(ctx context.Context) error {
+	latest, err := ix.contract.Header(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get latest block: %w", err)
+	}
+	if latest.Number.Uint64() < ix.Confirmations {
+		return nil
+	}
+	safe := latest.Number.Uint64() - ix.Confirmations
+
+	head, err := ix.head()
+	if err != nil {
+		return err
+	}
+	if head != nil {
+		header, err := ix.contract.Header(ctx, new(big.Int).SetUint64(head.Number))
+		if err != nil {
+			return fmt.Errorf("failed to get block %d: %w", head.Number, err)
+		}
+		if header.Hash() != head.Hash {
+			if head, err = ix.rewind(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	from := ix.StartBlock
+	if head != nil {
+		from = head.Number + 1
+	}
+	for from <= safe {
+		to := min(from+maxBlockRange-1, safe)
+		if err := ix.indexRange(ctx, from, to); err != nil {
+			return err
+		}
+		from = to + 1
+	}
+	return nil
+}
+
+// indexRange stores the events of blocks from to to and advances the head to block to
+func (ix *Indexer) indexRange(ctx context.Context, from, to uint64) error {
+	header, err := ix.contract.Header(ctx, new(big.Int).SetUint64(to))
+	if err != nil {
+		return fmt.Errorf("failed to get block %d: %w", to, err)
+	}
+	events, err := ix.contract.FilterEvents(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	// A reorg between the two queries could mix forks; the next sync retries the range
+	for _, event := range events {
+		if event.BlockNumber == to && event.BlockHash != header.Hash() {
+			return fmt.Errorf("chain reorganized while indexing block %d", to)
+		}
+	}
+
+	head := block{Number: to, Hash: header.Hash()}
+	headData, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	blocks := make([]storage.Block, 0, len(events)+2)
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, storage.Block{Key: historyKey(event), Data: data})
+	}
+	blocks = append(blocks,
+		storage.Block{Key: checkpointKey(to), Data: head.Hash.Bytes()},
+		storage.Block{Key: []byte(headKey), Data: headData},
+	)
+	if err := ix.store.PutMany(blocks); err != nil {
+		return fmt.Errorf("failed to store events of blocks %d-%d: %w", from, to, err)
+	}
+	if len(events) > 0 {
+		log.Printf("Indexer: indexed %d events in blocks %d-%d", len(events), from, to)
+	}
+	return ix.pruneCheckpoints(ctx)
+}
+
+// rewind drops the events above the newest checkpoint that is still on the chain and returns
+// it as the new head; nil if no checkpoint survived and indexing restarts at StartBlock.
+func (ix *Indexer) rewind(ctx context.Context) (*block, error) {
+	checkpoints, err := ix.checkpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var head *block
+	for i := len(checkpoints) - 1; i >= 0; i-- {
+		header, err := ix.contract.Header(ctx, new(big.Int).SetUint64(checkpoints[i].Number))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %d: %w", checkpoints[i].Number, err)
+		}
+		if header.Hash() == checkpoints[i].Hash {
+			head = &checkpoints[i]
+			break
+		}
+		if err := ix.store.Delete(checkpointKey(checkpoints[i].Number)); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops key iteration on early return
+
+	keys, keysErr := ix.store.AllKeys(ctx, []byte(historyKeyPrefix))
+	var stale [][]byte
+	for key := range keys {
+		number, err := historyKeyBlock(key)
+		if err != nil {
+			return nil, err
+		}
+		if head == nil || number > head.Number {
+			stale = append(stale, key)
+		}
+	}
+	if err := keysErr(); err != nil {
+		return nil, err
+	}
+	for _, key := range stale {
+		if err := ix.store.Delete(key); err != nil {
+			return nil, err
+		}
+	}
+	dropped := len(stale)
+
+	if head == nil {
+		err = ix.store.Delete([]byte(headKey))
+		log.Printf("Indexer: chain reorganized below every checkpoint, dropped %d events and restarting at block %d", dropped, ix.StartBlock)
+	} else {
+		var data []byte
+		if data, err = json.Marshal(head); err == nil {
+			err = ix.store.Put([]byte(headKey), data)
+		}
+		log.Printf("Indexer: chain reorganized above block %d, dropped %d events", head.Number, dropped)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind indexer head: %w", err)
+	}
+	return head, nil
+}
+
+// History returns the events of a name, oldest first
+func (ix *Indexer) History(ctx context.Context, name string) ([]contract.Event, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops key iteration on early return
+
+	prefix := historyKeyPrefix + contract.NameHash(name).Hex() + "/"
+	keys, keysErr := ix.store.AllKeys(ctx, []byte(prefix))
+	var sorted []string
+	for key := range keys {
+		sorted = append(sorted, string(key))
+	}
+	if err := keysErr(); err != nil {
+		return nil, err
+	}
+	sort.Strings(sorted) // Fixed-width block and log index keys sort in chain order
+
+	events := make([]contract.Event, 0, len(sorted))
+	for _, key := range sorted {
+		data, err := ix.store.Get([]byte(key))
+		if errors.Is(err, storage.ErrNotFound) {
+			continue // Dropped by a concurrent rewind
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history entry %s: %w", key, err)
+		}
+		var event contract.Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, fmt.Errorf("failed to decode history entry %s: %w", key, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// IndexedBlock returns the last indexed block, and false if nothing is indexed yet
+func (ix *Indexer) IndexedBlock() (uint64, bool, error) {
+	head, err := ix.head()
+	if err != nil || head == nil {
+		return 0, false, err
+	}
+	return head.Number, true, nil
+}
+
+// head returns the last indexed block, or nil
+func (ix *Indexer) head() (*block, error) {
+	data, err := ix.store.Get([]byte(headKey))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexer head: %w", err)
+	}
+	var head block
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, fmt.Errorf("failed to decode indexer head: %w", err)
+	}
+	return &head, nil
+}
+
+// checkpoints returns the stored checkpoints, lowest block first
+func (ix *Indexer) checkpoints(ctx context.Context) ([]block, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops key iteration on early return
+
+	keys, keysErr := ix.store.AllKeys(ctx, []byte(checkpointKeyPrefix))
+	var checkpoints []block
+	for key := range keys {
+		number, err := strconv.ParseUint(strings.TrimPrefix(string(key), checkpointKeyPrefix), 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkpoint key %s: %w", key, err)
+		}
+		hash, err := ix.store.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checkpoint %d: %w", number, err)
+		}
+		checkpoints = append(checkpoints, block{Number: number, Hash: common.BytesToHash(hash)})
+	}
+	if err := keysErr(); err != nil {
+		return nil, err
+	}
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].Number < checkpoints[j].Number })
+	return checkpoints, nil
+}
+
+// pruneCheckpoints deletes all but the newest maxCheckpoints checkpoints
+func (ix *Indexer) pruneCheckpoints(ctx context.Context) error {
+	checkpoints, err := ix.checkpoints(ctx)
+	if err != nil {
+		return err
+	}
+	for len(checkpoints) > maxCheckpoints {
+		if err := ix.store.Delete(checkpointKey(checkpoints[0].Number)); err != nil {
+			return err
+		}
+		checkpoints = checkpoints[1:]
+	}
+	return nil
+}
+
+// historyKey returns the key an event is stored under
+func historyKey(event contract.Event) []byte {
+	return []byte(fmt.Sprintf("%s%s/%016x/%08x", historyKeyPrefix, event.NameHash.Hex(), event.BlockNumber, event.LogIndex))
+}
+
+// historyKeyBlock returns the block number of a history key
+func historyKeyBlock(key []byte) (uint64, error) {
+	parts := strings.Split(strings.TrimPrefix(string(key), historyKeyPrefix), "/")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid history key %s", key)
+	}
+	return strconv.ParseUint(parts[1], 16, 64)
+}
+
+// checkpointKey returns the key the hash of an indexed block is stored under
+func checkpointKey(number uint64) []byte {
+	return []byte(fmt.Sprintf("%s%016x", checkpointKeyPrefix, number))
+}
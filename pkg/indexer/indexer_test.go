@@ -0,0 +1,146 @@
+package indexer_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"ipfs-gin-example/pkg/contract"
+	"ipfs-gin-example/pkg/contract/contracttest"
+	"ipfs-gin-example/pkg/indexer"
+	"ipfs-gin-example/pkg/storage"
+)
+
+const (
+	cidA = "bafkreifhfgbgpbk3tj6jnkd5vhl67jnbnclsxqrpmo3zk4qqe7gel2tfta"
+	cidB = "bafkreidd3lbo3mrsutwru2tib4h6d3ivi73nb4ss74lkoi63jiq5vhxc5y"
+)
+
+// eventTypes returns the types of events, in order
+func eventTypes(events []contract.Event) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	chain := contracttest.New(t, 2)
+	alice, bob := chain.Accounts[0], chain.Accounts[1]
+
+	if err := chain.Client.RegisterName(alice, "example.com", cidA); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+	if err := chain.Client.UpdateCID(alice, "example.com", cidB); err != nil {
+		t.Fatalf("UpdateCID: %v", err)
+	}
+	if err := chain.Client.TransferOwnership(alice, "example.com", bob.From); err != nil {
+		t.Fatalf("TransferOwnership: %v", err)
+	}
+	if err := chain.Client.RegisterName(bob, "other.com", cidA); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+
+	// With one confirmation required, the last registration is not indexed yet
+	ix := indexer.NewIndexer(storage.NewMemoryStore(), chain.Client, 0, 1)
+	if err := ix.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	events, err := ix.History(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	want := []string{contract.EventNameRegistered, contract.EventCIDUpdated, contract.EventOwnershipTransferred}
+	if got := eventTypes(events); !reflect.DeepEqual(got, want) {
+		t.Fatalf("event types = %v, want %v", got, want)
+	}
+	if events[0].CID != cidA || events[0].Owner != alice.From {
+		t.Errorf("registration = %+v, want %s owned by %s", events[0], cidA, alice.From)
+	}
+	if events[1].CID != cidB {
+		t.Errorf("update CID = %q, want %q", events[1].CID, cidB)
+	}
+	if events[2].OldOwner != alice.From || events[2].Owner != bob.From {
+		t.Errorf("transfer = %+v, want %s to %s", events[2], alice.From, bob.From)
+	}
+	if events, err := ix.History(ctx, "other.com"); err != nil || len(events) != 0 {
+		t.Fatalf("History(other.com) = %v, %v; want none before confirmation", events, err)
+	}
+
+	chain.Backend.Commit()
+	if err := ix.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if events, err := ix.History(ctx, "other.com"); err != nil || len(events) != 1 {
+		t.Fatalf("History(other.com) = %v, %v; want the registration", events, err)
+	}
+}
+
+func TestReorgRewindsHistory(t *testing.T) {
+	ctx := context.Background()
+	chain := contracttest.New(t, 1)
+	alice := chain.Accounts[0]
+
+	if err := chain.Client.RegisterName(alice, "example.com", cidA); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+	forkPoint, err := chain.Client.Header(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := indexer.NewIndexer(storage.NewMemoryStore(), chain.Client, 0, 0)
+	if err := ix.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if err := chain.Client.UpdateCID(alice, "example.com", cidB); err != nil {
+		t.Fatalf("UpdateCID: %v", err)
+	}
+	if err := ix.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	events, err := ix.History(ctx, "example.com")
+	if err != nil || len(events) != 2 {
+		t.Fatalf("History = %v, %v; want registration and update", events, err)
+	}
+	orphaned := events[1]
+
+	// Replace the block of the update with a longer fork; indexing rewinds to the fork point
+	if err := chain.Backend.Fork(forkPoint.Hash()); err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	chain.Backend.Commit()
+	chain.Backend.Commit()
+	chain.Backend.Commit()
+
+	if err := ix.Sync(ctx); err != nil {
+		t.Fatalf("Sync after reorg: %v", err)
+	}
+	events, err = ix.History(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(events) == 0 || events[0].BlockNumber != forkPoint.Number.Uint64() {
+		t.Fatalf("history after reorg = %+v, want the registration kept", events)
+	}
+	for _, event := range events {
+		if event.BlockHash == orphaned.BlockHash {
+			t.Fatalf("history still holds the orphaned event %+v", event)
+		}
+	}
+
+	// The rewound index matches one built from scratch on the new chain
+	fresh := indexer.NewIndexer(storage.NewMemoryStore(), chain.Client, 0, 0)
+	if err := fresh.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	want, err := fresh.History(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("history after reorg = %+v, want %+v", events, want)
+	}
+}
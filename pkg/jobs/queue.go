@@ -0,0 +1,603 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ipfs-gin-example/pkg/contract"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// jobKeyPrefix prefixes the keys jobs are persisted under
+const jobKeyPrefix = "/jobs/"
+
+// Job states
+const (
+	Pending = "pending"
+	Mined   = "mined"
+	Failed  = "failed"
+)
+
+// pendingUpdateGas is the gas limit of an update sent while the registration of its name is
+// pending; updateCID rewrites the record register created, so this leaves ample headroom
+const pendingUpdateGas = 300000
+
+// ErrNotFound is returned for an unknown job ID
+var ErrNotFound = errors.New("job not found")
+
+// Job tracks one name update transaction until it is mined
+type Job struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CID       string    `json:"cid,omitempty"`
+	NewOwner  string    `json:"new_owner,omitempty"` // Address a transfer hands the name to
+	Method    string    `json:"method"`              // register, updateCID or transferOwnership
+	Account   string    `json:"account"`             // Address the transaction is sent from
+	State     string    `json:"state"`
+	TxHash    string    `json:"tx_hash"`   // Latest transaction sent
+	TxHashes  []string  `json:"tx_hashes"` // Every transaction sent, replacements included; any of them may be mined
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+	Receipt   *Receipt  `json:"receipt,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Receipt holds the receipt details of a mined job
+type Receipt struct {
+	TxHash      string `json:"tx_hash"`
+	BlockNumber uint64 `json:"block_number"`
+	BlockHash   string `json:"block_hash"`
+	GasUsed     uint64 `json:"gas_used"`
+	Status      uint64 `json:"status"` // 1 on success, 0 if the transaction reverted
+}
+
+// Queue submits name update transactions without waiting for them to be mined. Each job is
+// watched in the background: a transaction that is not mined within Timeout is replaced with
+// one paying higher fees, up to MaxAttempts transactions, before the job fails. The root of a
+// job is pinned until the job is done, and then by its name if the update was mined. A job
+// that failed waiting may still be mined, so its root stays pinned until a later update of
+// its name is mined.
+type Queue struct {
+	store        storage.Store
+	contract     *contract.Client
+	resolver     *resolver.Resolver
+	pinner       *pin.Pinner
+	Timeout      time.Duration // How long to wait for a transaction before replacing it
+	MaxAttempts  int           // Transactions sent per job, the first one included
+	PollInterval time.Duration // How often receipts are checked
+
+	mu      sync.Mutex                 // Serializes job record writes and guards pending and held
+	pending map[string][]pendingUpdate // Pending register and updateCID jobs by name, oldest first
+	held    map[string][]heldJob       // Done jobs by name whose roots stay pinned, see Queue
+	pinMu   sync.Mutex                 // Serializes reading a name's mined root with pinning it
+}
+
+// pendingUpdate is a submitted update of a name that is not mined yet
+type pendingUpdate struct {
+	id      string
+	cid     string
+	account string
+}
+
+// heldJob is a done job whose root stays pinned until a later update of its name is mined
+type heldJob struct {
+	id      string
+	created time.Time
+}
+
+// NewQueue creates a Queue
+func NewQueue(store storage.Store, contractClient *contract.Client, resolver *resolver.Resolver, pinner *pin.Pinner, timeout time.Duration, maxAttempts int) *Queue {
+	return &Queue{
+		store:        store,
+		contract:     contractClient,
+		resolver:     resolver,
+		pinner:       pinner,
+		Timeout:      timeout,
+		MaxAttempts:  maxAttempts,
+		PollInterval: time.Second,
+		pending:      make(map[string][]pendingUpdate),
+		held:         make(map[string][]heldJob),
+	}
+}
+
+// Resume watches the jobs left pending by a previous run. Their signers are gone, so they are
+// not replaced any more; a job none of whose transactions is mined within Timeout fails. The
+// roots of failed jobs that may still be mined stay pinned, as in the previous run.
+func (q *Queue) Resume(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops key iteration on early return
+
+	keys, keysErr := q.store.AllKeys(ctx, []byte(jobKeyPrefix))
+	var pending []*Job
+	for key := range keys {
+		job, err := q.Get(strings.TrimPrefix(string(key), jobKeyPrefix))
+		if err != nil {
+			return err
+		}
+		switch {
+		case job.State == Pending:
+			pending = append(pending, job)
+		case job.State == Failed && job.Receipt == nil:
+			q.hold(job)
+		}
+	}
+	if err := keysErr(); err != nil {
+		return err
+	}
+
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+	for _, job := range pending {
+		q.addPending(job)
+		go q.watch(job, nil, nil)
+	}
+	return nil
+}
+
+// PendingRoot returns the root the newest pending update of name points it at, and false if
+// no update of name is pending. Edits build on it rather than on the registry's root, which
+// does not include the pending updates yet.
+func (q *Queue) PendingRoot(name string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	updates := q.pending[name]
+	if len(updates) == 0 {
+		return "", false
+	}
+	return updates[len(updates)-1].cid, true
+}
+
+// pendingAccount returns the account of the oldest pending update of name, and false if none is pending
+func (q *Queue) pendingAccount(name string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	updates := q.pending[name]
+	if len(updates) == 0 {
+		return "", false
+	}
+	return updates[0].account, true
+}
+
+// addPending records a pending register or updateCID job
+func (q *Queue) addPending(job *Job) {
+	if job.Method == contract.MethodTransferOwnership {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending[job.Name] = append(q.pending[job.Name], pendingUpdate{id: job.ID, cid: job.CID, account: job.Account})
+}
+
+// removePending drops a job that is no longer pending; q.mu must be held
+func (q *Queue) removePending(job *Job) {
+	updates := q.pending[job.Name]
+	for i, update := range updates {
+		if update.id == job.ID {
+			updates = append(updates[:i:i], updates[i+1:]...)
+			break
+		}
+	}
+	if len(updates) == 0 {
+		delete(q.pending, job.Name)
+	} else {
+		q.pending[job.Name] = updates
+	}
+}
+
+// Submit sends the transaction pointing name at cid, signed by auth, and returns its pending job.
+// Errors the contract would revert with, such as ownership, are returned at once. A name whose
+// registration is still pending is updated rather than registered again; callers building cid on
+// the name's current root hold Resolver.LockName and start from PendingRoot.
+func (q *Queue) Submit(auth *bind.TransactOpts, name, cid string) (*Job, error) {
+	if name == "" || cid == "" {
+		return nil, errors.New("name and CID cannot be empty")
+	}
+	if err := resolver.CheckNameDepth(name); err != nil {
+		return nil, err
+	}
+	cid, err := merkledag.NormalizeCID(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Same ownership checks as Resolver.UpdateMapping
+	if err := q.resolver.CheckSubname(auth.From, name); err != nil {
+		return nil, err
+	}
+	owner, err := q.contract.GetOwner(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owner of %s: %w", name, err)
+	}
+	method := contract.MethodRegister
+	if owner == (common.Address{}) {
+		// A registration that is not mined yet claims the name first. The update cannot be
+		// estimated against the chain, where the name is still unregistered, so its gas is fixed.
+		if registrant, ok := q.pendingAccount(name); ok {
+			owner = common.HexToAddress(registrant)
+			opts := *auth
+			opts.GasLimit = pendingUpdateGas
+			auth = &opts
+		}
+	}
+	if owner != (common.Address{}) {
+		if owner != auth.From {
+			return nil, resolver.ErrNotAuthorized
+		}
+		method = contract.MethodUpdateCID
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	// Pinned before the transaction is sent, so GC cannot collect the root while it is pending
+	if err := q.pinner.PinJob(id, cid); err != nil {
+		return nil, fmt.Errorf("failed to pin %s for job %s: %w", cid, id, err)
+	}
+	job, err := q.start(auth, &Job{ID: id, Name: name, CID: cid, Method: method})
+	if err != nil {
+		q.unpin(id)
+		return nil, err
+	}
+	return job, nil
+}
+
+// SubmitTransfer sends the transaction handing name to newOwner, signed by auth, and returns its
+// pending job. A parent owner transferring one of its subnames delegates it to newOwner once the
+// transfer is mined, as Resolver.TransferOwnership does.
+func (q *Queue) SubmitTransfer(auth *bind.TransactOpts, name string, newOwner common.Address) (*Job, error) {
+	if name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+	if newOwner == (common.Address{}) {
+		return nil, errors.New("new owner cannot be the zero address")
+	}
+
+	// Same ownership checks as Resolver.TransferOwnership
+	owner, err := q.contract.GetOwner(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owner of %s: %w", name, err)
+	}
+	if owner == (common.Address{}) {
+		return nil, fmt.Errorf("%w: %s", resolver.ErrNotFound, name)
+	}
+	if owner != auth.From {
+		return nil, resolver.ErrNotAuthorized
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	return q.start(auth, &Job{ID: id, Name: name, NewOwner: newOwner.Hex(), Method: contract.MethodTransferOwnership})
+}
+
+// start sends the first transaction of job, saves it and watches it in the background
+func (q *Queue) start(auth *bind.TransactOpts, job *Job) (*Job, error) {
+	opts := *auth
+	opts.Context = nil // The request context ends before the job does
+	tx, err := q.send(&opts, job)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job.Account = auth.From.Hex()
+	job.State = Pending
+	job.TxHash = tx.Hash().Hex()
+	job.TxHashes = []string{job.TxHash}
+	job.Attempts = 1
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if err := q.save(job); err != nil {
+		return nil, err // The transaction may still be mined, so a pinned root stays pinned
+	}
+	q.addPending(job)
+	log.Printf("Job %s: sent %s of %s to %s in transaction %s", job.ID, job.Method, job.Name, job.target(), job.TxHash)
+
+	submitted := *job // The watcher updates job concurrently
+	go q.watch(job, &opts, tx)
+	return &submitted, nil
+}
+
+// send sends the contract call of job with opts
+func (q *Queue) send(opts *bind.TransactOpts, job *Job) (*types.Transaction, error) {
+	if job.Method == contract.MethodTransferOwnership {
+		return q.contract.SendTransfer(opts, job.Name, common.HexToAddress(job.NewOwner))
+	}
+	return q.contract.Send(opts, job.Method, job.Name, job.CID)
+}
+
+// target returns what a job points its name at: the new CID, or the new owner of a transfer
+func (j *Job) target() string {
+	if j.Method == contract.MethodTransferOwnership {
+		return j.NewOwner
+	}
+	return j.CID
+}
+
+// Get returns a job by ID
+func (q *Queue) Get(id string) (*Job, error) {
+	data, err := q.store.Get([]byte(jobKeyPrefix + id))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job %s: %w", id, err)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// Done reports whether job id was mined or failed; a job that is not found counts as done
+func (q *Queue) Done(id string) (bool, error) {
+	job, err := q.Get(id)
+	if errors.Is(err, ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return job.State != Pending, nil
+}
+
+// watch polls the receipts of a job's transactions until one is mined. When the latest
+// transaction times out it is replaced using auth; with no auth the job fails instead.
+func (q *Queue) watch(job *Job, auth *bind.TransactOpts, tx *types.Transaction) {
+	deadline := time.Now().Add(q.Timeout)
+	ticker := time.NewTicker(q.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := q.findReceipt(job)
+		if err != nil {
+			log.Printf("Job %s: failed to check receipts: %v", job.ID, err)
+		}
+		if receipt != nil {
+			q.finish(job, receipt)
+			return
+		}
+
+		if time.Now().After(deadline) {
+			if auth == nil || tx == nil || job.Attempts >= q.MaxAttempts {
+				q.fail(job, fmt.Sprintf("not mined after %d attempts", job.Attempts))
+				return
+			}
+			replacement, err := q.replace(auth, job, tx)
+			if err != nil {
+				// An earlier transaction may have been mined meanwhile ("nonce too low"), so keep polling
+				log.Printf("Job %s: failed to replace transaction %s: %v", job.ID, tx.Hash().Hex(), err)
+			} else {
+				tx = replacement
+			}
+			deadline = time.Now().Add(q.Timeout)
+		}
+		<-ticker.C
+	}
+}
+
+// findReceipt returns the receipt of whichever transaction of job was mined, if any
+func (q *Queue) findReceipt(job *Job) (*types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), q.PollInterval*5)
+	defer cancel()
+	for _, hash := range job.TxHashes {
+		receipt, err := q.contract.Receipt(ctx, common.HexToHash(hash))
+		if err != nil || receipt != nil {
+			return receipt, err
+		}
+	}
+	return nil, nil
+}
+
+// replace resends the call of tx with the same nonce and fees raised by bumpFee
+func (q *Queue) replace(auth *bind.TransactOpts, job *Job, tx *types.Transaction) (*types.Transaction, error) {
+	opts := *auth
+	opts.Nonce = new(big.Int).SetUint64(tx.Nonce())
+	opts.GasLimit = tx.Gas()
+	if tx.Type() == types.LegacyTxType {
+		opts.GasPrice = bumpFee(tx.GasPrice())
+	} else {
+		opts.GasFeeCap = bumpFee(tx.GasFeeCap())
+		opts.GasTipCap = bumpFee(tx.GasTipCap())
+	}
+
+	replacement, err := q.send(&opts, job)
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	job.TxHash = replacement.Hash().Hex()
+	job.TxHashes = append(job.TxHashes, job.TxHash)
+	job.Attempts++
+	job.UpdatedAt = time.Now().UTC()
+	err = q.saveLocked(job)
+	q.mu.Unlock()
+	if err != nil {
+		log.Printf("Job %s: failed to save: %v", job.ID, err)
+	}
+	log.Printf("Job %s: replaced transaction %s with %s", job.ID, tx.Hash().Hex(), job.TxHash)
+	return replacement, nil
+}
+
+// finish records the receipt of a mined job and refreshes the resolver's view of its name
+func (q *Queue) finish(job *Job, receipt *types.Receipt) {
+	state, reason := Mined, ""
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		state, reason = Failed, contract.ErrTxReverted.Error()
+	}
+
+	switch {
+	case state == Mined && job.Method == contract.MethodTransferOwnership:
+		if _, err := q.resolver.Refresh(job.Name); err != nil {
+			log.Printf("Job %s: failed to refresh %s: %v", job.ID, job.Name, err)
+		}
+		if err := q.resolver.DelegateTransferred(common.HexToAddress(job.Account), job.Name, common.HexToAddress(job.NewOwner)); err != nil {
+			log.Printf("Job %s: failed to delegate %s to %s: %v", job.ID, job.Name, job.NewOwner, err)
+		}
+	case state == Mined:
+		q.pinMined(job)
+	default:
+		q.unpin(job.ID)
+	}
+
+	// The job is marked done only once the name and pins reflect it, and the pending root stays
+	// visible until the resolver has read the mined one
+	q.mu.Lock()
+	job.Receipt = &Receipt{
+		TxHash:      receipt.TxHash.Hex(),
+		BlockNumber: receipt.BlockNumber.Uint64(),
+		BlockHash:   receipt.BlockHash.Hex(),
+		GasUsed:     receipt.GasUsed,
+		Status:      receipt.Status,
+	}
+	job.State = state
+	if reason != "" {
+		job.Error = reason
+	}
+	job.UpdatedAt = time.Now().UTC()
+	q.removePending(job)
+	err := q.saveLocked(job)
+	q.mu.Unlock()
+	if err != nil {
+		log.Printf("Job %s: failed to save: %v", job.ID, err)
+	}
+	log.Printf("Job %s: transaction %s %s in block %d", job.ID, job.Receipt.TxHash, job.State, job.Receipt.BlockNumber)
+}
+
+// pinMined moves the name pin of a mined job's name to the name's root on the chain. That is
+// the root of the newest mined update, which need not be job's when receipts are processed out
+// of order, so job's root is not pinned for the name unless it is the chain's. The job pin and
+// those of jobs held before it are released once the name pin is in place.
+func (q *Queue) pinMined(job *Job) {
+	q.pinMu.Lock()
+	defer q.pinMu.Unlock()
+
+	current, err := q.resolver.Refresh(job.Name)
+	if err == nil {
+		current, err = merkledag.NormalizeCID(current)
+	}
+	if err != nil {
+		log.Printf("Job %s: failed to read the root of %s, keeping %s pinned: %v", job.ID, job.Name, job.CID, err)
+		q.hold(job)
+		return
+	}
+	if err := q.pinner.PinName(job.Name, current); err != nil {
+		log.Printf("Job %s: failed to pin %s for name %s, keeping %s pinned: %v", job.ID, current, job.Name, job.CID, err)
+		q.hold(job)
+		return
+	}
+	if current != job.CID {
+		log.Printf("Job %s: %s is no longer the root of %s, a later update already moved it to %s", job.ID, job.CID, job.Name, current)
+	}
+	q.unpin(job.ID)
+
+	// Transactions sent before this one were mined or replaced by now
+	q.mu.Lock()
+	var released []string
+	var kept []heldJob
+	for _, held := range q.held[job.Name] {
+		if held.created.Before(job.CreatedAt) {
+			released = append(released, held.id)
+		} else {
+			kept = append(kept, held)
+		}
+	}
+	if len(kept) == 0 {
+		delete(q.held, job.Name)
+	} else {
+		q.held[job.Name] = kept
+	}
+	q.mu.Unlock()
+	for _, id := range released {
+		q.unpin(id)
+	}
+}
+
+// hold keeps the root of a done job pinned until a later update of its name is mined
+func (q *Queue) hold(job *Job) {
+	if job.Method == contract.MethodTransferOwnership {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.held[job.Name] = append(q.held[job.Name], heldJob{id: job.ID, created: job.CreatedAt})
+}
+
+// fail marks a job failed. Its transactions may still be mined, so its root stays pinned.
+func (q *Queue) fail(job *Job, reason string) {
+	q.mu.Lock()
+	job.State = Failed
+	job.Error = reason
+	job.UpdatedAt = time.Now().UTC()
+	q.removePending(job)
+	err := q.saveLocked(job)
+	q.mu.Unlock()
+	if err != nil {
+		log.Printf("Job %s: failed to save: %v", job.ID, err)
+	}
+	q.hold(job)
+	log.Printf("Job %s: failed: %s", job.ID, reason)
+}
+
+// unpin drops the pin of a job's root
+func (q *Queue) unpin(id string) {
+	if err := q.pinner.UnpinJob(id); err != nil {
+		log.Printf("Job %s: failed to unpin: %v", id, err)
+	}
+}
+
+// save persists a job
+func (q *Queue) save(job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.saveLocked(job)
+}
+
+// saveLocked persists a job; q.mu must be held
+func (q *Queue) saveLocked(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := q.store.Put([]byte(jobKeyPrefix+job.ID), data); err != nil {
+		return fmt.Errorf("failed to save job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// bumpFee raises a fee by 12.5%, above the 10% nodes require to accept a replacement
+func bumpFee(fee *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(9))
+	bumped.Div(bumped, big.NewInt(8))
+	return bumped.Add(bumped, big.NewInt(1))
+}
+
+// newJobID returns a random job ID
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
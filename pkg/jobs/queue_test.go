@@ -0,0 +1,297 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ipfs-gin-example/pkg/contract/contracttest"
+	"ipfs-gin-example/pkg/jobs"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+const cidA = "bafkreifhfgbgpbk3tj6jnkd5vhl67jnbnclsxqrpmo3zk4qqe7gel2tfta"
+
+// waitDone polls a job until it leaves the pending state
+func waitDone(t *testing.T, q *jobs.Queue, id string) *jobs.Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", id, err)
+		}
+		if job.State != jobs.Pending {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s still pending", id)
+	return nil
+}
+
+func TestSubmitMinesAndRefreshes(t *testing.T) {
+	chain := contracttest.New(t, 2)
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	r := resolver.NewResolver(chain.Client, pinner)
+	q := jobs.NewQueue(store, chain.Client, r, pinner, time.Minute, 3)
+	q.PollInterval = 10 * time.Millisecond
+
+	job, err := q.Submit(chain.Accounts[0], "example.com", cidA)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if job.State != jobs.Pending || job.TxHash == "" {
+		t.Fatalf("submitted job = %+v, want pending with a transaction", job)
+	}
+
+	done := waitDone(t, q, job.ID)
+	if done.State != jobs.Mined || done.Receipt == nil || done.Receipt.TxHash != job.TxHash {
+		t.Fatalf("job = %+v, want mined with the receipt of %s", done, job.TxHash)
+	}
+	if cid, err := r.ResolveDomain("example.com"); err != nil || cid != cidA {
+		t.Fatalf("ResolveDomain = %q, %v; want %q", cid, err, cidA)
+	}
+
+	if _, err := q.Submit(chain.Accounts[1], "example.com", cidA); !errors.Is(err, resolver.ErrNotAuthorized) {
+		t.Fatalf("Submit by another account = %v, want ErrNotAuthorized", err)
+	}
+	deep := "example.com" + strings.Repeat("/sub", 64)
+	if _, err := q.Submit(chain.Accounts[0], deep, cidA); err == nil || err.Error() != resolver.CheckNameDepth(deep).Error() {
+		t.Fatalf("Submit of a name deeper than names may be = %v, want the depth error", err)
+	}
+	if _, err := q.Get("unknown"); !errors.Is(err, jobs.ErrNotFound) {
+		t.Fatalf("Get(unknown) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPendingJobSurvivesGC(t *testing.T) {
+	chain := contracttest.New(t, 1)
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	if err := pinner.BackfillNames(nil); err != nil {
+		t.Fatalf("BackfillNames: %v", err)
+	}
+	dag := merkledag.NewDAGBuilder(store)
+	q := jobs.NewQueue(store, chain.Client, resolver.NewResolver(chain.Client, pinner), pinner, time.Minute, 3)
+	q.PollInterval = 10 * time.Millisecond
+
+	root, _, err := dag.BuildDAGFromReader(strings.NewReader("uploaded before its name is mined"), merkledag.NewChunker(8))
+	if err != nil {
+		t.Fatalf("BuildDAGFromReader: %v", err)
+	}
+	release := chain.HoldMining()
+	job, err := q.Submit(chain.Accounts[0], "example.com", root)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	if _, err := pinner.GC(context.Background(), dag, false); err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if complete, err := dag.HasDAG(context.Background(), root); err != nil || !complete {
+		t.Fatalf("HasDAG after GC with a pending job = %v, %v, want the root kept", complete, err)
+	}
+
+	release()
+	chain.Backend.Commit()
+	if done := waitDone(t, q, job.ID); done.State != jobs.Mined {
+		t.Fatalf("job = %+v, want mined", done)
+	}
+	pins, err := pinner.Pins(context.Background())
+	if err != nil {
+		t.Fatalf("Pins: %v", err)
+	}
+	if len(pins) != 1 || pins[0].Mode != pin.Name || pins[0].Name != "example.com" || pins[0].CID != root {
+		t.Fatalf("pins after mining = %+v, want only the name pin of example.com", pins)
+	}
+}
+
+func TestSubmitTransfer(t *testing.T) {
+	chain := contracttest.New(t, 2)
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	r := resolver.NewResolver(chain.Client, pinner)
+	q := jobs.NewQueue(store, chain.Client, r, pinner, time.Minute, 3)
+	q.PollInterval = 10 * time.Millisecond
+
+	owner, recipient := chain.Accounts[0], chain.Accounts[1]
+	if done := waitDone(t, q, submit(t, q, owner, "example.com")); done.State != jobs.Mined {
+		t.Fatalf("register job = %+v, want mined", done)
+	}
+	if _, err := q.SubmitTransfer(recipient, "example.com", recipient.From); !errors.Is(err, resolver.ErrNotAuthorized) {
+		t.Fatalf("SubmitTransfer by another account = %v, want ErrNotAuthorized", err)
+	}
+
+	job, err := q.SubmitTransfer(owner, "example.com", recipient.From)
+	if err != nil {
+		t.Fatalf("SubmitTransfer: %v", err)
+	}
+	if done := waitDone(t, q, job.ID); done.State != jobs.Mined || done.NewOwner != recipient.From.Hex() {
+		t.Fatalf("transfer job = %+v, want mined to %s", done, recipient.From.Hex())
+	}
+	if got, err := chain.Client.GetOwner("example.com"); err != nil || got != recipient.From {
+		t.Fatalf("owner after transfer = %s, %v; want %s", got.Hex(), err, recipient.From.Hex())
+	}
+	// The new owner can now update the name through the queue
+	if done := waitDone(t, q, submit(t, q, recipient, "example.com")); done.State != jobs.Mined {
+		t.Fatalf("update by the new owner = %+v, want mined", done)
+	}
+}
+
+// submit queues an update of name to cidA and returns the job ID
+func submit(t *testing.T, q *jobs.Queue, auth *bind.TransactOpts, name string) string {
+	t.Helper()
+	job, err := q.Submit(auth, name, cidA)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	return job.ID
+}
+
+func TestUpdatesBuildOnPendingRoot(t *testing.T) {
+	chain := contracttest.New(t, 2)
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	r := resolver.NewResolver(chain.Client, pinner)
+	q := jobs.NewQueue(store, chain.Client, r, pinner, time.Minute, 3)
+	q.PollInterval = 10 * time.Millisecond
+	const cidB = "bafkreidd3lbo3mrsutwru2tib4h6d3ivi73nb4ss74lkoi63jiq5vhxc5y"
+
+	// Both updates are sent before the registration is mined
+	release := chain.HoldMining()
+	first, err := q.Submit(chain.Accounts[0], "example.com", cidA)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if root, ok := q.PendingRoot("example.com"); !ok || root != cidA {
+		t.Fatalf("PendingRoot = %q, %v; want %q", root, ok, cidA)
+	}
+	if _, err := q.Submit(chain.Accounts[1], "example.com", cidB); !errors.Is(err, resolver.ErrNotAuthorized) {
+		t.Fatalf("Submit by another account during a pending registration = %v, want ErrNotAuthorized", err)
+	}
+	second, err := q.Submit(chain.Accounts[0], "example.com", cidB)
+	if err != nil {
+		t.Fatalf("Submit during a pending registration: %v", err)
+	}
+	if first.Method != "register" || second.Method != "updateCID" {
+		t.Fatalf("methods = %s, %s; want register, updateCID", first.Method, second.Method)
+	}
+	if root, ok := q.PendingRoot("example.com"); !ok || root != cidB {
+		t.Fatalf("PendingRoot = %q, %v; want %q", root, ok, cidB)
+	}
+
+	release()
+	chain.Backend.Commit()
+	for _, job := range []*jobs.Job{first, second} {
+		if done := waitDone(t, q, job.ID); done.State != jobs.Mined {
+			t.Fatalf("job = %+v, want mined", done)
+		}
+	}
+	if cid, err := r.ResolveDomain("example.com"); err != nil || cid != cidB {
+		t.Fatalf("ResolveDomain = %q, %v; want %q", cid, err, cidB)
+	}
+	if root, ok := q.PendingRoot("example.com"); ok {
+		t.Fatalf("PendingRoot after mining = %q, want none", root)
+	}
+}
+
+// pinsOf returns the pins of pinner
+func pinsOf(t *testing.T, pinner *pin.Pinner) []pin.Pin {
+	t.Helper()
+	pins, err := pinner.Pins(context.Background())
+	if err != nil {
+		t.Fatalf("Pins: %v", err)
+	}
+	return pins
+}
+
+func TestOutOfOrderReceiptsPinNewestRoot(t *testing.T) {
+	chain := contracttest.New(t, 1)
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	r := resolver.NewResolver(chain.Client, pinner)
+	q := jobs.NewQueue(store, chain.Client, r, pinner, time.Minute, 3)
+	q.PollInterval = 10 * time.Millisecond
+	const cidB = "bafkreidd3lbo3mrsutwru2tib4h6d3ivi73nb4ss74lkoi63jiq5vhxc5y"
+	const cidC = "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+	waitDone(t, q, submit(t, q, chain.Accounts[0], "example.com"))
+
+	// The older update is sent through a queue that does not check its receipt again during the test
+	stalled := jobs.NewQueue(store, chain.Client, r, pinner, time.Minute, 3)
+	stalled.PollInterval = time.Hour
+	release := chain.HoldMining()
+	older, err := stalled.Submit(chain.Accounts[0], "example.com", cidB)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	newer, err := q.Submit(chain.Accounts[0], "example.com", cidC)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	release()
+	chain.Backend.Commit()
+	if done := waitDone(t, q, newer.ID); done.State != jobs.Mined {
+		t.Fatalf("newer job = %+v, want mined", done)
+	}
+
+	// The older job's receipt is processed last, by a queue resuming it
+	resumed := jobs.NewQueue(store, chain.Client, r, pinner, time.Minute, 3)
+	resumed.PollInterval = 10 * time.Millisecond
+	if err := resumed.Resume(context.Background()); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	if done := waitDone(t, resumed, older.ID); done.State != jobs.Mined {
+		t.Fatalf("older job = %+v, want mined", done)
+	}
+	if cid, err := r.ResolveDomain("example.com"); err != nil || cid != cidC {
+		t.Fatalf("ResolveDomain = %q, %v; want %q", cid, err, cidC)
+	}
+	if pins := pinsOf(t, pinner); len(pins) != 1 || pins[0].Mode != pin.Name || pins[0].CID != cidC {
+		t.Fatalf("pins = %+v, want only the name pin of example.com on the newer root", pins)
+	}
+}
+
+func TestTimedOutJobKeepsPin(t *testing.T) {
+	chain := contracttest.New(t, 1)
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	r := resolver.NewResolver(chain.Client, pinner)
+	q := jobs.NewQueue(store, chain.Client, r, pinner, 20*time.Millisecond, 1)
+	q.PollInterval = 10 * time.Millisecond
+	const cidB = "bafkreidd3lbo3mrsutwru2tib4h6d3ivi73nb4ss74lkoi63jiq5vhxc5y"
+
+	release := chain.HoldMining()
+	job, err := q.Submit(chain.Accounts[0], "example.com", cidA)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if done := waitDone(t, q, job.ID); done.State != jobs.Failed {
+		t.Fatalf("job = %+v, want failed", done)
+	}
+	// The transaction can still be mined, so its root stays pinned
+	if pins := pinsOf(t, pinner); len(pins) != 1 || pins[0].Mode != pin.Job || pins[0].CID != cidA {
+		t.Fatalf("pins after the timeout = %+v, want the job pin of %s", pins, cidA)
+	}
+
+	release()
+	chain.Backend.Commit()
+	later, err := q.Submit(chain.Accounts[0], "example.com", cidB)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if done := waitDone(t, q, later.ID); done.State != jobs.Mined {
+		t.Fatalf("later job = %+v, want mined", done)
+	}
+	if pins := pinsOf(t, pinner); len(pins) != 1 || pins[0].Mode != pin.Name || pins[0].CID != cidB {
+		t.Fatalf("pins after a later update = %+v, want only the name pin on %s", pins, cidB)
+	}
+}
@@ -0,0 +1,129 @@
+package merkledag
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// gearTable maps each byte value to a pseudo-random 64-bit value for the rolling hash.
+// It is generated from a fixed seed, so chunk boundaries never change between builds.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x6a09e667f3bcc908)
+	for i := range table {
+		// splitmix64
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// CDCChunker is a content-defined chunker. It cuts chunks where a rolling hash of the
+// content matches a mask, so inserting or removing bytes only changes the chunks around
+// the edit and the rest of the file keeps its CIDs.
+// The rolling hash is a gear hash with normalized chunking (as in FastCDC), which finds
+// boundaries the same way a Rabin fingerprint does but is much cheaper to compute.
+type CDCChunker struct {
+	minSize   int
+	avgSize   int
+	maxSize   int
+	maskSmall uint64 // stricter mask used before avgSize, makes early cuts less likely
+	maskLarge uint64 // looser mask used after avgSize, makes late cuts more likely
+}
+
+// NewCDCChunker creates a content-defined Chunker with the given chunk size bounds
+func NewCDCChunker(minSize, avgSize, maxSize int) (*CDCChunker, error) {
+	if minSize <= 0 || minSize > avgSize || avgSize > maxSize {
+		return nil, fmt.Errorf("invalid chunk sizes min=%d avg=%d max=%d: need 0 < min <= avg <= max", minSize, avgSize, maxSize)
+	}
+	if maxSize > MaxChunkSize {
+		return nil, fmt.Errorf("max chunk size %d exceeds %d bytes", maxSize, MaxChunkSize)
+	}
+
+	avgBits := bits.Len(uint(avgSize)) - 1
+	return &CDCChunker{
+		minSize:   minSize,
+		avgSize:   avgSize,
+		maxSize:   maxSize,
+		maskSmall: highBitsMask(avgBits + 1),
+		maskLarge: highBitsMask(max(avgBits-1, 1)),
+	}, nil
+}
+
+// highBitsMask returns a mask of the n most significant bits.
+// The gear hash shifts left on every byte, so its high bits depend on the most input.
+func highBitsMask(n int) uint64 {
+	return ^uint64(0) << (64 - n)
+}
+
+// NewSplitter implements Chunker
+func (c *CDCChunker) NewSplitter(r io.Reader) Splitter {
+	return &cdcSplitter{chunker: c, r: r, buf: make([]byte, 0, c.maxSize)}
+}
+
+// String implements Chunker
+func (c *CDCChunker) String() string {
+	return fmt.Sprintf("rabin-%d-%d-%d", c.minSize, c.avgSize, c.maxSize)
+}
+
+// cutPoint returns the length of the first chunk in data
+func (c *CDCChunker) cutPoint(data []byte) int {
+	n := len(data)
+	if n <= c.minSize {
+		return n
+	}
+	if n > c.maxSize {
+		n = c.maxSize
+	}
+	normal := min(c.avgSize, n)
+
+	var hash uint64
+	i := c.minSize
+	for ; i < normal; i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+		if hash&c.maskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+		if hash&c.maskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// cdcSplitter is the Splitter of a CDCChunker. It buffers at most maxSize bytes.
+type cdcSplitter struct {
+	chunker *CDCChunker
+	r       io.Reader
+	buf     []byte // unread data, never longer than maxSize
+	eof     bool
+}
+
+// NextChunk implements Splitter
+func (s *cdcSplitter) NextChunk() ([]byte, error) {
+	if !s.eof && len(s.buf) < s.chunker.maxSize {
+		n, err := io.ReadFull(s.r, s.buf[len(s.buf):s.chunker.maxSize])
+		s.buf = s.buf[:len(s.buf)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			s.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(s.buf) == 0 {
+		return nil, io.EOF
+	}
+
+	cut := s.chunker.cutPoint(s.buf)
+	chunk := make([]byte, cut)
+	copy(chunk, s.buf[:cut])
+	s.buf = s.buf[:copy(s.buf, s.buf[cut:])]
+	return chunk, nil
+}
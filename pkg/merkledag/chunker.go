@@ -1,38 +1,152 @@
 package merkledag
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"strconv"
+	"strings"
 )
 
-// Chunker splits content into fixed-size chunks
-type Chunker struct {
+// MaxChunkSize is the largest chunk any chunker is allowed to produce.
+const MaxChunkSize = 1 << 20 // 1MB
+
+// Chunker splits content into chunks. Implementations must be deterministic:
+// the same content split by chunkers with the same String() always yields the same chunks.
+type Chunker interface {
+	// NewSplitter returns a Splitter that reads chunks from r.
+	NewSplitter(r io.Reader) Splitter
+	// String returns the canonical spec of the chunker, as accepted by ParseChunker.
+	String() string
+}
+
+// Splitter yields the chunks of a single stream
+type Splitter interface {
+	// NextChunk returns the next chunk, or io.EOF once the stream is exhausted.
+	NextChunk() ([]byte, error)
+}
+
+// SizeChunker splits content into fixed-size chunks
+type SizeChunker struct {
 	chunkSize int
 }
 
-// NewChunker creates a new Chunker
-func NewChunker(chunkSize int) *Chunker {
-	return &Chunker{chunkSize: chunkSize}
+// NewChunker creates a new fixed-size Chunker
+func NewChunker(chunkSize int) *SizeChunker {
+	return &SizeChunker{chunkSize: chunkSize}
+}
+
+// NewSplitter implements Chunker
+func (c *SizeChunker) NewSplitter(r io.Reader) Splitter {
+	return &sizeSplitter{r: r, chunkSize: c.chunkSize}
+}
+
+// String implements Chunker
+func (c *SizeChunker) String() string {
+	return fmt.Sprintf("size-%d", c.chunkSize)
+}
+
+// sizeSplitter is the Splitter of a SizeChunker
+type sizeSplitter struct {
+	r         io.Reader
+	chunkSize int
+}
+
+// NextChunk reads the next chunk. Every chunk except the last one is exactly
+// chunkSize bytes long, regardless of how the underlying reader splits its reads,
+// so the same content always produces the same chunks.
+func (s *sizeSplitter) NextChunk() ([]byte, error) {
+	buf := make([]byte, s.chunkSize)
+	n, err := io.ReadFull(s.r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, io.EOF
+	}
+	// A short final chunk is not an error
+	return buf[:n], nil
 }
 
 // Chunk reads from an io.Reader and returns a list of Node representing the chunks
-func (c *Chunker) Chunk(r io.Reader) ([]*Node, error) {
+func Chunk(c Chunker, r io.Reader) ([]*Node, error) {
 	var blocks []*Node
-	buf := make([]byte, c.chunkSize)
-
+	splitter := c.NewSplitter(r)
 	for {
-		n, err := r.Read(buf)
-		if n > 0 {
-			chunkData := make([]byte, n)
-			copy(chunkData, buf[:n])
-			node := &Node{Data: chunkData}
-			blocks = append(blocks, node)
+		chunkData, err := splitter.NextChunk()
+		if err == io.EOF {
+			break
 		}
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
 			return nil, err
 		}
+		blocks = append(blocks, &Node{Data: chunkData})
 	}
 	return blocks, nil
 }
+
+// ParseChunker builds a Chunker from a spec string:
+//
+//	""                  fixed-size chunks of defaultSize bytes
+//	"size-N"            fixed-size chunks of N bytes
+//	"rabin"             content-defined chunks averaging defaultSize bytes
+//	"rabin-AVG"         content-defined chunks averaging AVG bytes
+//	"rabin-MIN-AVG-MAX" content-defined chunks with explicit bounds
+//
+// Sizes accept a "k" or "m" suffix, e.g. "rabin-16k-64k-256k".
+func ParseChunker(spec string, defaultSize int) (Chunker, error) {
+	if spec == "" {
+		return NewChunker(defaultSize), nil
+	}
+
+	parts := strings.Split(strings.ToLower(spec), "-")
+	sizes := make([]int, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		size, err := parseChunkSize(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunker spec %q: %w", spec, err)
+		}
+		sizes = append(sizes, size)
+	}
+
+	switch parts[0] {
+	case "size":
+		if len(sizes) != 1 {
+			return nil, fmt.Errorf("invalid chunker spec %q: expected size-N", spec)
+		}
+		if sizes[0] > MaxChunkSize {
+			return nil, fmt.Errorf("invalid chunker spec %q: chunk size exceeds %d bytes", spec, MaxChunkSize)
+		}
+		return NewChunker(sizes[0]), nil
+	case "rabin":
+		switch len(sizes) {
+		case 0:
+			return NewCDCChunker(defaultSize/4, defaultSize, defaultSize*4)
+		case 1:
+			return NewCDCChunker(sizes[0]/4, sizes[0], sizes[0]*4)
+		case 3:
+			return NewCDCChunker(sizes[0], sizes[1], sizes[2])
+		}
+		return nil, fmt.Errorf("invalid chunker spec %q: expected rabin, rabin-AVG or rabin-MIN-AVG-MAX", spec)
+	}
+	return nil, fmt.Errorf("unknown chunker %q", parts[0])
+}
+
+// parseChunkSize parses a positive byte count with an optional k/m suffix
+func parseChunkSize(s string) (int, error) {
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier, s = 1<<10, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		multiplier, s = 1<<20, strings.TrimSuffix(s, "m")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, errors.New("chunk size must be positive")
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,175 @@
+package merkledag_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"testing"
+	"testing/iotest"
+
+	"ipfs-gin-example/pkg/merkledag"
+)
+
+// randomBytes returns n pseudo-random bytes, the same for the same seed
+func randomBytes(seed byte, n int) []byte {
+	data := make([]byte, n)
+	rand.NewChaCha8([32]byte{seed}).Read(data)
+	return data
+}
+
+// chunks splits data with c, reading it through r
+func chunks(t *testing.T, c merkledag.Chunker, r io.Reader) [][]byte {
+	t.Helper()
+	var chunks [][]byte
+	splitter := c.NewSplitter(r)
+	for {
+		chunk, err := splitter.NextChunk()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatalf("NextChunk: %v", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestSizeChunker(t *testing.T) {
+	data := randomBytes(1, 1000)
+	c := merkledag.NewChunker(64)
+
+	// Every chunk but the last is full, however the reader splits its reads
+	got := chunks(t, c, iotest.HalfReader(bytes.NewReader(data)))
+	if len(got) != 16 {
+		t.Fatalf("got %d chunks, want 16", len(got))
+	}
+	for i, chunk := range got[:15] {
+		if len(chunk) != 64 {
+			t.Fatalf("chunk %d has %d bytes, want 64", i, len(chunk))
+		}
+	}
+	if len(got[15]) != 1000-15*64 {
+		t.Fatalf("last chunk has %d bytes, want %d", len(got[15]), 1000-15*64)
+	}
+	if !bytes.Equal(bytes.Join(got, nil), data) {
+		t.Fatal("chunks do not add up to the content")
+	}
+
+	if got := chunks(t, c, bytes.NewReader(nil)); len(got) != 0 {
+		t.Fatalf("empty content gave %d chunks, want none", len(got))
+	}
+	if got := chunks(t, c, bytes.NewReader(data[:128])); len(got) != 2 {
+		t.Fatalf("content of exactly two chunks gave %d chunks", len(got))
+	}
+}
+
+func TestCDCChunkerBounds(t *testing.T) {
+	const minSize, avgSize, maxSize = 256, 1024, 4096
+	c, err := merkledag.NewCDCChunker(minSize, avgSize, maxSize)
+	if err != nil {
+		t.Fatalf("NewCDCChunker: %v", err)
+	}
+
+	for name, data := range map[string][]byte{
+		"random": randomBytes(2, 1<<20),
+		"zeros":  make([]byte, 100_000), // No cut point matches, so chunks run to maxSize
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := chunks(t, c, bytes.NewReader(data))
+			for i, chunk := range got {
+				last := i == len(got)-1
+				if len(chunk) > maxSize || (!last && len(chunk) < minSize) || len(chunk) == 0 {
+					t.Fatalf("chunk %d of %d has %d bytes, want %d..%d", i, len(got), len(chunk), minSize, maxSize)
+				}
+			}
+			if !bytes.Equal(bytes.Join(got, nil), data) {
+				t.Fatal("chunks do not add up to the content")
+			}
+			if name == "random" {
+				if avg := len(data) / len(got); avg < avgSize/2 || avg > avgSize*2 {
+					t.Fatalf("average chunk size %d, want about %d", avg, avgSize)
+				}
+			}
+		})
+	}
+}
+
+func TestCDCChunkerDeterministic(t *testing.T) {
+	data := randomBytes(3, 200_000)
+	c, err := merkledag.NewCDCChunker(256, 1024, 4096)
+	if err != nil {
+		t.Fatalf("NewCDCChunker: %v", err)
+	}
+
+	// The boundaries depend on the content only, not on how it is read
+	want := chunks(t, c, bytes.NewReader(data))
+	for name, r := range map[string]io.Reader{
+		"one byte":  iotest.OneByteReader(bytes.NewReader(data)),
+		"half read": iotest.HalfReader(bytes.NewReader(data)),
+	} {
+		if got := chunks(t, c, r); !equalChunks(got, want) {
+			t.Fatalf("%s reader gave other chunks", name)
+		}
+	}
+
+	// An edit near the start only changes the chunks around it
+	edited := append([]byte("inserted"), data...)
+	got := chunks(t, c, bytes.NewReader(edited))
+	shared := 0
+	seen := make(map[string]bool)
+	for _, chunk := range want {
+		seen[string(chunk)] = true
+	}
+	for _, chunk := range got {
+		if seen[string(chunk)] {
+			shared++
+		}
+	}
+	if shared < len(want)-3 {
+		t.Fatalf("only %d of %d chunks kept after an insert at the start", shared, len(want))
+	}
+}
+
+// equalChunks reports whether a and b are the same chunks
+func equalChunks(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseChunker(t *testing.T) {
+	for _, tt := range []struct {
+		spec string
+		want string
+	}{
+		{"", "size-1024"},
+		{"size-4k", "size-4096"},
+		{"rabin", "rabin-256-1024-4096"},
+		{"rabin-64k", "rabin-16384-65536-262144"},
+		{"Rabin-16k-64k-256k", "rabin-16384-65536-262144"},
+	} {
+		c, err := merkledag.ParseChunker(tt.spec, 1024)
+		if err != nil {
+			t.Fatalf("ParseChunker(%q): %v", tt.spec, err)
+		}
+		if c.String() != tt.want {
+			t.Fatalf("ParseChunker(%q) = %s, want %s", tt.spec, c, tt.want)
+		}
+		// String is a spec ParseChunker accepts again
+		if again, err := merkledag.ParseChunker(c.String(), 1024); err != nil || again.String() != tt.want {
+			t.Fatalf("ParseChunker(%q) = %v, %v; want %s", c.String(), again, err, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"size", "size-0", "size-2m", "size-x", "rabin-1-2", "rabin-4k-2k-8k", "rabin-1m-1m-2m", "buzhash"} {
+		if _, err := merkledag.ParseChunker(spec, 1024); err == nil {
+			t.Fatalf("ParseChunker(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package merkledag
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Multicodec codes for the block formats a CID can point to
+const (
+	CodecRaw   uint64 = 0x55   // Raw leaf data
+	CodecDagPB uint64 = 0x70   // dag-pb encoded Node
+	CodecJSON  uint64 = 0x0200 // JSON-encoded Node, written before dag-pb was introduced
+)
+
+const (
+	cidVersion1     uint64 = 1
+	multihashSHA256 uint64 = 0x12
+	// multibaseBase32 is the multibase prefix of lowercase, unpadded RFC 4648 base32
+	multibaseBase32 = 'b'
+)
+
+// base32Encoding is the base32 alphabet used by CIDv1 strings
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ErrInvalidCID is returned when a string or byte slice is not a valid CID
+var ErrInvalidCID = errors.New("invalid CID")
+
+// CID is a self-describing content identifier: a codec that says how the block is
+// encoded and the SHA-256 multihash of the block bytes.
+type CID struct {
+	Codec  uint64
+	Digest []byte // SHA-256 digest of the block
+}
+
+// NewCID hashes data and returns its CID for the given codec
+func NewCID(codec uint64, data []byte) CID {
+	digest := sha256.Sum256(data)
+	return CID{Codec: codec, Digest: digest[:]}
+}
+
+// ParseCID parses a CIDv1 string (multibase base32). It also accepts the bare SHA-256 hex
+// strings used before CIDv1, which identify JSON-encoded nodes.
+func ParseCID(s string) (CID, error) {
+	if len(s) == hex.EncodedLen(sha256.Size) {
+		if digest, err := hex.DecodeString(s); err == nil {
+			return CID{Codec: CodecJSON, Digest: digest}, nil
+		}
+	}
+
+	if len(s) < 2 || s[0] != multibaseBase32 {
+		return CID{}, fmt.Errorf("%w %q: unsupported multibase", ErrInvalidCID, s)
+	}
+	data, err := base32Encoding.DecodeString(strings.ToUpper(s[1:]))
+	if err != nil {
+		return CID{}, fmt.Errorf("%w %q: %v", ErrInvalidCID, s, err)
+	}
+	c, n, err := DecodeCID(data)
+	if err != nil {
+		return CID{}, fmt.Errorf("%w %q: %v", ErrInvalidCID, s, err)
+	}
+	if n != len(data) {
+		return CID{}, fmt.Errorf("%w %q: trailing bytes", ErrInvalidCID, s)
+	}
+	return c, nil
+}
+
+// DecodeCID decodes a binary CIDv1 from the start of data and returns it with the number of bytes read
+func DecodeCID(data []byte) (CID, int, error) {
+	r := bytes.NewReader(data)
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return CID{}, 0, fmt.Errorf("failed to read CID version: %w", err)
+	}
+	if version != cidVersion1 {
+		return CID{}, 0, fmt.Errorf("unsupported CID version %d", version)
+	}
+	codec, err := binary.ReadUvarint(r)
+	if err != nil {
+		return CID{}, 0, fmt.Errorf("failed to read codec: %w", err)
+	}
+	hashCode, err := binary.ReadUvarint(r)
+	if err != nil {
+		return CID{}, 0, fmt.Errorf("failed to read multihash code: %w", err)
+	}
+	if hashCode != multihashSHA256 {
+		return CID{}, 0, fmt.Errorf("unsupported multihash function 0x%x", hashCode)
+	}
+	digestLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return CID{}, 0, fmt.Errorf("failed to read multihash length: %w", err)
+	}
+	if digestLen != sha256.Size {
+		return CID{}, 0, fmt.Errorf("invalid sha2-256 digest length %d", digestLen)
+	}
+	offset := len(data) - r.Len()
+	if r.Len() < sha256.Size {
+		return CID{}, 0, errors.New("truncated multihash digest")
+	}
+	digest := make([]byte, sha256.Size)
+	copy(digest, data[offset:])
+	return CID{Codec: codec, Digest: digest}, offset + sha256.Size, nil
+}
+
+// Bytes returns the binary CIDv1 encoding: version, codec and multihash
+func (c CID) Bytes() []byte {
+	buf := make([]byte, 0, 4*binary.MaxVarintLen64+len(c.Digest))
+	buf = binary.AppendUvarint(buf, cidVersion1)
+	buf = binary.AppendUvarint(buf, c.Codec)
+	buf = binary.AppendUvarint(buf, multihashSHA256)
+	buf = binary.AppendUvarint(buf, uint64(len(c.Digest)))
+	return append(buf, c.Digest...)
+}
+
+// String returns the CIDv1 string form (multibase base32)
+func (c CID) String() string {
+	return string(multibaseBase32) + strings.ToLower(base32Encoding.EncodeToString(c.Bytes()))
+}
+
+// Verify reports whether data hashes to this CID
+func (c CID) Verify(data []byte) bool {
+	digest := sha256.Sum256(data)
+	return bytes.Equal(digest[:], c.Digest)
+}
+
+// StoreKeys returns the keys a block may be stored under, preferred key first.
+// JSON nodes written before CIDv1 are stored under their bare hex digest.
+func (c CID) StoreKeys() [][]byte {
+	keys := [][]byte{[]byte(c.String())}
+	if c.Codec == CodecJSON {
+		keys = append(keys, []byte(hex.EncodeToString(c.Digest)))
+	}
+	return keys
+}
+
+// NormalizeCID parses a CID in any accepted form and returns its CIDv1 string
+func NormalizeCID(s string) (string, error) {
+	c, err := ParseCID(s)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
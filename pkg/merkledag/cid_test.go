@@ -0,0 +1,109 @@
+package merkledag_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"ipfs-gin-example/pkg/merkledag"
+)
+
+func TestCIDRoundTrip(t *testing.T) {
+	for _, codec := range []uint64{merkledag.CodecRaw, merkledag.CodecDagPB, merkledag.CodecJSON} {
+		c := merkledag.NewCID(codec, []byte("block"))
+		s := c.String()
+		if s[0] != 'b' || s != strings.ToLower(s) {
+			t.Fatalf("String() = %s, want lowercase base32 with the b multibase prefix", s)
+		}
+		parsed, err := merkledag.ParseCID(s)
+		if err != nil {
+			t.Fatalf("ParseCID(%s): %v", s, err)
+		}
+		if parsed.Codec != codec || !bytes.Equal(parsed.Digest, c.Digest) {
+			t.Fatalf("ParseCID(%s) = %+v, want %+v", s, parsed, c)
+		}
+		if !parsed.Verify([]byte("block")) || parsed.Verify([]byte("other")) {
+			t.Fatalf("Verify of %s does not match its block only", s)
+		}
+
+		// Binary CIDs decode from the start of longer data
+		decoded, n, err := merkledag.DecodeCID(append(c.Bytes(), "rest"...))
+		if err != nil || n != len(c.Bytes()) || decoded.String() != s {
+			t.Fatalf("DecodeCID = %s, %d, %v; want %s, %d", decoded, n, err, s, len(c.Bytes()))
+		}
+	}
+
+	// Well-known CID of the raw block "hello world"
+	const hello = "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"
+	if got := merkledag.NewCID(merkledag.CodecRaw, []byte("hello world")).String(); got != hello {
+		t.Fatalf("CID of raw %q = %s, want %s", "hello world", got, hello)
+	}
+}
+
+func TestLegacyHexCID(t *testing.T) {
+	data := []byte(`{"data":"aGVsbG8="}`)
+	digest := sha256.Sum256(data)
+	legacy := hex.EncodeToString(digest[:])
+	want := merkledag.NewCID(merkledag.CodecJSON, data)
+
+	for _, s := range []string{legacy, strings.ToUpper(legacy)} {
+		c, err := merkledag.ParseCID(s)
+		if err != nil {
+			t.Fatalf("ParseCID(%s): %v", s, err)
+		}
+		if c.Codec != merkledag.CodecJSON || !bytes.Equal(c.Digest, digest[:]) {
+			t.Fatalf("ParseCID(%s) = %+v, want a JSON node CID of the digest", s, c)
+		}
+		normalized, err := merkledag.NormalizeCID(s)
+		if err != nil || normalized != want.String() {
+			t.Fatalf("NormalizeCID(%s) = %s, %v; want %s", s, normalized, err, want)
+		}
+	}
+
+	// Normalizing is idempotent
+	if normalized, err := merkledag.NormalizeCID(want.String()); err != nil || normalized != want.String() {
+		t.Fatalf("NormalizeCID(%s) = %s, %v", want, normalized, err)
+	}
+
+	// Legacy JSON nodes are still found under their hex key
+	keys := want.StoreKeys()
+	if len(keys) != 2 || string(keys[0]) != want.String() || string(keys[1]) != legacy {
+		t.Fatalf("StoreKeys() = %q, want the CIDv1 then the legacy hex key", keys)
+	}
+	if keys := merkledag.NewCID(merkledag.CodecRaw, data).StoreKeys(); len(keys) != 1 {
+		t.Fatalf("StoreKeys() of a raw CID = %q, want only its CIDv1 key", keys)
+	}
+}
+
+// encodeCID encodes arbitrary bytes as a multibase base32 string, the way CID.String does
+func encodeCID(data []byte) string {
+	return "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(data))
+}
+
+func TestParseCIDErrors(t *testing.T) {
+	valid := merkledag.NewCID(merkledag.CodecRaw, []byte("block"))
+	for name, s := range map[string]string{
+		"empty":             "",
+		"base58 CIDv0":      "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o",
+		"not base32":        "b!!!!",
+		"short hex":         hex.EncodeToString(valid.Digest[:31]),
+		"bad hex":           strings.Repeat("zz", 32),
+		"trailing bytes":    encodeCID(append(valid.Bytes(), 0)),
+		"CID version 0":     encodeCID(append([]byte{0}, valid.Bytes()[1:]...)),
+		"sha1 multihash":    encodeCID(append([]byte{1, 0x55, 0x11, 20}, make([]byte, 20)...)),
+		"short digest":      encodeCID(append([]byte{1, 0x55, 0x12, 16}, make([]byte, 16)...)),
+		"truncated digest":  encodeCID(valid.Bytes()[:len(valid.Bytes())-1]),
+		"truncated varints": encodeCID([]byte{1}),
+	} {
+		if c, err := merkledag.ParseCID(s); !errors.Is(err, merkledag.ErrInvalidCID) {
+			t.Fatalf("%s: ParseCID(%q) = %v, %v; want ErrInvalidCID", name, s, c, err)
+		}
+		if _, err := merkledag.NormalizeCID(s); err == nil {
+			t.Fatalf("%s: NormalizeCID(%q) succeeded", name, s)
+		}
+	}
+}
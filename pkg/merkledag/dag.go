@@ -2,9 +2,10 @@ package merkledag
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"github.com/dgraph-io/badger/v4"
+	"io"
 	"ipfs-gin-example/pkg/storage"
 	"strings"
 )
@@ -21,14 +22,15 @@ func NewDAGBuilder(store storage.Store) *DAGBuilder {
 
 // AddNode stores a node and returns its CID
 func (b *DAGBuilder) AddNode(node *Node) (string, error) {
-	cid, err := node.Cid()
+	c, data, err := node.Encode()
 	if err != nil {
-		return "", fmt.Errorf("failed to get CID for node: %w", err)
+		return "", fmt.Errorf("failed to marshal node: %w", err)
 	}
 
-	data, err := node.MarshalBinary()
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal node: %w", err)
+	cid := c.String()
+	// Blocks are immutable, so a block that is already stored does not need to be written again
+	if b.stored([]byte(cid)) {
+		return cid, nil
 	}
 
 	err = b.store.Put([]byte(cid), data)
@@ -39,129 +41,161 @@ func (b *DAGBuilder) AddNode(node *Node) (string, error) {
 	return cid, nil
 }
 
-// GetNode retrieves a node by its CID
-func (b *DAGBuilder) GetNode(cid string) (*Node, error) {
-	data, err := b.store.Get([]byte(cid))
-	if err != nil {
-		return nil, fmt.Errorf("failed to get node %s from store: %w", cid, err)
+// AddNodes stores several nodes in one batch, skipping blocks the store already has.
+// It returns the CIDs of the nodes in order.
+func (b *DAGBuilder) AddNodes(nodes []*Node) ([]string, error) {
+	cids := make([]string, 0, len(nodes))
+	var blocks []storage.Block
+	for _, node := range nodes {
+		c, data, err := node.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal node: %w", err)
+		}
+		cid := c.String()
+		cids = append(cids, cid)
+
+		if b.stored([]byte(cid)) {
+			continue
+		}
+		blocks = append(blocks, storage.Block{Key: []byte(cid), Data: data})
 	}
 
-	node := &Node{}
-	err = node.UnmarshalBinary(data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal node %s: %w", cid, err)
+	if err := b.store.PutMany(blocks); err != nil {
+		return nil, fmt.Errorf("failed to store %d nodes: %w", len(blocks), err)
 	}
+	return cids, nil
+}
 
-	return node, nil
+// HasNode reports whether the block of a CID is in the store
+func (b *DAGBuilder) HasNode(cid string) (bool, error) {
+	c, err := ParseCID(cid)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range c.StoreKeys() {
+		has, err := b.store.Has(key)
+		if err != nil || has {
+			return has, err
+		}
+	}
+	return false, nil
 }
 
-// BuildDAGFromLeaves builds a DAG from a list of leaf nodes (chunks)
-// It returns the root CID of the built DAG.
-func (b *DAGBuilder) BuildDAGFromLeaves(leaves []*Node) (string, uint64, error) {
-	if len(leaves) == 0 {
-		// Handle empty content: create an empty node
-		emptyNode := &Node{}
-		cid, err := b.AddNode(emptyNode)
+// HasDAG reports whether every block of the DAG rooted at cid is stored and matches its CID
+func (b *DAGBuilder) HasDAG(ctx context.Context, cid string) (bool, error) {
+	visited := make(map[string]bool)
+	stack := []string{cid}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		c, err := ParseCID(stack[len(stack)-1])
+		stack = stack[:len(stack)-1]
 		if err != nil {
-			return "", 0, err
+			return false, err
 		}
-		return cid, 0, nil // Empty node has size 0
-	}
-
-	currentLevelNodes := leaves
-	for len(currentLevelNodes) > 1 {
-		var nextLevelNodes []*Node
-		// Group nodes into new parent nodes
-		// IPFS default fanout is around 174 links per node
-		fanout := 174
-		for i := 0; i < len(currentLevelNodes); i += fanout {
-			end := i + fanout
-			if end > len(currentLevelNodes) {
-				end = len(currentLevelNodes)
-			}
-			group := currentLevelNodes[i:end]
-
-			parentNode := &Node{}
-			var totalSize uint64 // Size of the object this node represents (sum of children's sizes)
-			for _, child := range group {
-				childCID, err := b.AddNode(child) // Store child and get its CID
-				if err != nil {
-					return "", 0, fmt.Errorf("failed to store child node: %w", err)
-				}
+		if visited[c.String()] {
+			continue
+		}
+		visited[c.String()] = true
 
-				// For chunk nodes (leaves), size is data size.
-				// For intermediate nodes, size is the sum of the sizes of objects they link to.
-				// We need the *total size* of the object represented by the childCID.
-				// If the child is a leaf, its size is len(child.Data).
-				// If the child is an intermediate node, we need its calculated size.
-				// To avoid recursive size calculation during build, let's rely on the size calculated *after* the child is built.
-				// This requires a slight change in flow: build level, then calculate sizes for parent links.
-				// Let's simplify for now and assume child.Size is sum of linked objects for non-leaves.
-				// A proper implementation would calculate size bottom-up or store it with the node.
-
-				// Simplified size calculation for this example:
-				// If the child is a leaf (no links), size is data length.
-				// If the child is an intermediate node, its size is the sum of sizes of nodes it links to.
-				// We need to *get* the child node to find its total size if it's not a leaf. This is inefficient.
-				// A better approach: Build a level -> get CIDs -> for parent links, calculate size by summing children's *total* sizes.
-				// Let's adjust: Build level, store nodes, then create parent links with calculated sizes.
-
-				// Temporary Link without size, calculate size later
-				parentNode.Links = append(parentNode.Links, Link{
-					Hash: childCID,
-					Name: "", // File chunks usually have no names in links from a file node
-					Size: 0,  //Placeholder, will calculate later
-				})
-			}
+		node, err := b.GetNode(c.String())
+		var corrupt *ErrBlockCorrupt
+		if errors.Is(err, storage.ErrNotFound) || errors.As(err, &corrupt) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		for _, link := range node.Links {
+			stack = append(stack, link.Hash)
+		}
+	}
+	return true, nil
+}
 
-			// Store the parent node *without* correct sizes yet
-			parentNodeCID, err := b.AddNode(parentNode)
-			if err != nil {
-				return "", 0, fmt.Errorf("failed to store parent node: %w", err)
-			}
+// GetNode retrieves a node by its CID.
+// Both CIDv1 strings and the legacy hex form are accepted. The block bytes are
+// verified against the CID; a mismatch is reported as *ErrBlockCorrupt.
+func (b *DAGBuilder) GetNode(cid string) (*Node, error) {
+	c, data, err := b.GetBlock(cid)
+	if err != nil {
+		return nil, err
+	}
 
-			// Now retrieve the parent node to update link sizes (inefficient but works for demo)
-			updatedParentNode := &Node{}     // Create a new node to avoid modifying the one already added
-			*updatedParentNode = *parentNode // Copy data and links
+	node, err := DecodeNode(c, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal node %s: %w", cid, err)
+	}
 
-			totalSize = 0
-			for i, link := range updatedParentNode.Links {
-				// Get the child node to calculate its total size
-				childNode, err := b.GetNode(link.Hash)
-				if err != nil {
-					return "", 0, fmt.Errorf("failed to get child node %s for size calculation: %w", link.Hash, err)
-				}
-				childSize := b.CalculateNodeSize(childNode) // Recursive size calculation
-				updatedParentNode.Links[i].Size = childSize
-				totalSize += childSize
-			}
+	return node, nil
+}
 
-			// Store the updated parent node again (overwriting the previous one with same CID)
-			// This relies on AddNode overwriting if CID is the same, which BadgerDB Put does.
-			// In a real system, you might need a specific "update" or "re-add" with integrity check.
-			_, err = b.AddNode(updatedParentNode) // Re-add with correct sizes
-			if err != nil {
-				return "", 0, fmt.Errorf("failed to re-store parent node with sizes %s: %w", parentNodeCID, err)
-			}
+// GetBlock retrieves the raw bytes of a block by its CID and verifies them against the CID
+func (b *DAGBuilder) GetBlock(cid string) (CID, []byte, error) {
+	c, err := ParseCID(cid)
+	if err != nil {
+		return CID{}, nil, err
+	}
 
-			nextLevelNodes = append(nextLevelNodes, updatedParentNode) // Add the node with correct sizes
+	var data []byte
+	var dataKey []byte
+	for _, key := range c.StoreKeys() {
+		var getErr error
+		data, getErr = b.store.Get(key)
+		if getErr == nil {
+			err = nil
+			dataKey = key
+			break
+		}
+		if err == nil {
+			err = getErr // Report the error for the preferred key
 		}
-		currentLevelNodes = nextLevelNodes
+	}
+	if err != nil {
+		return CID{}, nil, fmt.Errorf("failed to get node %s from store: %w", cid, err)
 	}
 
-	// After the loop, currentLevelNodes should contain only the root node
-	if len(currentLevelNodes) != 1 {
-		return "", 0, errors.New("failed to build single root node")
+	if !c.Verify(data) {
+		corruptBlocks.Add(1)
+		return CID{}, nil, &ErrBlockCorrupt{CID: cid, Key: string(dataKey)}
 	}
+	return c, data, nil
+}
 
-	rootNode := currentLevelNodes[0]
-	rootCID, err := b.AddNode(rootNode) // Store the final root node and return its CID
-	if err != nil {
-		return "", 0, err
+// PutBlock stores raw block bytes under their CID after checking that they hash to it
+func (b *DAGBuilder) PutBlock(c CID, data []byte) error {
+	if !c.Verify(data) {
+		return fmt.Errorf("block %s does not match its CID", c)
 	}
-	rootSize := b.CalculateNodeSize(rootNode)
+	key := c.StoreKeys()[0]
+	if b.stored(key) {
+		return nil
+	}
+	if err := b.store.Put(key, data); err != nil {
+		return fmt.Errorf("failed to store block %s: %w", c, err)
+	}
+	return nil
+}
+
+// stored reports whether a block is stored under key, so writing it again can be skipped. The
+// bytes are not read back: corrupt blocks are found by VerifyBlocks, and once quarantined the
+// next write of the block stores it again.
+func (b *DAGBuilder) stored(key []byte) bool {
+	has, err := b.store.Has(key)
+	return err == nil && has
+}
 
-	return rootCID, rootSize, nil
+// BuildDAGFromLeaves builds a DAG from a list of leaf nodes (chunks)
+// It returns the root CID of the built DAG.
+func (b *DAGBuilder) BuildDAGFromLeaves(leaves []*Node) (string, uint64, error) {
+	layout := &balancedLayout{builder: b}
+	for _, leaf := range leaves {
+		if err := layout.addLeaf(leaf); err != nil {
+			return "", 0, err
+		}
+	}
+	return layout.finish()
 }
 
 // BuildDirectoryDAG builds a DAG node representing a directory
@@ -189,6 +223,9 @@ func (b *DAGBuilder) BuildDirectoryDAG(items map[string]struct {
 	return cid, totalSize, nil
 }
 
+// ErrPathNotFound is returned when a path component has no link in its directory
+var ErrPathNotFound = errors.New("path not found")
+
 // ResolvePath traverses the DAG from a root CID to find the node at the given path
 func (b *DAGBuilder) ResolvePath(rootCID string, path string) (string, error) {
 	currentNodeCID := rootCID
@@ -219,7 +256,7 @@ func (b *DAGBuilder) ResolvePath(rootCID string, path string) (string, error) {
 		}
 
 		if !found {
-			return "", fmt.Errorf("path component '%s' not found in node %s", component, currentNodeCID)
+			return "", fmt.Errorf("%w: component '%s' not found in node %s", ErrPathNotFound, component, currentNodeCID)
 		}
 	}
 
@@ -243,52 +280,58 @@ func splitPath(path string) []string {
 	return strings.Split(path, "/")
 }
 
-// GetFileData retrieves and concatenates data for a file node or a node linking to chunks
+// ErrSizeMismatch is returned when the bytes under a link do not match its declared Size
+var ErrSizeMismatch = errors.New("file size mismatch")
+
+// GetFileData retrieves and concatenates data for a file node of any depth
 func (b *DAGBuilder) GetFileData(fileNodeCID string) ([]byte, error) {
+	var fileData bytes.Buffer
+	if _, err := b.WriteFileData(&fileData, fileNodeCID); err != nil {
+		return nil, err
+	}
+	return fileData.Bytes(), nil
+}
+
+// WriteFileData walks the balanced file tree rooted at fileNodeCID depth-first and writes
+// its content to w in order. The number of bytes found under every link is checked
+// against the link's declared Size. It returns the number of bytes written.
+func (b *DAGBuilder) WriteFileData(w io.Writer, fileNodeCID string) (uint64, error) {
 	fileNode, err := b.GetNode(fileNodeCID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file node %s: %w", fileNodeCID, err)
+		return 0, fmt.Errorf("failed to get file node %s: %w", fileNodeCID, err)
 	}
+	return b.writeFileNode(w, fileNode)
+}
 
-	if len(fileNode.Data) > 0 && len(fileNode.Links) == 0 {
-		// This is a single-chunk file node (or raw data node)
-		return fileNode.Data, nil
+// writeFileNode writes the content under node to w
+func (b *DAGBuilder) writeFileNode(w io.Writer, node *Node) (uint64, error) {
+	if len(node.Links) == 0 {
+		// A leaf chunk, or an empty file
+		n, err := w.Write(node.Data)
+		return uint64(n), err
 	}
 
-	if len(fileNode.Links) == 0 && len(fileNode.Data) == 0 {
-		// Empty file?
-		return []byte{}, nil
-	}
+	var written uint64
+	for _, link := range node.Links {
+		if link.Name != "" {
+			// File chunks have no names in links from a file node, directory entries do
+			return written, fmt.Errorf("linked node %s ('%s') is not a data chunk for file", link.Hash, link.Name)
+		}
 
-	// It's a file represented by multiple chunks linked from this node
-	var fileData bytes.Buffer
-	for _, link := range fileNode.Links {
-		// Ensure the link points to a data chunk node (node with Data, no Links)
-		chunkNode, err := b.GetNode(link.Hash)
+		childNode, err := b.GetNode(link.Hash)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get chunk node %s: %w", link.Hash, err)
+			return written, fmt.Errorf("failed to get chunk node %s: %w", link.Hash, err)
 		}
-		if len(chunkNode.Data) == 0 || len(chunkNode.Links) > 0 {
-			// This linked node is not a simple data chunk. This might indicate a non-file node
-			// or a more complex file structure not handled here.
-			// For this simplified example, we expect file data nodes to link directly to chunks.
-			// If a link has a Name, it's likely a directory link. File chunks usually don't have names in links from the file root.
-			if link.Name != "" {
-				return nil, fmt.Errorf("linked node %s ('%s') is not a data chunk for file", link.Hash, link.Name)
-			}
-			// If no name, but not a data chunk node structure, still an issue
-			return nil, fmt.Errorf("linked node %s is not a data chunk (unexpected structure)", link.Hash)
-
+		n, err := b.writeFileNode(w, childNode)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n != link.Size {
+			return written, fmt.Errorf("%w: link to %s declares %d bytes but has %d", ErrSizeMismatch, link.Hash, link.Size, n)
 		}
-		fileData.Write(chunkNode.Data)
 	}
-
-	// Optional: Verify total size if link.Size was used to sum up
-	// if uint64(fileData.Len()) != b.calculateNodeSize(fileNode) {
-	// 	return nil, errors.New("file data size mismatch")
-	// }
-
-	return fileData.Bytes(), nil
+	return written, nil
 }
 
 // ListDirectory lists the contents of a directory node
@@ -298,18 +341,32 @@ func (b *DAGBuilder) ListDirectory(dirNodeCID string) ([]Link, error) {
 		return nil, fmt.Errorf("failed to get directory node %s: %w", dirNodeCID, err)
 	}
 
-	// A directory node should ideally have no Data and only Links with Names.
-	// Our simple model allows nodes with Data OR Links. Let's explicitly check for directory characteristics.
-	// Assume a node is a directory if it has links and those links have names.
-	if len(dirNode.Links) > 0 && dirNode.Links[0].Name != "" {
-		return dirNode.Links, nil
+	if !IsDirectory(dirNode) {
+		return nil, ErrNotDirectory
 	}
-	if len(dirNode.Links) == 0 && len(dirNode.Data) == 0 {
-		// Empty node, could be an empty directory
-		return []Link{}, nil
+	links := make([]Link, len(dirNode.Links))
+	for i, link := range dirNode.Links {
+		// Report legacy hex links in CIDv1 form
+		if normalized, err := NormalizeCID(link.Hash); err == nil {
+			link.Hash = normalized
+		}
+		links[i] = link
 	}
+	return links, nil
+}
+
+// ErrNotDirectory is returned when a path goes through or lists a node that is not a directory
+var ErrNotDirectory = errors.New("node is not a directory node")
 
-	return nil, errors.New("node is not a directory node")
+// IsDirectory reports whether a node is a directory. A directory node should ideally have no
+// Data and only Links with Names; our simple model allows nodes with Data OR Links, so a node
+// with named links is a directory, and an empty node is an empty directory. An empty file is
+// an empty raw block, whose Data is empty but not nil.
+func IsDirectory(node *Node) bool {
+	if node.Data != nil {
+		return false
+	}
+	return len(node.Links) == 0 || node.Links[0].Name != ""
 }
 
 // CalculateNodeSize recursively calculates the total size of data under a node
@@ -337,7 +394,8 @@ func (b *DAGBuilder) CalculateNodeSize(node *Node) uint64 {
 
 // PutNodeAtPath updates or creates the DAG path from rootCID, linking targetCID at the final path component.
 // It returns the new root CID of the updated DAG.
-// path must be absolute (e.g., "/home/user1/file.txt").
+// path must be absolute (e.g., "/home/user1/file.txt"). An empty currentRootCID starts from an empty directory.
+// Nodes along the path are copied, never modified, so the old root stays valid.
 func (b *DAGBuilder) PutNodeAtPath(currentRootCID string, path string, targetCID string, targetSize uint64) (string, error) {
 	if path == "" || path == "/" {
 		// Cannot "put" content at the root path itself using this method.
@@ -357,7 +415,8 @@ func (b *DAGBuilder) PutNodeAtPath(currentRootCID string, path string, targetCID
 	parentPathComponents := pathComponents[:len(pathComponents)-1]
 
 	// Start the recursive update from the root
-	newRootCID, err := b.updateDirRecursive(currentRootCID, parentPathComponents, itemName, targetCID, targetSize)
+	link := &Link{Name: itemName, Hash: targetCID, Size: targetSize}
+	newRootCID, err := b.updateDirRecursive(currentRootCID, parentPathComponents, itemName, link)
 	if err != nil {
 		return "", fmt.Errorf("failed to update DAG path: %w", err)
 	}
@@ -365,37 +424,101 @@ func (b *DAGBuilder) PutNodeAtPath(currentRootCID string, path string, targetCID
 	return newRootCID, nil
 }
 
+// RemoveNodeAtPath unlinks the final path component from its directory and returns the new root CID.
+// Like PutNodeAtPath it copies the nodes along the path, and the sizes of their links are recomputed.
+func (b *DAGBuilder) RemoveNodeAtPath(currentRootCID string, path string) (string, error) {
+	pathComponents := splitPath(path)
+	if len(pathComponents) == 0 {
+		return "", errors.New("cannot remove the root path '/'")
+	}
+
+	itemName := pathComponents[len(pathComponents)-1]
+	newRootCID, err := b.updateDirRecursive(currentRootCID, pathComponents[:len(pathComponents)-1], itemName, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return newRootCID, nil
+}
+
+// ErrPathExists is returned when a move would replace an existing path
+var ErrPathExists = errors.New("path already exists")
+
+// ErrMoveIntoItself is returned when a move's destination is its source or lies below it
+var ErrMoveIntoItself = errors.New("cannot move a path into itself")
+
+// MoveNodeAtPath moves the node linked at from to the path to and returns the new root CID.
+// Missing directories of to are created; an existing node at to is not replaced.
+func (b *DAGBuilder) MoveNodeAtPath(currentRootCID string, from string, to string) (string, error) {
+	fromComponents := splitPath(from)
+	toComponents := splitPath(to)
+	if len(fromComponents) == 0 || len(toComponents) == 0 {
+		return "", errors.New("cannot move the root path '/'")
+	}
+	if len(toComponents) >= len(fromComponents) &&
+		strings.Join(toComponents[:len(fromComponents)], "/") == strings.Join(fromComponents, "/") {
+		return "", fmt.Errorf("%w: %s to %s", ErrMoveIntoItself, from, to)
+	}
+
+	// Keep the link, not just the CID, so the moved node keeps its size
+	parentCID, err := b.ResolvePath(currentRootCID, strings.Join(fromComponents[:len(fromComponents)-1], "/"))
+	if err != nil {
+		return "", err
+	}
+	parentNode, err := b.getDirNode(parentCID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get directory of %s: %w", from, err)
+	}
+	var moved *Link
+	for _, link := range parentNode.Links {
+		if link.Name == fromComponents[len(fromComponents)-1] {
+			moved = &link
+			break
+		}
+	}
+	if moved == nil {
+		return "", fmt.Errorf("%w: %s", ErrPathNotFound, from)
+	}
+
+	if _, err := b.ResolvePath(currentRootCID, to); err == nil {
+		return "", fmt.Errorf("%w: %s", ErrPathExists, to)
+	} else if !errors.Is(err, ErrPathNotFound) {
+		return "", err
+	}
+
+	removedRootCID, err := b.RemoveNodeAtPath(currentRootCID, from)
+	if err != nil {
+		return "", err
+	}
+	return b.PutNodeAtPath(removedRootCID, to, moved.Hash, moved.Size)
+}
+
 // updateDirRecursive is a helper to recursively build/update directory nodes upwards from the target.
 // It takes the CID of the current directory being processed (starting with the root),
 // the remaining path components *to the parent directory*, the name of the item to link,
-// and the CID/Size of the item being linked.
+// and the link to put under that name, or nil to remove the item.
 // It returns the CID of the *new* node for the current directory level.
-func (b *DAGBuilder) updateDirRecursive(currentDirCID string, parentPathComponents []string, itemName string, targetCID string, targetSize uint64) (string, error) {
+func (b *DAGBuilder) updateDirRecursive(currentDirCID string, parentPathComponents []string, itemName string, itemLink *Link) (string, error) {
 
 	// Base case: We are at the level of the direct parent directory
 	if len(parentPathComponents) == 0 {
 		// Get the current parent directory node
-		parentDirNode, err := b.GetNode(currentDirCID)
+		// Only an empty CID is an empty directory; a missing block is an error, or the
+		// edit would silently drop everything the directory held
+		parentDirNode, err := b.getDirNode(currentDirCID)
 		if err != nil {
-			// If the currentDirCID doesn't exist, it means the path was invalid or a parent didn't exist.
-			// For simplicity, let's assume the initial rootCID exists. If intermediate paths didn't exist,
-			// this recursive function needs to handle creating them.
-			// Let's modify the logic: If currentDirCID is empty or not found, assume it's an empty directory.
-			if errors.Is(err, badger.ErrKeyNotFound) {
-				parentDirNode = &Node{} // Start with an empty directory node if current doesn't exist
-			} else {
-				return "", fmt.Errorf("failed to get parent directory node %s: %w", currentDirCID, err)
-			}
+			return "", fmt.Errorf("failed to get parent directory node %s: %w", currentDirCID, err)
 		}
 
 		// Create a new node for the parent directory
 		newParentDirNode := &Node{}
-		// Copy existing links, but replace or add the link for itemName
+		// Copy existing links, but replace, add or drop the link for itemName
 		linkExists := false
 		for _, link := range parentDirNode.Links {
 			if link.Name == itemName {
-				// Replace existing link
-				newParentDirNode.Links = append(newParentDirNode.Links, Link{Name: itemName, Hash: targetCID, Size: targetSize})
+				// Replace existing link, or drop it when removing
+				if itemLink != nil {
+					newParentDirNode.Links = append(newParentDirNode.Links, *itemLink)
+				}
 				linkExists = true
 			} else {
 				// Keep other links
@@ -403,8 +526,11 @@ func (b *DAGBuilder) updateDirRecursive(currentDirCID string, parentPathComponen
 			}
 		}
 		if !linkExists {
+			if itemLink == nil {
+				return "", fmt.Errorf("%w: '%s' not found in directory %s", ErrPathNotFound, itemName, currentDirCID)
+			}
 			// Add the new link if it didn't exist
-			newParentDirNode.Links = append(newParentDirNode.Links, Link{Name: itemName, Hash: targetCID, Size: targetSize})
+			newParentDirNode.Links = append(newParentDirNode.Links, *itemLink)
 		}
 
 		// Store the new parent directory node
@@ -426,20 +552,11 @@ func (b *DAGBuilder) updateDirRecursive(currentDirCID string, parentPathComponen
 	restOfPathComponents := parentPathComponents[1:] // e.g., ["user1"]
 
 	// Get the node for the current directory level
-	currentDirNode, err := b.GetNode(currentDirCID)
+	currentDirNode, err := b.getDirNode(currentDirCID)
 	var nextDirCID string // The CID of the directory node for currentComponentName
 
 	if err != nil {
-		// If the currentDirCID doesn't exist, it means a parent path component was not found.
-		// We need to create the missing intermediate directories recursively.
-		// Let's assume currentDirCID exists based on the initial root lookup.
-		// If an intermediate link is missing, we create a new empty directory for the next component.
-		if errors.Is(err, badger.ErrKeyNotFound) {
-			// This case should ideally be handled by finding the link in the parent, not getting the current node failing.
-			return "", fmt.Errorf("internal error: current directory node %s not found during recursive update", currentDirCID)
-		} else {
-			return "", fmt.Errorf("failed to get current directory node %s during recursive update: %w", currentDirCID, err)
-		}
+		return "", fmt.Errorf("failed to get current directory node %s during recursive update: %w", currentDirCID, err)
 	}
 
 	// Find the existing link for the next component (e.g., "home") in the current directory's links
@@ -454,6 +571,9 @@ func (b *DAGBuilder) updateDirRecursive(currentDirCID string, parentPathComponen
 	if existingLink != nil {
 		// The next directory node already exists, get its CID
 		nextDirCID = existingLink.Hash
+	} else if itemLink == nil {
+		// Nothing to remove below a directory that does not exist
+		return "", fmt.Errorf("%w: '%s' not found in directory %s", ErrPathNotFound, currentComponentName, currentDirCID)
 	} else {
 		// The next directory node does not exist. Create an empty one for now.
 		// The recursive call will populate it or traverse deeper.
@@ -467,7 +587,7 @@ func (b *DAGBuilder) updateDirRecursive(currentDirCID string, parentPathComponen
 	}
 
 	// Recursively update the next directory level down
-	newNextDirCID, err := b.updateDirRecursive(nextDirCID, restOfPathComponents, itemName, targetCID, targetSize)
+	newNextDirCID, err := b.updateDirRecursive(nextDirCID, restOfPathComponents, itemName, itemLink)
 	if err != nil {
 		return "", fmt.Errorf("recursive update failed for component '%s': %w", currentComponentName, err)
 	}
@@ -508,6 +628,22 @@ func (b *DAGBuilder) updateDirRecursive(currentDirCID string, parentPathComponen
 	return newCurrentDirCID, nil
 }
 
+// getDirNode retrieves a directory node for updateDirRecursive. An empty CID is an empty
+// directory, and a node that is not a directory returns ErrNotDirectory.
+func (b *DAGBuilder) getDirNode(cid string) (*Node, error) {
+	if cid == "" {
+		return &Node{}, nil
+	}
+	node, err := b.GetNode(cid)
+	if err != nil {
+		return nil, err
+	}
+	if !IsDirectory(node) {
+		return nil, ErrNotDirectory
+	}
+	return node, nil
+}
+
 // GetNodeSize retrieves a node and calculates its total size
 func (b *DAGBuilder) GetNodeSize(cid string) (uint64, error) {
 	node, err := b.GetNode(cid)
@@ -0,0 +1,84 @@
+package merkledag_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/storage"
+)
+
+// corrupt overwrites the stored block of cid with bytes that do not match it
+func corrupt(t *testing.T, store storage.Store, cid string) {
+	t.Helper()
+	c, err := merkledag.ParseCID(cid)
+	if err != nil {
+		t.Fatalf("ParseCID: %v", err)
+	}
+	if err := store.Put(c.StoreKeys()[0], []byte("corrupt")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	var corrupt *merkledag.ErrBlockCorrupt
+	if _, _, err := merkledag.NewDAGBuilder(store).GetBlock(cid); !errors.As(err, &corrupt) {
+		t.Fatalf("GetBlock of a corrupted block = %v, want ErrBlockCorrupt", err)
+	}
+}
+
+// quarantine moves the corrupt blocks out of the way, as the admin verify route does
+func quarantine(t *testing.T, dag *merkledag.DAGBuilder, cid string) {
+	t.Helper()
+	report, err := dag.VerifyBlocks(context.Background(), true)
+	if err != nil {
+		t.Fatalf("VerifyBlocks: %v", err)
+	}
+	if len(report.Quarantined) != 1 || report.Quarantined[0] != cid {
+		t.Fatalf("quarantined %v, want %s", report.Quarantined, cid)
+	}
+}
+
+func TestAddingAgainRestoresQuarantinedBlock(t *testing.T) {
+	store := storage.NewMemoryStore()
+	dag := merkledag.NewDAGBuilder(store)
+	const content = "stored twice, corrupted in between"
+	root, _, err := dag.BuildDAGFromReader(strings.NewReader(content), merkledag.NewChunker(8))
+	if err != nil {
+		t.Fatalf("BuildDAGFromReader: %v", err)
+	}
+	corrupt(t, store, root)
+	// A block that is present is not read back on write, so it is only replaced once quarantined
+	if again, _, err := dag.BuildDAGFromReader(strings.NewReader(content), merkledag.NewChunker(8)); err != nil || again != root {
+		t.Fatalf("BuildDAGFromReader again = %s, %v; want %s", again, err, root)
+	}
+	quarantine(t, dag, root)
+
+	if again, _, err := dag.BuildDAGFromReader(strings.NewReader(content), merkledag.NewChunker(8)); err != nil || again != root {
+		t.Fatalf("BuildDAGFromReader again = %s, %v; want %s", again, err, root)
+	}
+	if data, err := dag.GetFileData(root); err != nil || string(data) != content {
+		t.Fatalf("GetFileData after re-adding = %q, %v", data, err)
+	}
+}
+
+func TestPutBlockRestoresQuarantinedBlock(t *testing.T) {
+	store := storage.NewMemoryStore()
+	dag := merkledag.NewDAGBuilder(store)
+	root, _, err := dag.BuildDAGFromReader(strings.NewReader("one raw block"), merkledag.NewChunker(1024))
+	if err != nil {
+		t.Fatalf("BuildDAGFromReader: %v", err)
+	}
+	c, data, err := dag.GetBlock(root)
+	if err != nil {
+		t.Fatalf("GetBlock: %v", err)
+	}
+	corrupt(t, store, root)
+	quarantine(t, dag, root)
+
+	if err := dag.PutBlock(c, data); err != nil {
+		t.Fatalf("PutBlock: %v", err)
+	}
+	if _, got, err := dag.GetBlock(root); err != nil || string(got) != string(data) {
+		t.Fatalf("GetBlock after PutBlock = %q, %v; want the original block", got, err)
+	}
+}
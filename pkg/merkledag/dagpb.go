@@ -0,0 +1,237 @@
+package merkledag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Protobuf field numbers and wire types of the dag-pb schema:
+//
+//	message PBLink { bytes Hash = 1; string Name = 2; uint64 Tsize = 3; }
+//	message PBNode { repeated PBLink Links = 2; bytes Data = 1; }
+//
+// Data holds the UnixFS message of the node, derived from its links: a directory has named
+// links, a file node unnamed links to its chunks, which are raw leaves. Tsize carries the
+// content size under the link rather than the encoded size go-ipfs records, so the CIDs of
+// nodes above the leaves can differ from go-ipfs's for the same content, but every IPFS
+// implementation reads the blocks as the same files and directories.
+//
+// Only the canonical form is decoded, so every node has a single encoding and CID: links
+// first, then the Data field, and link fields in the order Hash, Name, Tsize, each at most
+// once. Nodes written before UnixFS Data was added have no Data field and still decode.
+const (
+	pbNodeData  = 1
+	pbNodeLinks = 2
+	pbLinkHash  = 1
+	pbLinkName  = 2
+	pbLinkTsize = 3
+
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// Field numbers and node types of the UnixFS Data message:
+//
+//	message Data { DataType Type = 1; bytes Data = 2; uint64 filesize = 3; repeated uint64 blocksizes = 4; }
+const (
+	unixfsType       = 1
+	unixfsFilesize   = 3
+	unixfsBlocksizes = 4
+
+	unixfsDirectory = 1
+	unixfsFile      = 2
+)
+
+// ErrNotUnixFS is returned for a node that is neither a directory of named links nor a file of
+// unnamed chunk links. File content lives only in leaves, so a node with both data and links is
+// not stored either: other IPFS implementations would read its data, but this package does not.
+var ErrNotUnixFS = errors.New("node is not a UnixFS file or directory")
+
+// encodeDagPB encodes a node in the canonical dag-pb form: links first, in order, then data.
+// Every link carries Hash, Name and Tsize, matching what go-ipfs writes.
+func encodeDagPB(n *Node) ([]byte, error) {
+	data, err := unixfsData(n)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf []byte
+	for _, link := range n.Links {
+		c, err := ParseCID(link.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid link %q: %w", link.Name, err)
+		}
+
+		var linkBuf []byte
+		linkBuf = appendPBBytes(linkBuf, pbLinkHash, c.Bytes())
+		linkBuf = appendPBBytes(linkBuf, pbLinkName, []byte(link.Name))
+		linkBuf = appendPBVarint(linkBuf, pbLinkTsize, link.Size)
+
+		buf = appendPBBytes(buf, pbNodeLinks, linkBuf)
+	}
+	return appendPBBytes(buf, pbNodeData, data), nil
+}
+
+// unixfsData returns the UnixFS Data message of a node: a directory, or a file whose chunk
+// sizes are the sizes of its links
+func unixfsData(n *Node) ([]byte, error) {
+	if len(n.Data) > 0 {
+		return nil, fmt.Errorf("%w: it has both data and links", ErrNotUnixFS)
+	}
+	if IsDirectory(n) {
+		for _, link := range n.Links {
+			if link.Name == "" {
+				return nil, fmt.Errorf("%w: directory entry %s has no name", ErrNotUnixFS, link.Hash)
+			}
+		}
+		return appendPBVarint(nil, unixfsType, unixfsDirectory), nil
+	}
+
+	var filesize uint64
+	for _, link := range n.Links {
+		if link.Name != "" {
+			return nil, fmt.Errorf("%w: file chunk %s has the name %q", ErrNotUnixFS, link.Hash, link.Name)
+		}
+		filesize += link.Size
+	}
+	data := appendPBVarint(nil, unixfsType, unixfsFile)
+	data = appendPBVarint(data, unixfsFilesize, filesize)
+	for _, link := range n.Links {
+		data = appendPBVarint(data, unixfsBlocksizes, link.Size)
+	}
+	return data, nil
+}
+
+// decodeDagPB decodes a canonical dag-pb block into n
+func decodeDagPB(data []byte, n *Node) error {
+	n.Data = nil
+	n.Links = nil
+	var unixfs []byte
+	for len(data) > 0 {
+		field, wireType, value, rest, err := readPBField(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+		if unixfs != nil {
+			return fmt.Errorf("non-canonical dag-pb node: field %d after Data", field)
+		}
+
+		switch {
+		case field == pbNodeLinks && wireType == wireBytes:
+			link, err := decodePBLink(value)
+			if err != nil {
+				return err
+			}
+			n.Links = append(n.Links, link)
+		case field == pbNodeData && wireType == wireBytes:
+			if len(value) == 0 {
+				return errors.New("non-canonical dag-pb node: empty Data")
+			}
+			unixfs = value
+		default:
+			return fmt.Errorf("unexpected dag-pb node field %d (wire type %d)", field, wireType)
+		}
+	}
+	if unixfs == nil {
+		return nil // Written before UnixFS Data was added
+	}
+
+	// The node's content is all in its links, so Data must be what they encode to
+	want, err := unixfsData(n)
+	if err != nil {
+		return fmt.Errorf("unsupported dag-pb node: %w", err)
+	}
+	if !bytes.Equal(unixfs, want) {
+		return errors.New("unsupported dag-pb node: Data is not the UnixFS directory or file of its links")
+	}
+	return nil
+}
+
+// decodePBLink decodes a single canonical PBLink message
+func decodePBLink(data []byte) (Link, error) {
+	var link Link
+	hasHash := false
+	var last uint64
+	for len(data) > 0 {
+		field, wireType, value, rest, err := readPBField(data)
+		if err != nil {
+			return Link{}, err
+		}
+		data = rest
+		if field <= last {
+			return Link{}, fmt.Errorf("non-canonical dag-pb link: field %d after field %d", field, last)
+		}
+		last = field
+
+		switch {
+		case field == pbLinkHash && wireType == wireBytes:
+			c, n, err := DecodeCID(value)
+			if err != nil {
+				return Link{}, fmt.Errorf("invalid link hash: %w", err)
+			}
+			if n != len(value) {
+				return Link{}, errors.New("invalid link hash: trailing bytes")
+			}
+			link.Hash = c.String()
+			hasHash = true
+		case field == pbLinkName && wireType == wireBytes:
+			link.Name = string(value)
+		case field == pbLinkTsize && wireType == wireVarint:
+			size, n := binary.Uvarint(value)
+			if n <= 0 {
+				return Link{}, errors.New("invalid link Tsize")
+			}
+			link.Size = size
+		default:
+			return Link{}, fmt.Errorf("unexpected dag-pb link field %d (wire type %d)", field, wireType)
+		}
+	}
+	if !hasHash {
+		return Link{}, errors.New("dag-pb link has no hash")
+	}
+	return link, nil
+}
+
+// appendPBBytes appends a length-delimited protobuf field
+func appendPBBytes(buf []byte, field uint64, value []byte) []byte {
+	buf = binary.AppendUvarint(buf, field<<3|wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// appendPBVarint appends a varint protobuf field
+func appendPBVarint(buf []byte, field uint64, value uint64) []byte {
+	buf = binary.AppendUvarint(buf, field<<3|wireVarint)
+	return binary.AppendUvarint(buf, value)
+}
+
+// readPBField reads one protobuf field from data. For varint fields, value holds the
+// varint bytes; for length-delimited fields it holds the payload.
+func readPBField(data []byte) (field uint64, wireType uint64, value []byte, rest []byte, err error) {
+	tag, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, nil, nil, errors.New("invalid protobuf tag")
+	}
+	data = data[n:]
+	field, wireType = tag>>3, tag&0x7
+
+	switch wireType {
+	case wireVarint:
+		_, n = binary.Uvarint(data)
+		if n <= 0 {
+			return 0, 0, nil, nil, errors.New("invalid protobuf varint")
+		}
+		return field, wireType, data[:n], data[n:], nil
+	case wireBytes:
+		length, n := binary.Uvarint(data)
+		if n <= 0 || length > uint64(len(data)-n) {
+			return 0, 0, nil, nil, errors.New("invalid protobuf length")
+		}
+		data = data[n:]
+		return field, wireType, data[:length], data[length:], nil
+	}
+	return 0, 0, nil, nil, fmt.Errorf("unsupported protobuf wire type %d", wireType)
+}
@@ -0,0 +1,205 @@
+package merkledag_test
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/storage"
+)
+
+// pbBytes encodes a length-delimited protobuf field with a one-byte tag and length
+func pbBytes(field byte, value []byte) []byte {
+	return append([]byte{field<<3 | 2, byte(len(value))}, value...)
+}
+
+func TestDecodeRejectsNonCanonicalDagPB(t *testing.T) {
+	hash := merkledag.NewCID(merkledag.CodecRaw, []byte("leaf")).Bytes()
+	link := append(append(pbBytes(1, hash), pbBytes(2, []byte("a"))...), 3<<3, 4)
+	data := pbBytes(1, []byte{1 << 3, 1}) // UnixFS directory
+
+	canonical := append(pbBytes(2, link), data...)
+	c := merkledag.NewCID(merkledag.CodecDagPB, canonical)
+	node, err := merkledag.DecodeNode(c, canonical)
+	if err != nil {
+		t.Fatalf("DecodeNode of a canonical block: %v", err)
+	}
+	if len(node.Links) != 1 || node.Links[0].Name != "a" || node.Links[0].Size != 4 || node.Data != nil {
+		t.Fatalf("decoded %+v", node)
+	}
+
+	for name, block := range map[string][]byte{
+		"data before links": append(append([]byte{}, data...), pbBytes(2, link)...),
+		"data twice":        append(append([]byte{}, data...), data...),
+		"name before hash":  pbBytes(2, append(pbBytes(2, []byte("a")), pbBytes(1, hash)...)),
+		"hash twice":        pbBytes(2, append(pbBytes(1, hash), pbBytes(1, hash)...)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := merkledag.NewCID(merkledag.CodecDagPB, block)
+			if node, err := merkledag.DecodeNode(c, block); err == nil {
+				t.Fatalf("DecodeNode accepted a non-canonical block as %+v", node)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsForeignUnixFSData(t *testing.T) {
+	hash := merkledag.NewCID(merkledag.CodecRaw, []byte("leaf")).Bytes()
+	named := pbBytes(2, append(append(pbBytes(1, hash), pbBytes(2, []byte("a"))...), 3<<3, 4))
+	unnamed := pbBytes(2, append(append(pbBytes(1, hash), pbBytes(2, nil)...), 3<<3, 4))
+
+	for name, block := range map[string][]byte{
+		"not UnixFS":              append(append([]byte{}, named...), pbBytes(1, []byte("data"))...),
+		"file with named links":   append(append([]byte{}, named...), pbBytes(1, []byte{1 << 3, 2, 3 << 3, 4, 4 << 3, 4})...),
+		"directory of chunks":     append(append([]byte{}, unnamed...), pbBytes(1, []byte{1 << 3, 1})...),
+		"wrong file size":         append(append([]byte{}, unnamed...), pbBytes(1, []byte{1 << 3, 2, 3 << 3, 5, 4 << 3, 4})...),
+		"inline file data":        append(append([]byte{}, unnamed...), pbBytes(1, append([]byte{1 << 3, 2}, pbBytes(2, []byte("data"))...))...),
+		"unsupported UnixFS type": pbBytes(1, []byte{1 << 3, 4}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := merkledag.NewCID(merkledag.CodecDagPB, block)
+			if node, err := merkledag.DecodeNode(c, block); err == nil {
+				t.Fatalf("DecodeNode accepted Data it does not write as %+v", node)
+			}
+		})
+	}
+}
+
+func TestDagPBRoundTrip(t *testing.T) {
+	leaf := merkledag.NewCID(merkledag.CodecRaw, []byte("leaf")).String()
+	child := merkledag.NewCID(merkledag.CodecDagPB, []byte("child")).String()
+
+	for name, node := range map[string]*merkledag.Node{
+		"empty":        {},
+		"file":         {Links: []merkledag.Link{{Hash: leaf, Size: 4}, {Hash: leaf, Size: 4}}},
+		"directory":    {Links: []merkledag.Link{{Name: "a.txt", Hash: leaf, Size: 4}, {Name: "sub", Hash: child, Size: 1 << 40}}},
+		"unicode name": {Links: []merkledag.Link{{Name: "文件.txt", Hash: leaf, Size: 300}}},
+		"large file":   {Links: []merkledag.Link{{Hash: child, Size: 1 << 40}, {Hash: leaf, Size: 1000}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, block, err := node.Encode()
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if c.Codec != merkledag.CodecDagPB || !c.Verify(block) {
+				t.Fatalf("Encode gave CID %s, want the dag-pb CID of the block", c)
+			}
+			decoded, err := merkledag.DecodeNode(c, block)
+			if err != nil {
+				t.Fatalf("DecodeNode: %v", err)
+			}
+			if !equalNodes(decoded, node) {
+				t.Fatalf("DecodeNode = %+v, want %+v", decoded, node)
+			}
+			// Encoding the decoded node gives the same block back
+			if again, _, err := decoded.Encode(); err != nil || again.String() != c.String() {
+				t.Fatalf("Encode of the decoded node = %s, %v; want %s", again, err, c)
+			}
+		})
+	}
+
+	// The empty node is the empty UnixFS directory, with the same CID as in go-ipfs
+	if got, err := (&merkledag.Node{}).Cid(); err != nil || got != "bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354" {
+		t.Fatalf("Cid() of the empty node = %s, %v", got, err)
+	}
+
+	// A node cannot hold data next to its links
+	mixed := &merkledag.Node{Data: []byte("data"), Links: []merkledag.Link{{Name: "x", Hash: leaf}}}
+	if _, _, err := mixed.Encode(); !errors.Is(err, merkledag.ErrNotUnixFS) {
+		t.Fatalf("Encode of a node with data and links = %v, want ErrNotUnixFS", err)
+	}
+}
+
+func TestDecodeNodeWithoutUnixFSData(t *testing.T) {
+	// Nodes written before UnixFS Data was added only hold links
+	hash := merkledag.NewCID(merkledag.CodecRaw, []byte("leaf")).Bytes()
+	block := pbBytes(2, append(append(pbBytes(1, hash), pbBytes(2, []byte("a"))...), 3<<3, 4))
+	node, err := merkledag.DecodeNode(merkledag.NewCID(merkledag.CodecDagPB, block), block)
+	if err != nil || len(node.Links) != 1 || node.Links[0].Name != "a" || node.Data != nil {
+		t.Fatalf("DecodeNode of a node without Data = %+v, %v", node, err)
+	}
+}
+
+func TestNodeCodec(t *testing.T) {
+	// Data-only nodes are raw blocks holding just the data
+	c, block, err := (&merkledag.Node{Data: []byte("leaf")}).Encode()
+	if err != nil || c.Codec != merkledag.CodecRaw || string(block) != "leaf" {
+		t.Fatalf("Encode of a leaf = %s, %q, %v; want a raw block", c, block, err)
+	}
+	if node, err := merkledag.DecodeNode(c, block); err != nil || string(node.Data) != "leaf" || len(node.Links) != 0 {
+		t.Fatalf("DecodeNode of a raw block = %+v, %v", node, err)
+	}
+
+	// Nodes written before dag-pb decode from JSON
+	legacy := []byte(`{"data":"bGVhZg==","links":[{"name":"a","hash":"` + c.String() + `","size":4}]}`)
+	node, err := merkledag.DecodeNode(merkledag.NewCID(merkledag.CodecJSON, legacy), legacy)
+	if err != nil || string(node.Data) != "leaf" || len(node.Links) != 1 || node.Links[0].Hash != c.String() {
+		t.Fatalf("DecodeNode of a JSON node = %+v, %v", node, err)
+	}
+
+	if _, _, err := (&merkledag.Node{Links: []merkledag.Link{{Name: "bad", Hash: "not a CID"}}}).Encode(); err == nil {
+		t.Fatal("Encode of a link to an invalid CID succeeded")
+	}
+	if _, err := merkledag.DecodeNode(merkledag.NewCID(0x71, nil), nil); err == nil {
+		t.Fatal("DecodeNode of an unsupported codec succeeded")
+	}
+}
+
+func TestDecodeRejectsMalformedDagPB(t *testing.T) {
+	hash := merkledag.NewCID(merkledag.CodecRaw, []byte("leaf")).Bytes()
+	for name, block := range map[string][]byte{
+		"truncated field":   pbBytes(1, []byte("data"))[:4],
+		"truncated varint":  {0x80},
+		"unknown field":     pbBytes(3, []byte("x")),
+		"varint data":       {1 << 3, 1},
+		"link without hash": pbBytes(2, pbBytes(2, []byte("a"))),
+		"invalid link hash": pbBytes(2, pbBytes(1, []byte("not a CID"))),
+		"trailing hash":     pbBytes(2, pbBytes(1, append(hash, 0))),
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := merkledag.NewCID(merkledag.CodecDagPB, block)
+			if node, err := merkledag.DecodeNode(c, block); err == nil {
+				t.Fatalf("DecodeNode accepted a malformed block as %+v", node)
+			}
+		})
+	}
+}
+
+// equalNodes reports whether a and b hold the same data and links
+func equalNodes(a, b *merkledag.Node) bool {
+	return bytes.Equal(a.Data, b.Data) && slices.Equal(a.Links, b.Links)
+}
+
+func TestMigrateAddsUnixFSData(t *testing.T) {
+	store := storage.NewMemoryStore()
+	dag := merkledag.NewDAGBuilder(store)
+	leaf, err := dag.AddNode(&merkledag.Node{Data: []byte("leaf")})
+	if err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+
+	// A directory written before UnixFS Data was added
+	hash := merkledag.NewCID(merkledag.CodecRaw, []byte("leaf")).Bytes()
+	block := pbBytes(2, append(append(pbBytes(1, hash), pbBytes(2, []byte("a.txt"))...), 3<<3, 4))
+	legacy := merkledag.NewCID(merkledag.CodecDagPB, block).String()
+	if err := store.Put([]byte(legacy), block); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	migrated, err := dag.MigrateDAG(legacy)
+	if err != nil {
+		t.Fatalf("MigrateDAG: %v", err)
+	}
+	want, err := (&merkledag.Node{Links: []merkledag.Link{{Name: "a.txt", Hash: leaf, Size: 4}}}).Cid()
+	if err != nil {
+		t.Fatalf("Cid: %v", err)
+	}
+	if migrated != want {
+		t.Fatalf("MigrateDAG(%s) = %s, want the directory with UnixFS Data %s", legacy, migrated, want)
+	}
+	if entries, err := dag.ListDirectory(migrated); err != nil || len(entries) != 1 || entries[0].Hash != leaf {
+		t.Fatalf("ListDirectory of the migrated root = %+v, %v", entries, err)
+	}
+}
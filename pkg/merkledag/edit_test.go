@@ -0,0 +1,250 @@
+package merkledag_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/storage"
+)
+
+// addContent stores content as a file DAG and returns its root CID and size
+func addContent(t *testing.T, dag *merkledag.DAGBuilder, content string) (string, uint64) {
+	t.Helper()
+	cid, size, err := dag.BuildDAGFromReader(strings.NewReader(content), merkledag.NewChunker(4))
+	if err != nil {
+		t.Fatalf("BuildDAGFromReader: %v", err)
+	}
+	return cid, size
+}
+
+// put links a file with content at path under root and returns the new root
+func put(t *testing.T, dag *merkledag.DAGBuilder, root, path, content string) string {
+	t.Helper()
+	cid, size := addContent(t, dag, content)
+	newRoot, err := dag.PutNodeAtPath(root, path, cid, size)
+	if err != nil {
+		t.Fatalf("PutNodeAtPath(%s): %v", path, err)
+	}
+	return newRoot
+}
+
+// readPath returns the content of the file at path under root
+func readPath(t *testing.T, dag *merkledag.DAGBuilder, root, path string) string {
+	t.Helper()
+	cid, err := dag.ResolvePath(root, path)
+	if err != nil {
+		t.Fatalf("ResolvePath(%s): %v", path, err)
+	}
+	data, err := dag.GetFileData(cid)
+	if err != nil {
+		t.Fatalf("GetFileData(%s): %v", path, err)
+	}
+	return string(data)
+}
+
+// mustResolve resolves path under root
+func mustResolve(t *testing.T, dag *merkledag.DAGBuilder, root, path string) string {
+	t.Helper()
+	cid, err := dag.ResolvePath(root, path)
+	if err != nil {
+		t.Fatalf("ResolvePath(%s): %v", path, err)
+	}
+	return cid
+}
+
+// checkSizes fails unless every link under the directory dir declares the size of what it links to
+func checkSizes(t *testing.T, dag *merkledag.DAGBuilder, dir string) uint64 {
+	t.Helper()
+	node, err := dag.GetNode(dir)
+	if err != nil {
+		t.Fatalf("GetNode(%s): %v", dir, err)
+	}
+	if !merkledag.IsDirectory(node) {
+		size, err := dag.GetNodeSize(dir)
+		if err != nil {
+			t.Fatalf("GetNodeSize(%s): %v", dir, err)
+		}
+		return size
+	}
+	var total uint64
+	for _, link := range node.Links {
+		if size := checkSizes(t, dag, link.Hash); size != link.Size {
+			t.Fatalf("link %q declares %d bytes, holds %d", link.Name, link.Size, size)
+		}
+		total += link.Size
+	}
+	return total
+}
+
+func TestPutNodeAtPath(t *testing.T) {
+	dag := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+
+	// Missing directories are created, starting from no root at all
+	root := put(t, dag, "", "/site/docs/a.txt", "hello")
+	root = put(t, dag, root, "/site/index.html", "<html>")
+	if got := readPath(t, dag, root, "/site/docs/a.txt"); got != "hello" {
+		t.Fatalf("a.txt = %q", got)
+	}
+	if size := checkSizes(t, dag, root); size != uint64(len("hello<html>")) {
+		t.Fatalf("root holds %d bytes, want %d", size, len("hello<html>"))
+	}
+
+	// Replacing a file recomputes the sizes up to the root and leaves the old root intact
+	replaced := put(t, dag, root, "/site/docs/a.txt", "hello, world")
+	if got := readPath(t, dag, replaced, "/site/docs/a.txt"); got != "hello, world" {
+		t.Fatalf("a.txt after replacing = %q", got)
+	}
+	if size := checkSizes(t, dag, replaced); size != uint64(len("hello, world<html>")) {
+		t.Fatalf("root holds %d bytes after replacing, want %d", size, len("hello, world<html>"))
+	}
+	if got := readPath(t, dag, root, "/site/docs/a.txt"); got != "hello" {
+		t.Fatalf("a.txt under the old root = %q", got)
+	}
+	entries, err := dag.ListDirectory(root)
+	if err != nil || len(entries) != 1 || entries[0].Name != "site" {
+		t.Fatalf("ListDirectory(root) = %+v, %v; want only site", entries, err)
+	}
+
+	// Files are not directories
+	if _, err := dag.PutNodeAtPath(root, "/site/index.html/x", root, 0); !errors.Is(err, merkledag.ErrNotDirectory) {
+		t.Fatalf("PutNodeAtPath below a file = %v, want ErrNotDirectory", err)
+	}
+	if _, err := dag.PutNodeAtPath(root, "/", root, 0); err == nil {
+		t.Fatal("PutNodeAtPath at / succeeded")
+	}
+}
+
+func TestRemoveNodeAtPath(t *testing.T) {
+	dag := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+	root := put(t, dag, "", "/a/b/one.txt", "one")
+	root = put(t, dag, root, "/a/two.txt", "two!")
+
+	removed, err := dag.RemoveNodeAtPath(root, "/a/two.txt")
+	if err != nil {
+		t.Fatalf("RemoveNodeAtPath: %v", err)
+	}
+	if _, err := dag.ResolvePath(removed, "/a/two.txt"); !errors.Is(err, merkledag.ErrPathNotFound) {
+		t.Fatalf("ResolvePath of a removed file = %v, want ErrPathNotFound", err)
+	}
+	if size := checkSizes(t, dag, removed); size != 3 {
+		t.Fatalf("root holds %d bytes after removing two.txt, want 3", size)
+	}
+
+	// Removing the last entry leaves an empty directory
+	emptied, err := dag.RemoveNodeAtPath(removed, "/a/b/one.txt")
+	if err != nil {
+		t.Fatalf("RemoveNodeAtPath of the last entry: %v", err)
+	}
+	entries, err := dag.ListDirectory(mustResolve(t, dag, emptied, "/a/b"))
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("ListDirectory(/a/b) = %+v, %v; want an empty directory", entries, err)
+	}
+	if size := checkSizes(t, dag, emptied); size != 0 {
+		t.Fatalf("root holds %d bytes after removing every file, want 0", size)
+	}
+
+	for _, path := range []string{"/a/missing.txt", "/missing/one.txt", "/a/b/one.txt/x"} {
+		if _, err := dag.RemoveNodeAtPath(emptied, path); err == nil {
+			t.Fatalf("RemoveNodeAtPath(%s) succeeded", path)
+		}
+	}
+	if _, err := dag.RemoveNodeAtPath(emptied, "/a/missing.txt"); !errors.Is(err, merkledag.ErrPathNotFound) {
+		t.Fatalf("RemoveNodeAtPath of a missing file = %v, want ErrPathNotFound", err)
+	}
+	if _, err := dag.RemoveNodeAtPath(emptied, "/"); err == nil {
+		t.Fatal("RemoveNodeAtPath of / succeeded")
+	}
+}
+
+func TestMoveNodeAtPath(t *testing.T) {
+	dag := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+	root := put(t, dag, "", "/docs/a.txt", "aaaa")
+	root = put(t, dag, root, "/docs/b.txt", "bb")
+
+	// Moving a directory into missing directories creates them and keeps its size
+	moved, err := dag.MoveNodeAtPath(root, "/docs", "/archive/2024/docs")
+	if err != nil {
+		t.Fatalf("MoveNodeAtPath: %v", err)
+	}
+	if got := readPath(t, dag, moved, "/archive/2024/docs/a.txt"); got != "aaaa" {
+		t.Fatalf("moved a.txt = %q", got)
+	}
+	if _, err := dag.ResolvePath(moved, "/docs"); !errors.Is(err, merkledag.ErrPathNotFound) {
+		t.Fatalf("ResolvePath of the moved source = %v, want ErrPathNotFound", err)
+	}
+	if size := checkSizes(t, dag, moved); size != 6 {
+		t.Fatalf("root holds %d bytes after the move, want 6", size)
+	}
+
+	// Renaming a file within its directory
+	renamed, err := dag.MoveNodeAtPath(root, "/docs/a.txt", "/docs/c.txt")
+	if err != nil {
+		t.Fatalf("MoveNodeAtPath rename: %v", err)
+	}
+	if got := readPath(t, dag, renamed, "/docs/c.txt"); got != "aaaa" {
+		t.Fatalf("renamed c.txt = %q", got)
+	}
+
+	if _, err := dag.MoveNodeAtPath(root, "/docs", "/docs/sub"); !errors.Is(err, merkledag.ErrMoveIntoItself) {
+		t.Fatalf("MoveNodeAtPath into itself = %v, want ErrMoveIntoItself", err)
+	}
+	if _, err := dag.MoveNodeAtPath(root, "/docs", "/docs"); !errors.Is(err, merkledag.ErrMoveIntoItself) {
+		t.Fatalf("MoveNodeAtPath onto itself = %v, want ErrMoveIntoItself", err)
+	}
+	if _, err := dag.MoveNodeAtPath(root, "/docs/a.txt", "/docs/b.txt"); !errors.Is(err, merkledag.ErrPathExists) {
+		t.Fatalf("MoveNodeAtPath onto an existing file = %v, want ErrPathExists", err)
+	}
+	if _, err := dag.MoveNodeAtPath(root, "/docs/missing.txt", "/x.txt"); !errors.Is(err, merkledag.ErrPathNotFound) {
+		t.Fatalf("MoveNodeAtPath of a missing file = %v, want ErrPathNotFound", err)
+	}
+	// /docs-old only shares a prefix with /docs, so it is not inside it
+	if _, err := dag.MoveNodeAtPath(root, "/docs", "/docs-old"); err != nil {
+		t.Fatalf("MoveNodeAtPath to a sibling with a common prefix: %v", err)
+	}
+}
+
+func TestEmptyFileIsNotDirectory(t *testing.T) {
+	dag := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+	empty, size := addContent(t, dag, "")
+	if size != 0 {
+		t.Fatalf("size of the empty file = %d", size)
+	}
+	node, err := dag.GetNode(empty)
+	if err != nil {
+		t.Fatalf("GetNode: %v", err)
+	}
+	if merkledag.IsDirectory(node) {
+		t.Fatal("the empty file is a directory")
+	}
+	if c, err := merkledag.ParseCID(empty); err != nil || c.Codec != merkledag.CodecRaw {
+		t.Fatalf("empty file CID %s, %v; want an empty raw block", empty, err)
+	}
+
+	root, err := dag.PutNodeAtPath("", "/empty.txt", empty, 0)
+	if err != nil {
+		t.Fatalf("PutNodeAtPath: %v", err)
+	}
+	if _, err := dag.ListDirectory(mustResolve(t, dag, root, "/empty.txt")); !errors.Is(err, merkledag.ErrNotDirectory) {
+		t.Fatalf("ListDirectory of the empty file = %v, want ErrNotDirectory", err)
+	}
+	if _, err := dag.PutNodeAtPath(root, "/empty.txt/x", empty, 0); !errors.Is(err, merkledag.ErrNotDirectory) {
+		t.Fatalf("PutNodeAtPath below the empty file = %v, want ErrNotDirectory", err)
+	}
+	if got := readPath(t, dag, root, "/empty.txt"); got != "" {
+		t.Fatalf("empty.txt = %q", got)
+	}
+
+	// An empty directory stays a directory
+	dir, err := dag.RemoveNodeAtPath(root, "/empty.txt")
+	if err != nil {
+		t.Fatalf("RemoveNodeAtPath: %v", err)
+	}
+	if entries, err := dag.ListDirectory(dir); err != nil || len(entries) != 0 {
+		t.Fatalf("ListDirectory of the emptied root = %+v, %v", entries, err)
+	}
+	if dir == empty {
+		t.Fatal("the empty directory and the empty file have the same CID")
+	}
+}
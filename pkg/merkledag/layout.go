@@ -0,0 +1,139 @@
+package merkledag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// fileFanout is the maximum number of links in an intermediate file node.
+// IPFS default fanout is around 174 links per node.
+const fileFanout = 174
+
+// balancedLayout incrementally assembles a balanced file DAG.
+// Nodes are stored as soon as they are complete, and only the links of the
+// not-yet-full parent at each level are kept in memory, so building a file of
+// any size needs at most fileFanout links per tree level.
+type balancedLayout struct {
+	builder *DAGBuilder
+	levels  [][]Link // levels[0] holds leaf links, levels[i] links to nodes of height i
+}
+
+// addLeaf stores a leaf node and links it into the lowest level.
+func (l *balancedLayout) addLeaf(leaf *Node) error {
+	cid, err := l.builder.AddNode(leaf)
+	if err != nil {
+		return fmt.Errorf("failed to store child node: %w", err)
+	}
+	return l.addLink(0, Link{Hash: cid, Size: l.builder.CalculateNodeSize(leaf)})
+}
+
+// addLink appends a link at the given level and flushes the level once it is full.
+func (l *balancedLayout) addLink(level int, link Link) error {
+	for len(l.levels) <= level {
+		l.levels = append(l.levels, nil)
+	}
+	l.levels[level] = append(l.levels[level], link)
+	if len(l.levels[level]) == fileFanout {
+		return l.flush(level)
+	}
+	return nil
+}
+
+// flush stores a parent node for the pending links of a level and links it one level up.
+func (l *balancedLayout) flush(level int) error {
+	// File chunks have no names in links from a file node; each link carries
+	// the total size of the object it points to.
+	parentNode := &Node{Links: l.levels[level]}
+	l.levels[level] = nil
+
+	parentCID, err := l.builder.AddNode(parentNode)
+	if err != nil {
+		return fmt.Errorf("failed to store parent node: %w", err)
+	}
+	return l.addLink(level+1, Link{Hash: parentCID, Size: l.builder.CalculateNodeSize(parentNode)})
+}
+
+// finish flushes all partially filled levels and returns the root CID and total size.
+func (l *balancedLayout) finish() (string, uint64, error) {
+	if len(l.levels) == 0 {
+		// Handle empty content: an empty raw block, which unlike an empty node is not a directory
+		cid, err := l.builder.AddNode(&Node{Data: []byte{}})
+		if err != nil {
+			return "", 0, err
+		}
+		return cid, 0, nil // Empty file has size 0
+	}
+
+	for level := 0; level < len(l.levels); level++ {
+		pending := l.levels[level]
+		if level == len(l.levels)-1 && len(pending) == 1 {
+			// A single node on the top level is the root
+			return pending[0].Hash, pending[0].Size, nil
+		}
+		if len(pending) > 0 {
+			if err := l.flush(level); err != nil {
+				return "", 0, err
+			}
+		}
+	}
+
+	return "", 0, errors.New("failed to build single root node")
+}
+
+// chunkerKeyPrefix prefixes the store keys recording which chunker built a file DAG.
+// Block keys are CIDs and never start with "/", so metadata keys cannot collide with blocks.
+const chunkerKeyPrefix = "/chunker/"
+
+// BuildDAGFromReader chunks r and builds a balanced file DAG while reading.
+// Chunks are hashed and written to the store as they arrive, so memory use is
+// bounded by the chunk size and fanout rather than by the size of the content.
+// The chunker spec is recorded for the root so later uploads can reuse it.
+// It returns the root CID and total size of the built DAG.
+func (b *DAGBuilder) BuildDAGFromReader(r io.Reader, chunker Chunker) (string, uint64, error) {
+	layout := &balancedLayout{builder: b}
+	splitter := chunker.NewSplitter(r)
+	for {
+		chunkData, err := splitter.NextChunk()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to read chunk: %w", err)
+		}
+		if err := layout.addLeaf(&Node{Data: chunkData}); err != nil {
+			return "", 0, err
+		}
+	}
+
+	rootCID, size, err := layout.finish()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := b.store.Put([]byte(chunkerKeyPrefix+rootCID), []byte(chunker.String())); err != nil {
+		return "", 0, fmt.Errorf("failed to record chunker for %s: %w", rootCID, err)
+	}
+	return rootCID, size, nil
+}
+
+// ChunkerSpec returns the spec of the chunker that built the file DAG rooted at rootCID,
+// or an empty string if it was not built by BuildDAGFromReader.
+func (b *DAGBuilder) ChunkerSpec(rootCID string) string {
+	rootCID, err := NormalizeCID(rootCID)
+	if err != nil {
+		return ""
+	}
+	spec, err := b.store.Get([]byte(chunkerKeyPrefix + rootCID))
+	if err != nil {
+		return ""
+	}
+	return string(spec)
+}
+
+// ChunkerRecordRoot returns the root CID a store key records the chunker of, and false if
+// key is not a chunker record. Garbage collection drops the records of collected roots.
+func ChunkerRecordRoot(key []byte) (string, bool) {
+	root, ok := strings.CutPrefix(string(key), chunkerKeyPrefix)
+	return root, ok
+}
@@ -0,0 +1,105 @@
+package merkledag_test
+
+import (
+	"bytes"
+	"testing"
+
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/storage"
+)
+
+// shape walks the file DAG under cid and returns its height (0 for a leaf) and the link
+// count of each node, level by level from the root. Leaves at different depths fail the test.
+func shape(t *testing.T, dag *merkledag.DAGBuilder, cid string) (int, [][]int) {
+	t.Helper()
+	node, err := dag.GetNode(cid)
+	if err != nil {
+		t.Fatalf("GetNode(%s): %v", cid, err)
+	}
+	if len(node.Links) == 0 {
+		return 0, nil
+	}
+	height := -1
+	levels := [][]int{{len(node.Links)}}
+	for _, link := range node.Links {
+		h, below := shape(t, dag, link.Hash)
+		if height >= 0 && h != height {
+			t.Fatalf("node %s has subtrees of height %d and %d", cid, height, h)
+		}
+		height = h
+		for i, counts := range below {
+			if len(levels) <= i+1 {
+				levels = append(levels, nil)
+			}
+			levels[i+1] = append(levels[i+1], counts...)
+		}
+	}
+	return height + 1, levels
+}
+
+func TestBalancedLayoutAtFanoutBoundaries(t *testing.T) {
+	for _, tt := range []struct {
+		chunks int
+		height int
+		root   int // Links of the root node
+	}{
+		{1, 0, 0},
+		{2, 1, 2},
+		{fanout, 1, fanout},
+		{fanout + 1, 2, 2},
+		{2 * fanout, 2, 2},
+		{2*fanout + 1, 2, 3},
+		{fanout * fanout, 2, fanout},
+		{fanout*fanout + 1, 3, 2},
+	} {
+		store := storage.NewMemoryStore()
+		dag := merkledag.NewDAGBuilder(store)
+		content := randomBytes(5, tt.chunks)
+		root, size, err := dag.BuildDAGFromReader(bytes.NewReader(content), merkledag.NewChunker(1))
+		if err != nil {
+			t.Fatalf("%d chunks: BuildDAGFromReader: %v", tt.chunks, err)
+		}
+		if size != uint64(tt.chunks) {
+			t.Fatalf("%d chunks: size = %d", tt.chunks, size)
+		}
+
+		height, levels := shape(t, dag, root)
+		if height != tt.height {
+			t.Fatalf("%d chunks: height %d, want %d", tt.chunks, height, tt.height)
+		}
+		if tt.height > 0 && levels[0][0] != tt.root {
+			t.Fatalf("%d chunks: root has %d links, want %d", tt.chunks, levels[0][0], tt.root)
+		}
+		// Every node is full except the last one of each level
+		for depth, counts := range levels {
+			for i, n := range counts {
+				if n > fanout || (i < len(counts)-1 && depth > 0 && n != fanout) {
+					t.Fatalf("%d chunks: node %d at depth %d has %d links", tt.chunks, i, depth, n)
+				}
+			}
+		}
+
+		if data, err := dag.GetFileData(root); err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("%d chunks: GetFileData = %d bytes, %v", tt.chunks, len(data), err)
+		}
+		if got, err := dag.GetNodeSize(root); err != nil || got != size {
+			t.Fatalf("%d chunks: GetNodeSize = %d, %v; want %d", tt.chunks, got, err, size)
+		}
+	}
+}
+
+func TestBuildDAGFromLeavesMatchesReader(t *testing.T) {
+	content := randomBytes(6, 3*fanout*16+5)
+	dag := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+	want, wantSize, err := dag.BuildDAGFromReader(bytes.NewReader(content), merkledag.NewChunker(16))
+	if err != nil {
+		t.Fatalf("BuildDAGFromReader: %v", err)
+	}
+	leaves, err := merkledag.Chunk(merkledag.NewChunker(16), bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Chunk: %v", err)
+	}
+	if got, size, err := dag.BuildDAGFromLeaves(leaves); err != nil || got != want || size != wantSize {
+		t.Fatalf("BuildDAGFromLeaves = %s, %d, %v; want %s, %d", got, size, err, want, wantSize)
+	}
+}
@@ -0,0 +1,52 @@
+package merkledag
+
+import (
+	"fmt"
+)
+
+// MigrateDAG re-encodes every JSON node reachable from rootCID, and every dag-pb node written
+// before UnixFS Data was added, with the current encoding (raw leaves and dag-pb with UnixFS
+// Data) and returns the CID of the re-encoded root.
+// Re-encoding a node changes its CID, so every ancestor of a migrated node is
+// rewritten as well; the caller must point names at the returned root.
+// The original blocks are left in the store.
+func (b *DAGBuilder) MigrateDAG(rootCID string) (string, error) {
+	migrated := make(map[string]string) // old CID -> new CID, shared subtrees are migrated once
+	return b.migrateNode(rootCID, migrated)
+}
+
+// migrateNode migrates the subtree rooted at cid
+func (b *DAGBuilder) migrateNode(cid string, migrated map[string]string) (string, error) {
+	c, err := ParseCID(cid)
+	if err != nil {
+		return "", err
+	}
+	if c.Codec == CodecRaw {
+		// Raw leaves have no links and are already in the current encoding
+		return c.String(), nil
+	}
+	if newCID, ok := migrated[c.String()]; ok {
+		return newCID, nil
+	}
+
+	node, err := b.GetNode(cid)
+	if err != nil {
+		return "", err
+	}
+
+	newNode := &Node{Data: node.Data, Links: make([]Link, len(node.Links))}
+	for i, link := range node.Links {
+		newChildCID, err := b.migrateNode(link.Hash, migrated)
+		if err != nil {
+			return "", fmt.Errorf("failed to migrate child %s of %s: %w", link.Hash, cid, err)
+		}
+		newNode.Links[i] = Link{Name: link.Name, Hash: newChildCID, Size: link.Size}
+	}
+
+	newCID, err := b.AddNode(newNode)
+	if err != nil {
+		return "", err
+	}
+	migrated[c.String()] = newCID
+	return newCID, nil
+}
@@ -1,8 +1,6 @@
 package merkledag
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 )
@@ -16,35 +14,73 @@ type Link struct {
 
 // Node represents a Merkle DAG node
 type Node struct {
-	Data  []byte `json:"data,omitempty"`  // Content data (for leaf nodes)
+	Data  []byte `json:"data,omitempty"`  // Content data (for leaf nodes); empty but non-nil for an empty file
 	Links []Link `json:"links,omitempty"` // Links to children nodes
 }
 
-// Cid calculates the CID (SHA256 hex) of the Node's serialized representation
+// Codec returns the codec the node is stored with. Leaves that only hold data are
+// stored as raw blocks, like go-ipfs does with raw leaves; all other nodes are dag-pb.
+// An empty file is an empty raw block, so it is not mistaken for an empty directory.
+func (n *Node) Codec() uint64 {
+	if len(n.Links) == 0 && n.Data != nil {
+		return CodecRaw
+	}
+	return CodecDagPB
+}
+
+// Encode returns the CID of the node together with the block bytes it is stored as
+func (n *Node) Encode() (CID, []byte, error) {
+	codec := n.Codec()
+	if codec == CodecRaw {
+		return NewCID(codec, n.Data), n.Data, nil
+	}
+
+	data, err := n.MarshalBinary()
+	if err != nil {
+		return CID{}, nil, err
+	}
+	return NewCID(codec, data), data, nil
+}
+
+// Cid calculates the CIDv1 of the Node's serialized representation
 func (n *Node) Cid() (string, error) {
-	// We need to serialize the node consistently to get a consistent hash.
-	// JSON is simple for this example. Note: Real IPFS uses Protobuf and specific codecs.
-	// The serialization should include both Data and Links.
-	// Omitempty is used, so we need to be careful when marshalling for hashing.
-	// Let's create a temporary struct or marshal explicitly to ensure fields are included.
-
-	// Simple JSON serialization for hashing
-	// Note: This might not be identical to IPFS's serialization, but works for this example.
-	dataToHash, err := json.Marshal(n)
+	c, _, err := n.Encode()
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal node for hashing: %w", err)
 	}
-
-	hash := sha256.Sum256(dataToHash)
-	return hex.EncodeToString(hash[:]), nil
+	return c.String(), nil
 }
 
-// MarshalBinary implements encoding.BinaryMarshaler
+// MarshalBinary implements encoding.BinaryMarshaler using the dag-pb encoding
 func (n *Node) MarshalBinary() ([]byte, error) {
-	return json.Marshal(n)
+	return encodeDagPB(n)
 }
 
-// UnmarshalBinary implements encoding.BinaryUnmarshaler
+// UnmarshalBinary implements encoding.BinaryUnmarshaler using the dag-pb encoding
 func (n *Node) UnmarshalBinary(data []byte) error {
-	return json.Unmarshal(data, n)
+	return decodeDagPB(data, n)
+}
+
+// DecodeNode decodes a block according to the codec of its CID
+func DecodeNode(c CID, data []byte) (*Node, error) {
+	node := &Node{}
+	switch c.Codec {
+	case CodecRaw:
+		node.Data = data
+		if node.Data == nil {
+			node.Data = []byte{} // An empty file
+		}
+	case CodecDagPB:
+		if err := node.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+	case CodecJSON:
+		// Nodes written before the dag-pb encoding was introduced
+		if err := json.Unmarshal(data, node); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported codec 0x%x", c.Codec)
+	}
+	return node, nil
 }
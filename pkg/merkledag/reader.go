@@ -0,0 +1,114 @@
+package merkledag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FileReader is an io.ReadSeeker over the content of a file DAG.
+// It keeps only the current leaf in memory and uses Link.Size to skip
+// subtrees that lie entirely before the read offset.
+type FileReader struct {
+	builder   *DAGBuilder
+	root      *Node
+	size      int64
+	offset    int64
+	leafData  []byte // data of the leaf that was read last
+	leafStart int64  // file offset of the first byte of leafData
+}
+
+// NewFileReader opens the file DAG rooted at fileNodeCID for reading
+func (b *DAGBuilder) NewFileReader(fileNodeCID string) (*FileReader, error) {
+	root, err := b.GetNode(fileNodeCID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file node %s: %w", fileNodeCID, err)
+	}
+	return &FileReader{
+		builder: b,
+		root:    root,
+		size:    int64(b.CalculateNodeSize(root)),
+	}, nil
+}
+
+// Size returns the total size of the file in bytes
+func (r *FileReader) Size() int64 {
+	return r.size
+}
+
+// Read implements io.Reader
+func (r *FileReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if r.leafData == nil || r.offset < r.leafStart || r.offset >= r.leafStart+int64(len(r.leafData)) {
+		data, start, err := r.findLeaf(r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.leafData, r.leafStart = data, start
+	}
+
+	n := copy(p, r.leafData[r.offset-r.leafStart:])
+	r.offset += int64(n)
+	return n, nil
+}
+
+// Seek implements io.Seeker
+func (r *FileReader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = abs
+	return abs, nil
+}
+
+// findLeaf descends from the root to the leaf containing offset and returns
+// its data together with the file offset the leaf starts at.
+func (r *FileReader) findLeaf(offset int64) ([]byte, int64, error) {
+	node := r.root
+	var start int64
+	for len(node.Links) > 0 {
+		found := false
+		for _, link := range node.Links {
+			if offset < start+int64(link.Size) {
+				child, err := r.builder.GetNode(link.Hash)
+				if err != nil {
+					return nil, 0, fmt.Errorf("failed to get chunk node %s: %w", link.Hash, err)
+				}
+				// Offsets are computed from declared sizes, so they must match the child
+				if childSize := r.builder.CalculateNodeSize(child); childSize != link.Size {
+					return nil, 0, fmt.Errorf("%w: link to %s declares %d bytes but has %d", ErrSizeMismatch, link.Hash, link.Size, childSize)
+				}
+				node = child
+				found = true
+				break
+			}
+			// The whole subtree lies before offset
+			start += int64(link.Size)
+		}
+		if !found {
+			return nil, 0, fmt.Errorf("offset %d is beyond the linked content", offset)
+		}
+	}
+
+	if offset >= start+int64(len(node.Data)) {
+		return nil, 0, fmt.Errorf("no data at offset %d", offset)
+	}
+	return node.Data, start, nil
+}
@@ -0,0 +1,157 @@
+package merkledag_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/storage"
+)
+
+// fanout is the number of links in a full intermediate file node
+const fanout = 174
+
+// openFile stores content in chunks of chunkSize bytes and opens a FileReader on it
+func openFile(t *testing.T, content []byte, chunkSize int) (*merkledag.DAGBuilder, string, *merkledag.FileReader) {
+	t.Helper()
+	dag := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+	root, _, err := dag.BuildDAGFromReader(bytes.NewReader(content), merkledag.NewChunker(chunkSize))
+	if err != nil {
+		t.Fatalf("BuildDAGFromReader: %v", err)
+	}
+	r, err := dag.NewFileReader(root)
+	if err != nil {
+		t.Fatalf("NewFileReader: %v", err)
+	}
+	return dag, root, r
+}
+
+func TestFileReaderSeek(t *testing.T) {
+	// More chunks than fit in one node, so seeks skip whole subtrees
+	const chunkSize = 10
+	content := randomBytes(7, (fanout+3)*chunkSize+4)
+	_, _, r := openFile(t, content, chunkSize)
+	if r.Size() != int64(len(content)) {
+		t.Fatalf("Size() = %d, want %d", r.Size(), len(content))
+	}
+	if data, err := io.ReadAll(r); err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("ReadAll = %d bytes, %v; want the content", len(data), err)
+	}
+
+	size := int64(len(content))
+	for _, tt := range []struct {
+		offset int64
+		whence int
+		length int
+		want   int64 // Absolute position
+	}{
+		{0, io.SeekStart, 25, 0},
+		{chunkSize, io.SeekStart, chunkSize, chunkSize},               // A chunk boundary
+		{chunkSize - 1, io.SeekStart, 2, chunkSize - 1},               // Across a chunk boundary
+		{fanout*chunkSize - 3, io.SeekStart, 8, fanout*chunkSize - 3}, // Across a subtree boundary
+		{5, io.SeekCurrent, 15, fanout*chunkSize - 3 + 8 + 5},
+		{-4, io.SeekEnd, 4, size - 4},
+		{-size, io.SeekEnd, int(size), 0},
+	} {
+		pos, err := r.Seek(tt.offset, tt.whence)
+		if err != nil || pos != tt.want {
+			t.Fatalf("Seek(%d, %d) = %d, %v; want %d", tt.offset, tt.whence, pos, err, tt.want)
+		}
+		buf := make([]byte, tt.length)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatalf("ReadFull at %d: %v", pos, err)
+		}
+		if !bytes.Equal(buf, content[pos:pos+int64(tt.length)]) {
+			t.Fatalf("read %d bytes at %d do not match the content", tt.length, pos)
+		}
+	}
+
+	// Reading at or past the end gives EOF, seeking before the start fails
+	for _, offset := range []int64{size, size + 100} {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			t.Fatalf("Seek(%d): %v", offset, err)
+		}
+		if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+			t.Fatalf("Read at %d = %d, %v; want EOF", offset, n, err)
+		}
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Fatal("Seek before the start succeeded")
+	}
+	if _, err := r.Seek(0, 42); err == nil {
+		t.Fatal("Seek with an invalid whence succeeded")
+	}
+}
+
+func TestFileReaderRanges(t *testing.T) {
+	content := randomBytes(8, 5000)
+	_, _, r := openFile(t, content, 64)
+
+	for _, tt := range []struct {
+		header string
+		status int
+		want   []byte
+	}{
+		{"", http.StatusOK, content},
+		{"bytes=0-99", http.StatusPartialContent, content[:100]},
+		{"bytes=1000-1999", http.StatusPartialContent, content[1000:2000]},
+		{"bytes=4990-", http.StatusPartialContent, content[4990:]},
+		{"bytes=-10", http.StatusPartialContent, content[4990:]},
+		{"bytes=6000-", http.StatusRequestedRangeNotSatisfiable, nil},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/file", nil)
+		if tt.header != "" {
+			req.Header.Set("Range", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		http.ServeContent(rec, req, "file.bin", time.Time{}, r)
+		if rec.Code != tt.status {
+			t.Fatalf("Range %q: status %d, want %d", tt.header, rec.Code, tt.status)
+		}
+		if tt.want != nil && !bytes.Equal(rec.Body.Bytes(), tt.want) {
+			t.Fatalf("Range %q: got %d bytes, want %d matching the content", tt.header, rec.Body.Len(), len(tt.want))
+		}
+	}
+}
+
+func TestFileReaderSmallFiles(t *testing.T) {
+	// A single raw leaf is its own root
+	_, _, r := openFile(t, []byte("short"), 64)
+	if data, err := io.ReadAll(r); err != nil || string(data) != "short" || r.Size() != 5 {
+		t.Fatalf("ReadAll = %q, %v; Size() = %d", data, err, r.Size())
+	}
+
+	_, _, r = openFile(t, nil, 64)
+	if data, err := io.ReadAll(r); err != nil || len(data) != 0 || r.Size() != 0 {
+		t.Fatalf("ReadAll of an empty file = %q, %v; Size() = %d", data, err, r.Size())
+	}
+}
+
+func TestFileReaderSizeMismatch(t *testing.T) {
+	dag := merkledag.NewDAGBuilder(storage.NewMemoryStore())
+	leaf, err := dag.AddNode(&merkledag.Node{Data: []byte("0123456789")})
+	if err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+	// The link claims more bytes than the leaf holds
+	root, err := dag.AddNode(&merkledag.Node{Links: []merkledag.Link{{Hash: leaf, Size: 20}}})
+	if err != nil {
+		t.Fatalf("AddNode: %v", err)
+	}
+
+	r, err := dag.NewFileReader(root)
+	if err != nil {
+		t.Fatalf("NewFileReader: %v", err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, merkledag.ErrSizeMismatch) {
+		t.Fatalf("ReadAll = %v, want ErrSizeMismatch", err)
+	}
+	if _, err := dag.GetFileData(root); !errors.Is(err, merkledag.ErrSizeMismatch) {
+		t.Fatalf("GetFileData = %v, want ErrSizeMismatch", err)
+	}
+}
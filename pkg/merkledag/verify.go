@@ -0,0 +1,81 @@
+package merkledag
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"strings"
+)
+
+// quarantinePrefix prefixes the keys corrupt blocks are moved to
+const quarantinePrefix = "/quarantine/"
+
+// corruptBlocks counts blocks whose bytes did not match their CID, on read or during verification
+var corruptBlocks = expvar.NewInt("merkledag_corrupt_blocks_total")
+
+// ErrBlockCorrupt is returned when the bytes stored for a block do not hash to its CID
+type ErrBlockCorrupt struct {
+	CID string // CID the block was requested by
+	Key string // Store key the bytes were read from
+}
+
+// Error implements error
+func (e *ErrBlockCorrupt) Error() string {
+	return fmt.Sprintf("block %s is corrupt: stored bytes under %s do not match the CID", e.CID, e.Key)
+}
+
+// VerifyReport describes the outcome of a blockstore verification
+type VerifyReport struct {
+	Checked     int      `json:"checked"`
+	Corrupt     []string `json:"corrupt"`               // Keys of blocks that do not match their CID
+	Invalid     []string `json:"invalid"`               // Keys that are not CIDs
+	Quarantined []string `json:"quarantined,omitempty"` // Corrupt blocks moved under /quarantine/
+}
+
+// VerifyBlocks hashes every block in the store and compares it with the CID it is stored under.
+// With quarantine set, corrupt blocks are moved to /quarantine/<key> so they are no longer served
+// but can still be inspected.
+func (b *DAGBuilder) VerifyBlocks(ctx context.Context, quarantine bool) (*VerifyReport, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops key iteration on early return
+
+	keys, keysErr := b.store.AllKeys(ctx, nil)
+
+	report := &VerifyReport{Corrupt: []string{}, Invalid: []string{}}
+	for key := range keys {
+		if strings.HasPrefix(string(key), "/") {
+			continue // Metadata, not a block
+		}
+
+		c, err := ParseCID(string(key))
+		if err != nil {
+			report.Invalid = append(report.Invalid, string(key))
+			continue
+		}
+		data, err := b.store.Get(key)
+		if err != nil {
+			return report, fmt.Errorf("failed to read block %s: %w", key, err)
+		}
+		report.Checked++
+		if c.Verify(data) {
+			continue
+		}
+
+		corruptBlocks.Add(1)
+		report.Corrupt = append(report.Corrupt, string(key))
+		if !quarantine {
+			continue
+		}
+		if err := b.store.Put([]byte(quarantinePrefix+string(key)), data); err != nil {
+			return report, fmt.Errorf("failed to quarantine block %s: %w", key, err)
+		}
+		if err := b.store.Delete(key); err != nil {
+			return report, fmt.Errorf("failed to remove corrupt block %s: %w", key, err)
+		}
+		report.Quarantined = append(report.Quarantined, string(key))
+	}
+	if err := keysErr(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
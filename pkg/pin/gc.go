@@ -0,0 +1,183 @@
+package pin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/storage"
+)
+
+// GCReport describes the outcome of a garbage collection run
+type GCReport struct {
+	DryRun       bool     `json:"dry_run"`
+	Roots        int      `json:"roots"`         // Number of pins the mark phase started from
+	Marked       int      `json:"marked"`        // Number of reachable blocks
+	Removed      []string `json:"removed"`       // Keys of unreachable blocks (not deleted in a dry run)
+	RemovedBytes uint64   `json:"removed_bytes"` // Total size of the unreachable blocks
+	Missing      []string `json:"missing"`       // Pinned blocks that are missing or corrupt
+}
+
+// GC deletes every block that is not reachable from the pin set (mark and sweep), together
+// with the chunker records of the file roots it deletes. With dryRun set it only reports what
+// would be deleted. A pinned DAG that is not stored in full does not stop the collection: its
+// missing or corrupt blocks are reported and the walk goes on with the rest of the DAG, while
+// blocks only linked from them cannot be found and are collected. GC refuses to run with
+// ErrNotBackfilled until the names registered before name pins existed are pinned.
+func (p *Pinner) GC(ctx context.Context, dag *merkledag.DAGBuilder, dryRun bool) (*GCReport, error) {
+	p.gcLock.Lock()
+	defer p.gcLock.Unlock()
+
+	backfilled, err := p.Backfilled()
+	if err != nil {
+		return nil, err
+	}
+	if !backfilled {
+		return nil, ErrNotBackfilled
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops key iteration on early return
+
+	pins, err := p.Pins(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pins: %w", err)
+	}
+
+	// Mark
+	marked := make(map[string]bool) // store key -> reachable
+	visited := make(map[string]bool)
+	missing := []string{}
+	for _, pin := range pins {
+		if pin.Mode == Direct {
+			if err := markBlock(pin.CID, marked); err != nil {
+				return nil, err
+			}
+			visited[pin.CID] = true
+			continue
+		}
+		if err := markDAG(ctx, dag, pin.CID, visited, marked, &missing); err != nil {
+			return nil, fmt.Errorf("failed to mark DAG %s: %w", pin.CID, err)
+		}
+	}
+
+	report := &GCReport{DryRun: dryRun, Roots: len(pins), Marked: len(visited), Removed: []string{}, Missing: missing}
+
+	// Sweep
+	keys, keysErr := p.store.AllKeys(ctx, nil)
+	var unreachable, expired, records [][]byte
+	for key := range keys {
+		if strings.HasPrefix(string(key), temporaryPrefix) {
+			pinned, err := p.temporaryPin(key)
+			if err != nil {
+				return nil, err
+			}
+			if pinned.expired() {
+				expired = append(expired, key)
+			}
+			continue
+		}
+		if root, ok := merkledag.ChunkerRecordRoot(key); ok {
+			if !marked[root] {
+				records = append(records, key)
+			}
+			continue
+		}
+		if strings.HasPrefix(string(key), "/") || marked[string(key)] {
+			continue // Metadata (pins, records) or a reachable block
+		}
+		unreachable = append(unreachable, key)
+	}
+	if err := keysErr(); err != nil {
+		return nil, err
+	}
+
+	// Expired temporary pins were ignored by the mark phase, and the chunker records of
+	// unreachable roots would otherwise outlive them
+	if !dryRun {
+		for _, key := range expired {
+			if err := p.store.Delete(key); err != nil {
+				return report, fmt.Errorf("failed to delete expired pin %s: %w", key, err)
+			}
+		}
+		for _, key := range records {
+			if _, err := p.sweep(key, false); err != nil {
+				return report, fmt.Errorf("failed to sweep chunker record: %w", err)
+			}
+		}
+	}
+
+	// Blocks of uploads that are still streaming are not pinned yet, but are kept
+	for _, key := range unreachable {
+		size, err := p.store.GetSize(key)
+		if err != nil {
+			return report, fmt.Errorf("failed to read block %s: %w", key, err)
+		}
+		swept, err := p.sweep(key, dryRun)
+		if err != nil {
+			return report, fmt.Errorf("failed to sweep block: %w", err)
+		}
+		if !swept {
+			continue
+		}
+		report.Removed = append(report.Removed, string(key))
+		report.RemovedBytes += uint64(size)
+	}
+	return report, nil
+}
+
+// markBlock marks every key the block of cid may be stored under
+func markBlock(cid string, marked map[string]bool) error {
+	c, err := merkledag.ParseCID(cid)
+	if err != nil {
+		return err
+	}
+	for _, key := range c.StoreKeys() {
+		marked[string(key)] = true
+	}
+	return nil
+}
+
+// markDAG marks the blocks of the DAG rooted at rootCID. Blocks that are missing or corrupt
+// are appended to missing, and their links are not followed.
+func markDAG(ctx context.Context, dag *merkledag.DAGBuilder, rootCID string, visited, marked map[string]bool, missing *[]string) error {
+	stack := []string{rootCID}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cid := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		c, err := merkledag.ParseCID(cid)
+		if err != nil {
+			return err
+		}
+		if visited[c.String()] {
+			continue // Shared subtree
+		}
+		visited[c.String()] = true
+		if err := markBlock(cid, marked); err != nil {
+			return err
+		}
+		if c.Codec == merkledag.CodecRaw {
+			continue // Raw leaves have no links
+		}
+
+		node, err := dag.GetNode(cid)
+		var corrupt *merkledag.ErrBlockCorrupt
+		if errors.Is(err, storage.ErrNotFound) || errors.As(err, &corrupt) {
+			*missing = append(*missing, c.String())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, link := range node.Links {
+			stack = append(stack, link.Hash)
+		}
+	}
+	return nil
+}
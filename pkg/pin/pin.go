@@ -0,0 +1,266 @@
+package pin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/storage"
+)
+
+// Pin set keys. Block keys are CIDs and never start with "/", so pins cannot collide with blocks.
+const (
+	recursivePrefix = "/pins/recursive/" // + CID: the block and everything it links to
+	directPrefix    = "/pins/direct/"    // + CID: only the block itself
+	namePrefix      = "/pins/names/"     // + name -> CID: the current root of a name, kept recursively
+	sessionPrefix   = "/pins/sessions/"  // + session ID -> CID: the working root of a staging session, kept recursively
+	jobPrefix       = "/pins/jobs/"      // + job ID -> CID: the root of a pending name update, kept recursively
+	temporaryPrefix = "/pins/temporary/" // + ID -> temporaryPin: a root kept recursively until it expires
+	backfillKey     = "/pins/backfilled" // Set once the names registered before name pins existed are pinned
+)
+
+// ErrNotBackfilled is returned by GC until BackfillNames has run. Until then names registered
+// before name pins existed have no pin, and their content would be collected.
+var ErrNotBackfilled = errors.New("name pins have not been backfilled yet")
+
+// Pin modes
+const (
+	Recursive = "recursive"
+	Direct    = "direct"
+	Name      = "name"
+	Session   = "session"
+	Job       = "job"
+	Temporary = "temporary"
+)
+
+// Pin is an entry of the pin set
+type Pin struct {
+	CID       string     `json:"cid"`
+	Mode      string     `json:"mode"`
+	Name      string     `json:"name,omitempty"`      // Set for name pins
+	Session   string     `json:"session,omitempty"`   // Set for session pins
+	Job       string     `json:"job,omitempty"`       // Set for job pins
+	Temporary string     `json:"temporary,omitempty"` // ID of a temporary pin
+	Expires   *time.Time `json:"expires,omitempty"`   // When a temporary pin stops counting
+}
+
+// temporaryPin is the stored form of a temporary pin
+type temporaryPin struct {
+	CID     string    `json:"cid"`
+	Expires time.Time `json:"expires"`
+}
+
+// Pinner maintains the pin set in the datastore. Pinned blocks, and for recursive
+// and name pins everything reachable from them, survive garbage collection.
+type Pinner struct {
+	store storage.Store
+	// gcLock is held for writing while GC runs. Writers hold it for reading while they pin
+	// new blocks, so GC never sweeps blocks that are about to be pinned; blocks stored before
+	// that are kept by TrackWrites.
+	gcLock sync.RWMutex
+
+	writesMu sync.Mutex
+	writes   map[string]int // Store key -> number of TrackWrites views protecting it
+}
+
+// NewPinner creates a new Pinner backed by store
+func NewPinner(store storage.Store) *Pinner {
+	return &Pinner{store: store, writes: make(map[string]int)}
+}
+
+// PinLock blocks garbage collection until the returned function is called
+func (p *Pinner) PinLock() func() {
+	p.gcLock.RLock()
+	return p.gcLock.RUnlock
+}
+
+// Pin adds cid to the pin set, recursively or as a direct pin
+func (p *Pinner) Pin(cid string, recursive bool) error {
+	cid, err := merkledag.NormalizeCID(cid)
+	if err != nil {
+		return err
+	}
+	prefix := directPrefix
+	if recursive {
+		prefix = recursivePrefix
+	}
+	return p.store.Put([]byte(prefix+cid), nil)
+}
+
+// Unpin removes both the recursive and the direct pin of cid
+func (p *Pinner) Unpin(cid string) error {
+	cid, err := merkledag.NormalizeCID(cid)
+	if err != nil {
+		return err
+	}
+	if err := p.store.Delete([]byte(recursivePrefix + cid)); err != nil {
+		return err
+	}
+	return p.store.Delete([]byte(directPrefix + cid))
+}
+
+// PinName records cid as the current root of name. The previous root of the name
+// is no longer kept by this pin and can be collected unless it is pinned otherwise.
+func (p *Pinner) PinName(name, cid string) error {
+	if name == "" {
+		return errors.New("name cannot be empty")
+	}
+	cid, err := merkledag.NormalizeCID(cid)
+	if err != nil {
+		return err
+	}
+	return p.store.Put([]byte(namePrefix+name), []byte(cid))
+}
+
+// PinSession records cid as the working root of a staging session, replacing its previous root
+func (p *Pinner) PinSession(id, cid string) error {
+	cid, err := merkledag.NormalizeCID(cid)
+	if err != nil {
+		return err
+	}
+	return p.store.Put([]byte(sessionPrefix+id), []byte(cid))
+}
+
+// UnpinSession drops the pin of a staging session's working root
+func (p *Pinner) UnpinSession(id string) error {
+	return p.store.Delete([]byte(sessionPrefix + id))
+}
+
+// PinJob keeps cid, the root a queued name update points the name at, until the job is done
+func (p *Pinner) PinJob(id, cid string) error {
+	cid, err := merkledag.NormalizeCID(cid)
+	if err != nil {
+		return err
+	}
+	return p.store.Put([]byte(jobPrefix+id), []byte(cid))
+}
+
+// UnpinJob drops the pin of a queued name update
+func (p *Pinner) UnpinJob(id string) error {
+	return p.store.Delete([]byte(jobPrefix + id))
+}
+
+// PinTemporary keeps cid recursively until expires, or until UnpinTemporary(id). It holds content
+// whose owner may never come back for it; once expired the pin is ignored and GC drops it.
+func (p *Pinner) PinTemporary(id, cid string, expires time.Time) error {
+	cid, err := merkledag.NormalizeCID(cid)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(temporaryPin{CID: cid, Expires: expires.UTC()})
+	if err != nil {
+		return err
+	}
+	return p.store.Put([]byte(temporaryPrefix+id), data)
+}
+
+// UnpinTemporary drops a temporary pin
+func (p *Pinner) UnpinTemporary(id string) error {
+	return p.store.Delete([]byte(temporaryPrefix + id))
+}
+
+// TemporaryPin returns the CID of an unexpired temporary pin, or "" if there is none
+func (p *Pinner) TemporaryPin(id string) (string, error) {
+	pinned, err := p.temporaryPin([]byte(temporaryPrefix + id))
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && pinned.expired()) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return pinned.CID, nil
+}
+
+// temporaryPin reads the temporary pin stored under key
+func (p *Pinner) temporaryPin(key []byte) (*temporaryPin, error) {
+	data, err := p.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var pinned temporaryPin
+	if err := json.Unmarshal(data, &pinned); err != nil {
+		return nil, fmt.Errorf("failed to decode pin %s: %w", key, err)
+	}
+	return &pinned, nil
+}
+
+// expired reports whether a temporary pin no longer counts
+func (t *temporaryPin) expired() bool {
+	return time.Now().After(t.Expires)
+}
+
+// BackfillNames pins the roots of names registered before name pins existed, given as
+// name -> CID, and then allows garbage collection. Names pinned meanwhile keep their pin,
+// which may be newer than the root in roots.
+func (p *Pinner) BackfillNames(roots map[string]string) error {
+	for name, cid := range roots {
+		pinned, err := p.store.Has([]byte(namePrefix + name))
+		if err != nil {
+			return fmt.Errorf("failed to read pin for name %s: %w", name, err)
+		}
+		if pinned {
+			continue
+		}
+		if err := p.PinName(name, cid); err != nil {
+			return fmt.Errorf("failed to pin %s for name %s: %w", cid, name, err)
+		}
+	}
+	return p.store.Put([]byte(backfillKey), nil)
+}
+
+// Backfilled reports whether BackfillNames has run
+func (p *Pinner) Backfilled() (bool, error) {
+	return p.store.Has([]byte(backfillKey))
+}
+
+// Pins lists the pin set
+func (p *Pinner) Pins(ctx context.Context) ([]Pin, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops key iteration on early return
+
+	var pins []Pin
+	for _, mode := range []struct {
+		prefix string
+		mode   string
+	}{{recursivePrefix, Recursive}, {directPrefix, Direct}, {namePrefix, Name}, {sessionPrefix, Session}, {jobPrefix, Job}, {temporaryPrefix, Temporary}} {
+		keys, keysErr := p.store.AllKeys(ctx, []byte(mode.prefix))
+		for key := range keys {
+			suffix := strings.TrimPrefix(string(key), mode.prefix)
+			switch mode.mode {
+			case Recursive, Direct:
+				pins = append(pins, Pin{CID: suffix, Mode: mode.mode})
+				continue
+			case Temporary:
+				pinned, err := p.temporaryPin(key)
+				if err != nil {
+					return nil, err
+				}
+				if !pinned.expired() {
+					pins = append(pins, Pin{CID: pinned.CID, Mode: Temporary, Temporary: suffix, Expires: &pinned.Expires})
+				}
+				continue
+			}
+			cid, err := p.store.Get(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read pin for %s %s: %w", mode.mode, suffix, err)
+			}
+			switch mode.mode {
+			case Name:
+				pins = append(pins, Pin{CID: string(cid), Mode: Name, Name: suffix})
+			case Session:
+				pins = append(pins, Pin{CID: string(cid), Mode: Session, Session: suffix})
+			case Job:
+				pins = append(pins, Pin{CID: string(cid), Mode: Job, Job: suffix})
+			}
+		}
+		if err := keysErr(); err != nil {
+			return nil, err
+		}
+	}
+	return pins, nil
+}
@@ -0,0 +1,271 @@
+package pin_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/storage"
+)
+
+// newPinner returns a pinner over an empty store, with GC enabled
+func newPinner(t *testing.T) (storage.Store, *pin.Pinner, *merkledag.DAGBuilder) {
+	t.Helper()
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	if err := pinner.BackfillNames(nil); err != nil {
+		t.Fatalf("BackfillNames: %v", err)
+	}
+	return store, pinner, merkledag.NewDAGBuilder(store)
+}
+
+// addFile stores content split into 4-byte chunks and returns its root CID and size
+func addFile(t *testing.T, dag *merkledag.DAGBuilder, content string) (string, uint64) {
+	t.Helper()
+	cid, size, err := dag.BuildDAGFromReader(strings.NewReader(content), merkledag.NewChunker(4))
+	if err != nil {
+		t.Fatalf("BuildDAGFromReader: %v", err)
+	}
+	return cid, size
+}
+
+// has reports whether the block of cid is stored
+func has(t *testing.T, dag *merkledag.DAGBuilder, cid string) bool {
+	t.Helper()
+	ok, err := dag.HasNode(cid)
+	if err != nil {
+		t.Fatalf("HasNode(%s): %v", cid, err)
+	}
+	return ok
+}
+
+// gc runs a garbage collection that must succeed
+func gc(t *testing.T, pinner *pin.Pinner, dag *merkledag.DAGBuilder, dryRun bool) *pin.GCReport {
+	t.Helper()
+	report, err := pinner.GC(context.Background(), dag, dryRun)
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	return report
+}
+
+func TestGCKeepsSharedSubtree(t *testing.T) {
+	_, pinner, dag := newPinner(t)
+	shared, size := addFile(t, dag, "shared content spanning chunks")
+	first, err := dag.PutNodeAtPath("", "/a/shared.txt", shared, size)
+	if err != nil {
+		t.Fatalf("PutNodeAtPath: %v", err)
+	}
+	second, err := dag.PutNodeAtPath("", "/b/shared.txt", shared, size)
+	if err != nil {
+		t.Fatalf("PutNodeAtPath: %v", err)
+	}
+	if err := pinner.Pin(first, true); err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+	if err := pinner.PinName("example.com", second); err != nil {
+		t.Fatalf("PinName: %v", err)
+	}
+
+	// Dropping one root keeps the subtree the other still links to
+	if err := pinner.Unpin(first); err != nil {
+		t.Fatalf("Unpin: %v", err)
+	}
+	report := gc(t, pinner, dag, false)
+	if len(report.Removed) == 0 || has(t, dag, first) {
+		t.Fatalf("GC removed %v, want the unpinned root %s", report.Removed, first)
+	}
+	data, err := dag.GetFileData(shared)
+	if err != nil || string(data) != "shared content spanning chunks" {
+		t.Fatalf("shared file after GC = %q, %v", data, err)
+	}
+	if !has(t, dag, second) {
+		t.Fatalf("GC removed the name-pinned root %s", second)
+	}
+}
+
+func TestGCDirectPinKeepsOnlyTheBlock(t *testing.T) {
+	_, pinner, dag := newPinner(t)
+	root, _ := addFile(t, dag, "direct pins keep one block")
+	node, err := dag.GetNode(root)
+	if err != nil {
+		t.Fatalf("GetNode: %v", err)
+	}
+	if len(node.Links) == 0 {
+		t.Fatal("file has no leaves, want a chunked file")
+	}
+	if err := pinner.Pin(root, false); err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+
+	report := gc(t, pinner, dag, false)
+	if len(report.Removed) != len(node.Links) {
+		t.Fatalf("GC removed %d blocks, want the %d leaves", len(report.Removed), len(node.Links))
+	}
+	if !has(t, dag, root) {
+		t.Fatal("GC removed the directly pinned block")
+	}
+	for _, link := range node.Links {
+		if has(t, dag, link.Hash) {
+			t.Fatalf("GC kept leaf %s below a direct pin", link.Hash)
+		}
+	}
+}
+
+func TestGCDryRunDeletesNothing(t *testing.T) {
+	_, pinner, dag := newPinner(t)
+	root, _ := addFile(t, dag, "unpinned content")
+
+	report := gc(t, pinner, dag, true)
+	if !report.DryRun || len(report.Removed) == 0 || report.RemovedBytes == 0 {
+		t.Fatalf("dry run report = %+v, want the unpinned blocks", report)
+	}
+	if !has(t, dag, root) {
+		t.Fatal("dry run deleted a block")
+	}
+
+	if report := gc(t, pinner, dag, false); len(report.Removed) == 0 || has(t, dag, root) {
+		t.Fatalf("GC removed %v, want the unpinned blocks", report.Removed)
+	}
+}
+
+func TestGCKeepsTrackedWrites(t *testing.T) {
+	_, pinner, dag := newPinner(t)
+	shared, _ := addFile(t, dag, "stored before the upload")
+
+	// An upload in progress writes new blocks and skips the stored ones, pinning nothing yet
+	store, release := pinner.TrackWrites()
+	uploading := merkledag.NewDAGBuilder(store)
+	root, _ := addFile(t, uploading, "uploaded while GC runs")
+	if again, _ := addFile(t, uploading, "stored before the upload"); again != shared {
+		t.Fatalf("re-adding the stored file = %s, want %s", again, shared)
+	}
+
+	if report := gc(t, pinner, dag, false); len(report.Removed) != 0 {
+		t.Fatalf("GC removed %v during the upload", report.Removed)
+	}
+	if !has(t, dag, root) || !has(t, dag, shared) || dag.ChunkerSpec(root) == "" {
+		t.Fatal("GC removed blocks the upload wrote or relies on")
+	}
+
+	release()
+	if report := gc(t, pinner, dag, false); len(report.Removed) == 0 || has(t, dag, root) || has(t, dag, shared) {
+		t.Fatalf("GC removed %v after the upload released its blocks, want both files", report.Removed)
+	}
+}
+
+func TestGCSkipsMissingSubtree(t *testing.T) {
+	store, pinner, dag := newPinner(t)
+	file, size := addFile(t, dag, "a pinned DAG with a hole")
+	root, err := dag.PutNodeAtPath("", "/docs/file.txt", file, size)
+	if err != nil {
+		t.Fatalf("PutNodeAtPath: %v", err)
+	}
+	kept, _ := addFile(t, dag, "pinned in full")
+	unpinned, _ := addFile(t, dag, "unpinned")
+	for _, cid := range []string{root, kept} {
+		if err := pinner.Pin(cid, true); err != nil {
+			t.Fatalf("Pin: %v", err)
+		}
+	}
+	c, err := merkledag.ParseCID(file)
+	if err != nil {
+		t.Fatalf("ParseCID: %v", err)
+	}
+	for _, key := range c.StoreKeys() {
+		if err := store.Delete(key); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+
+	// The hole is reported, and the other pins are still collected around
+	report := gc(t, pinner, dag, false)
+	if len(report.Missing) != 1 || report.Missing[0] != file {
+		t.Fatalf("GC reported missing %v, want %s", report.Missing, file)
+	}
+	if !has(t, dag, root) || !has(t, dag, kept) || has(t, dag, unpinned) {
+		t.Fatalf("after GC: root %v, kept %v, unpinned %v; want only the pinned roots", has(t, dag, root), has(t, dag, kept), has(t, dag, unpinned))
+	}
+
+	// The chunker records of collected roots go with them
+	if dag.ChunkerSpec(kept) == "" || dag.ChunkerSpec(unpinned) != "" {
+		t.Fatalf("chunker records after GC: kept %q, unpinned %q; want only the kept one", dag.ChunkerSpec(kept), dag.ChunkerSpec(unpinned))
+	}
+}
+
+func TestGCWaitsForBackfill(t *testing.T) {
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	dag := merkledag.NewDAGBuilder(store)
+	root, _ := addFile(t, dag, "registered before name pins")
+
+	if _, err := pinner.GC(context.Background(), dag, false); !errors.Is(err, pin.ErrNotBackfilled) {
+		t.Fatalf("GC before backfill = %v, want ErrNotBackfilled", err)
+	}
+	if err := pinner.BackfillNames(map[string]string{"example.com": root}); err != nil {
+		t.Fatalf("BackfillNames: %v", err)
+	}
+	if report := gc(t, pinner, dag, false); len(report.Removed) != 0 {
+		t.Fatalf("GC removed %v, want the backfilled name kept", report.Removed)
+	}
+}
+
+func TestBackfillKeepsNewerNamePin(t *testing.T) {
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	dag := merkledag.NewDAGBuilder(store)
+	old, _ := addFile(t, dag, "old root")
+	current, _ := addFile(t, dag, "current root")
+
+	if err := pinner.PinName("example.com", current); err != nil {
+		t.Fatalf("PinName: %v", err)
+	}
+	if err := pinner.BackfillNames(map[string]string{"example.com": old}); err != nil {
+		t.Fatalf("BackfillNames: %v", err)
+	}
+	pins, err := pinner.Pins(context.Background())
+	if err != nil {
+		t.Fatalf("Pins: %v", err)
+	}
+	if len(pins) != 1 || pins[0].Mode != pin.Name || pins[0].CID != current {
+		t.Fatalf("pins = %+v, want only the current root of example.com", pins)
+	}
+}
+
+func TestTemporaryPinExpires(t *testing.T) {
+	store, pinner, dag := newPinner(t)
+	kept, _ := addFile(t, dag, "prepared and still wanted")
+	abandoned, _ := addFile(t, dag, "prepared and abandoned")
+	if err := pinner.PinTemporary("kept", kept, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("PinTemporary: %v", err)
+	}
+	if err := pinner.PinTemporary("abandoned", abandoned, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("PinTemporary: %v", err)
+	}
+
+	if cid, err := pinner.TemporaryPin("abandoned"); err != nil || cid != "" {
+		t.Fatalf("TemporaryPin of an expired pin = %q, %v, want none", cid, err)
+	}
+	gc(t, pinner, dag, false)
+	if !has(t, dag, kept) {
+		t.Fatal("GC removed a root with an unexpired temporary pin")
+	}
+	if has(t, dag, abandoned) {
+		t.Fatal("GC kept a root whose temporary pin expired")
+	}
+	if ok, _ := store.Has([]byte("/pins/temporary/abandoned")); ok {
+		t.Fatal("GC kept the expired pin record")
+	}
+
+	if err := pinner.UnpinTemporary("kept"); err != nil {
+		t.Fatalf("UnpinTemporary: %v", err)
+	}
+	gc(t, pinner, dag, false)
+	if has(t, dag, kept) {
+		t.Fatal("GC kept a root after its temporary pin was dropped")
+	}
+}
@@ -0,0 +1,96 @@
+package pin
+
+import (
+	"fmt"
+	"sync"
+
+	"ipfs-gin-example/pkg/storage"
+)
+
+// trackedStore is a view of the pinner's store whose blocks GC leaves alone until released
+type trackedStore struct {
+	storage.Store
+	pinner *Pinner
+
+	mu   sync.Mutex
+	keys map[string]bool // Keys this view protects
+}
+
+// TrackWrites returns a view of the pinner's store for an upload that stores blocks without
+// holding PinLock. Blocks put through it, and blocks it found with Has and skipped writing, are
+// not collected until release is called. The upload calls it once its root is pinned, which
+// it does under PinLock.
+func (p *Pinner) TrackWrites() (store storage.Store, release func()) {
+	s := &trackedStore{Store: p.store, pinner: p, keys: make(map[string]bool)}
+	return s, s.release
+}
+
+// track protects keys from GC; a key is tracked before it is written or looked up
+func (s *trackedStore) track(keys ...[]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pinner.writesMu.Lock()
+	defer s.pinner.writesMu.Unlock()
+	for _, key := range keys {
+		if s.keys[string(key)] {
+			continue
+		}
+		s.keys[string(key)] = true
+		s.pinner.writes[string(key)]++
+	}
+}
+
+// release drops the protection of every key the view tracked
+func (s *trackedStore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pinner.writesMu.Lock()
+	defer s.pinner.writesMu.Unlock()
+	for key := range s.keys {
+		if s.pinner.writes[key]--; s.pinner.writes[key] == 0 {
+			delete(s.pinner.writes, key)
+		}
+	}
+	s.keys = make(map[string]bool)
+}
+
+// Put tracks and stores a block
+func (s *trackedStore) Put(key []byte, data []byte) error {
+	s.track(key)
+	return s.Store.Put(key, data)
+}
+
+// PutMany tracks and stores several blocks
+func (s *trackedStore) PutMany(blocks []storage.Block) error {
+	keys := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		keys[i] = block.Key
+	}
+	s.track(keys...)
+	return s.Store.PutMany(blocks)
+}
+
+// Has tracks a key and reports whether it is stored. A writer that skips a stored block relies
+// on it staying stored.
+func (s *trackedStore) Has(key []byte) (bool, error) {
+	s.track(key)
+	return s.Store.Has(key)
+}
+
+// sweep deletes an unreachable key unless an upload tracks it, and reports whether it was
+// deleted, or in a dry run would be. The check and the delete are atomic with respect to
+// track, so a writer either sees the key gone or keeps it.
+func (p *Pinner) sweep(key []byte, dryRun bool) (bool, error) {
+	p.writesMu.Lock()
+	defer p.writesMu.Unlock()
+	if p.writes[string(key)] > 0 {
+		return false, nil
+	}
+	if dryRun {
+		return true, nil
+	}
+	if err := p.store.Delete(key); err != nil {
+		return false, fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,205 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// delegationKeyPrefix prefixes the keys delegations are stored under
+const delegationKeyPrefix = "/delegations/"
+
+// Delegation lets an account other than the parent owner own a subname. Delegations are kept by
+// this server, not on the contract: they decide which subnames it registers and resolves.
+type Delegation struct {
+	Name        string    `json:"name"`
+	Parent      string    `json:"parent"`       // Nearest registered ancestor when the delegation was made
+	Delegate    string    `json:"delegate"`     // Address allowed to own the subname
+	DelegatedBy string    `json:"delegated_by"` // Parent owner who made the delegation
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Delegations stores subname delegations in the block store
+type Delegations struct {
+	store storage.Store
+}
+
+// NewDelegations creates a Delegations backed by store
+func NewDelegations(store storage.Store) *Delegations {
+	return &Delegations{store: store}
+}
+
+// Get returns the delegation of a subname, or nil if there is none
+func (d *Delegations) Get(name string) (*Delegation, error) {
+	data, err := d.store.Get([]byte(delegationKeyPrefix + name))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delegation of %s: %w", name, err)
+	}
+	var delegation Delegation
+	if err := json.Unmarshal(data, &delegation); err != nil {
+		return nil, fmt.Errorf("failed to decode delegation of %s: %w", name, err)
+	}
+	return &delegation, nil
+}
+
+// Put stores a delegation, replacing any earlier one of the same subname
+func (d *Delegations) Put(delegation *Delegation) error {
+	data, err := json.Marshal(delegation)
+	if err != nil {
+		return err
+	}
+	if err := d.store.Put([]byte(delegationKeyPrefix+delegation.Name), data); err != nil {
+		return fmt.Errorf("failed to save delegation of %s: %w", delegation.Name, err)
+	}
+	return nil
+}
+
+// Delete removes the delegation of a subname
+func (d *Delegations) Delete(name string) error {
+	return d.store.Delete([]byte(delegationKeyPrefix + name))
+}
+
+// parentName returns the name without its last path component, or "" for a top-level name
+func parentName(name string) string {
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return ""
+	}
+	return name[:i]
+}
+
+// truncateName returns the first depth components of a name
+func truncateName(name string, depth int) string {
+	for i := range name {
+		if name[i] == '/' {
+			if depth--; depth == 0 {
+				return name[:i]
+			}
+		}
+	}
+	return name
+}
+
+// CheckNameDepth returns an error if name has more components than a registered name may have
+func CheckNameDepth(name string) error {
+	if strings.Count(name, "/") >= maxNameDepth {
+		return fmt.Errorf("name %s has more than %d components", name, maxNameDepth)
+	}
+	return nil
+}
+
+// RegisteredParent returns the nearest registered ancestor of a name and its owner, or "" if
+// no ancestor is registered and the name stands on its own.
+func (r *Resolver) RegisteredParent(name string) (string, common.Address, error) {
+	return r.registeredParent(name, r.GetOwner)
+}
+
+// registeredParent is RegisteredParent reading owners with getOwner
+func (r *Resolver) registeredParent(name string, getOwner func(string) (common.Address, error)) (string, common.Address, error) {
+	for parent := parentName(name); parent != ""; parent = parentName(parent) {
+		owner, err := getOwner(parent)
+		if err != nil {
+			return "", common.Address{}, fmt.Errorf("failed to get owner of %s: %w", parent, err)
+		}
+		if owner != (common.Address{}) {
+			return parent, owner, nil
+		}
+	}
+	return "", common.Address{}, nil
+}
+
+// CheckSubname returns ErrNotAuthorized unless account may own name: the owner of the nearest
+// registered ancestor controls the names below it, and may delegate one to another account.
+// Names without a registered ancestor may be owned by anyone.
+func (r *Resolver) CheckSubname(account common.Address, name string) error {
+	return r.checkSubname(account, name, r.GetOwner)
+}
+
+// checkSubname is CheckSubname reading owners with getOwner
+func (r *Resolver) checkSubname(account common.Address, name string, getOwner func(string) (common.Address, error)) error {
+	parent, parentOwner, err := r.registeredParent(name, getOwner)
+	if err != nil || parent == "" || account == parentOwner {
+		return err
+	}
+	if r.Delegations != nil {
+		delegation, err := r.Delegations.Get(name)
+		if err != nil {
+			return err
+		}
+		// A delegation lapses when the parent changes hands
+		if delegation != nil && common.HexToAddress(delegation.Delegate) == account &&
+			common.HexToAddress(delegation.DelegatedBy) == parentOwner {
+			return nil
+		}
+	}
+	return ErrNotAuthorized
+}
+
+// Delegate lets delegate own the subname name. auth must own its nearest registered ancestor.
+func (r *Resolver) Delegate(auth *bind.TransactOpts, name string, delegate common.Address) (*Delegation, error) {
+	if r.Delegations == nil {
+		return nil, errors.New("delegations are not enabled")
+	}
+	parent, err := r.checkParentOwner(auth, name)
+	if err != nil {
+		return nil, err
+	}
+	delegation := &Delegation{
+		Name:        name,
+		Parent:      parent,
+		Delegate:    delegate.Hex(),
+		DelegatedBy: auth.From.Hex(),
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := r.Delegations.Put(delegation); err != nil {
+		return nil, err
+	}
+	return delegation, nil
+}
+
+// Revoke removes the delegation of the subname name. auth must own its nearest registered ancestor.
+// A subname its former delegate registered is no longer resolved or updated through this server.
+func (r *Resolver) Revoke(auth *bind.TransactOpts, name string) error {
+	if r.Delegations == nil {
+		return errors.New("delegations are not enabled")
+	}
+	if _, err := r.checkParentOwner(auth, name); err != nil {
+		return err
+	}
+	delegation, err := r.Delegations.Get(name)
+	if err != nil {
+		return err
+	}
+	if delegation == nil {
+		return fmt.Errorf("%w: no delegation of %s", ErrNotFound, name)
+	}
+	if err := r.Delegations.Delete(name); err != nil {
+		return fmt.Errorf("failed to delete delegation of %s: %w", name, err)
+	}
+	return nil
+}
+
+// checkParentOwner returns the nearest registered ancestor of name if auth owns it
+func (r *Resolver) checkParentOwner(auth *bind.TransactOpts, name string) (string, error) {
+	parent, parentOwner, err := r.RegisteredParent(name)
+	if err != nil {
+		return "", err
+	}
+	if parent == "" {
+		return "", fmt.Errorf("%w: no registered parent of %s", ErrNotFound, name)
+	}
+	if parentOwner != auth.From {
+		return "", ErrNotAuthorized
+	}
+	return parent, nil
+}
@@ -0,0 +1,133 @@
+package resolver_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestResolveLongestPrefix(t *testing.T) {
+	registries(t, func(t *testing.T, registry resolver.NameRegistry, accounts []*bind.TransactOpts) {
+		alice := accounts[0]
+		r := resolver.NewResolver(registry, pin.NewPinner(storage.NewMemoryStore()))
+
+		if _, _, err := r.Resolve("example/docs/a.txt"); !errors.Is(err, resolver.ErrNotFound) {
+			t.Fatalf("Resolve of unregistered name = %v, want ErrNotFound", err)
+		}
+		if err := r.UpdateMapping(alice, "example", cidA); err != nil {
+			t.Fatalf("UpdateMapping: %v", err)
+		}
+		if prefix, cid, err := r.Resolve("example/docs/a.txt"); err != nil || prefix != "example" || cid != cidA {
+			t.Fatalf("Resolve = %q, %q, %v; want example, %q", prefix, cid, err, cidA)
+		}
+		if err := r.UpdateMapping(alice, "example/docs", cidB); err != nil {
+			t.Fatalf("UpdateMapping of own subname: %v", err)
+		}
+		if prefix, cid, err := r.Resolve("example/docs/a.txt"); err != nil || prefix != "example/docs" || cid != cidB {
+			t.Fatalf("Resolve = %q, %q, %v; want example/docs, %q", prefix, cid, err, cidB)
+		}
+	})
+}
+
+// countingRegistry counts the lookups made against a registry
+type countingRegistry struct {
+	resolver.NameRegistry
+	lookups int
+}
+
+func (c *countingRegistry) ResolveCID(name string) (string, error) {
+	c.lookups++
+	return c.NameRegistry.ResolveCID(name)
+}
+
+func (c *countingRegistry) GetOwner(name string) (common.Address, error) {
+	c.lookups++
+	return c.NameRegistry.GetOwner(name)
+}
+
+func TestResolveCachesLookups(t *testing.T) {
+	registries(t, func(t *testing.T, registry resolver.NameRegistry, accounts []*bind.TransactOpts) {
+		alice := accounts[0]
+		counting := &countingRegistry{NameRegistry: registry}
+		r := resolver.NewResolver(counting, pin.NewPinner(storage.NewMemoryStore()))
+		if err := r.UpdateMapping(alice, "example", cidA); err != nil {
+			t.Fatalf("UpdateMapping: %v", err)
+		}
+		if err := r.UpdateMapping(alice, "example/docs", cidB); err != nil {
+			t.Fatalf("UpdateMapping: %v", err)
+		}
+
+		// Names deeper than the cap are never looked up
+		deep := "example/docs/" + strings.Repeat("d/", 100) + "a.txt"
+		counting.lookups = 0
+		if prefix, cid, err := r.Resolve(deep); err != nil || prefix != "example/docs" || cid != cidB {
+			t.Fatalf("Resolve = %q, %q, %v; want example/docs, %q", prefix, cid, err, cidB)
+		}
+		if counting.lookups == 0 || counting.lookups > 20 {
+			t.Fatalf("Resolve of a deep path made %d lookups, want at most 20", counting.lookups)
+		}
+
+		// Misses and owners are cached, so resolving again reads nothing
+		counting.lookups = 0
+		if prefix, _, err := r.Resolve(deep); err != nil || prefix != "example/docs" {
+			t.Fatalf("Resolve = %q, %v; want example/docs", prefix, err)
+		}
+		if counting.lookups != 0 {
+			t.Fatalf("cached Resolve made %d lookups, want 0", counting.lookups)
+		}
+
+		if err := r.UpdateMapping(alice, "example/"+strings.Repeat("d/", 20)+"a.txt", cidA); err == nil {
+			t.Fatal("UpdateMapping of a name deeper than the cap succeeded")
+		}
+	})
+}
+
+func TestDelegation(t *testing.T) {
+	registries(t, func(t *testing.T, registry resolver.NameRegistry, accounts []*bind.TransactOpts) {
+		alice, bob := accounts[0], accounts[1]
+		store := storage.NewMemoryStore()
+		r := resolver.NewResolver(registry, pin.NewPinner(store))
+		r.Delegations = resolver.NewDelegations(store)
+
+		if err := r.UpdateMapping(alice, "example", cidA); err != nil {
+			t.Fatalf("UpdateMapping: %v", err)
+		}
+		if err := r.UpdateMapping(bob, "example/docs", cidB); !errors.Is(err, resolver.ErrNotAuthorized) {
+			t.Fatalf("UpdateMapping of another owner's subname = %v, want ErrNotAuthorized", err)
+		}
+		if _, err := r.Delegate(bob, "example/docs", bob.From); !errors.Is(err, resolver.ErrNotAuthorized) {
+			t.Fatalf("Delegate by non-owner = %v, want ErrNotAuthorized", err)
+		}
+
+		if _, err := r.Delegate(alice, "example/docs", bob.From); err != nil {
+			t.Fatalf("Delegate: %v", err)
+		}
+		if err := r.UpdateMapping(bob, "example/docs", cidB); err != nil {
+			t.Fatalf("UpdateMapping by delegate: %v", err)
+		}
+		if prefix, _, err := r.Resolve("example/docs/a.txt"); err != nil || prefix != "example/docs" {
+			t.Fatalf("Resolve = %q, %v; want example/docs", prefix, err)
+		}
+
+		// Once revoked, the delegate's subname is ignored and the parent answers for it
+		if err := r.Revoke(alice, "example/docs"); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+		if err := r.UpdateMapping(bob, "example/docs", cidA); !errors.Is(err, resolver.ErrNotAuthorized) {
+			t.Fatalf("UpdateMapping after revoke = %v, want ErrNotAuthorized", err)
+		}
+		if prefix, cid, err := r.Resolve("example/docs/a.txt"); err != nil || prefix != "example" || cid != cidA {
+			t.Fatalf("Resolve after revoke = %q, %q, %v; want example, %q", prefix, cid, err, cidA)
+		}
+		if err := r.Revoke(alice, "example/docs"); !errors.Is(err, resolver.ErrNotFound) {
+			t.Fatalf("Revoke without delegation = %v, want ErrNotFound", err)
+		}
+	})
+}
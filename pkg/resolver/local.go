@@ -0,0 +1,163 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// nameKeyPrefix prefixes the keys local name records are stored under
+const nameKeyPrefix = "/names/"
+
+var (
+	// ErrNameTaken is returned when registering a name that already has an owner
+	ErrNameTaken = errors.New("name already registered")
+	// ErrNotOwner is returned when a name is changed by an account that does not own it
+	ErrNotOwner = errors.New("caller is not the owner of this name")
+)
+
+// nameRecord is the stored form of a local name
+type nameRecord struct {
+	CID   string         `json:"cid"`
+	Owner common.Address `json:"owner"`
+}
+
+// LocalRegistry is a NameRegistry kept in the block store instead of on-chain, for running
+// without an Ethereum node. It enforces the same ownership rules as the contract, with the
+// transaction signer (auth.From) as the caller; nothing is signed or sent.
+type LocalRegistry struct {
+	store storage.Store
+	mu    sync.Mutex // Serializes read-modify-write of name records
+}
+
+// NewLocalRegistry creates a LocalRegistry backed by store
+func NewLocalRegistry(store storage.Store) *LocalRegistry {
+	return &LocalRegistry{store: store}
+}
+
+// ResolveCID returns the CID a name maps to, or "" if it is not registered
+func (l *LocalRegistry) ResolveCID(name string) (string, error) {
+	record, err := l.get(name)
+	if err != nil || record == nil {
+		return "", err
+	}
+	return record.CID, nil
+}
+
+// RegisterName claims an unregistered name for auth.From
+func (l *LocalRegistry) RegisterName(auth *bind.TransactOpts, name, cid string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, err := l.get(name)
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		return ErrNameTaken
+	}
+	return l.put(name, &nameRecord{CID: cid, Owner: auth.From})
+}
+
+// UpdateCID maps a name owned by auth.From to a new CID
+func (l *LocalRegistry) UpdateCID(auth *bind.TransactOpts, name, newCID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, err := l.owned(auth, name)
+	if err != nil {
+		return err
+	}
+	record.CID = newCID
+	return l.put(name, record)
+}
+
+// GetOwner returns the owner of a name, or the zero address if it is not registered
+func (l *LocalRegistry) GetOwner(name string) (common.Address, error) {
+	record, err := l.get(name)
+	if err != nil || record == nil {
+		return common.Address{}, err
+	}
+	return record.Owner, nil
+}
+
+// TransferOwnership hands a name owned by auth.From to newOwner
+func (l *LocalRegistry) TransferOwnership(auth *bind.TransactOpts, name string, newOwner common.Address) error {
+	if newOwner == (common.Address{}) {
+		return errors.New("new owner cannot be the zero address")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record, err := l.owned(auth, name)
+	if err != nil {
+		return err
+	}
+	record.Owner = newOwner
+	return l.put(name, record)
+}
+
+// Names lists the registered names
+func (l *LocalRegistry) Names(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	keys, keysErr := l.store.AllKeys(ctx, []byte(nameKeyPrefix))
+	var names []string
+	for key := range keys {
+		names = append(names, strings.TrimPrefix(string(key), nameKeyPrefix))
+	}
+	if err := keysErr(); err != nil {
+		return nil, fmt.Errorf("failed to list names: %w", err)
+	}
+	return names, nil
+}
+
+// owned returns the record of a name, failing unless auth.From owns it
+func (l *LocalRegistry) owned(auth *bind.TransactOpts, name string) (*nameRecord, error) {
+	record, err := l.get(name)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || record.Owner != auth.From {
+		return nil, ErrNotOwner
+	}
+	return record, nil
+}
+
+// get reads the record of a name, returning nil if it is not registered
+func (l *LocalRegistry) get(name string) (*nameRecord, error) {
+	data, err := l.store.Get([]byte(nameKeyPrefix + name))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read name %s: %w", name, err)
+	}
+	var record nameRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode name %s: %w", name, err)
+	}
+	return &record, nil
+}
+
+// put writes the record of a name
+func (l *LocalRegistry) put(name string, record *nameRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := l.store.Put([]byte(nameKeyPrefix+name), data); err != nil {
+		return fmt.Errorf("failed to write name %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package resolver
+
+import (
+	"strings"
+	"sync"
+)
+
+// nameLocks hands out one mutex per name, dropped again once nobody holds or waits for it
+type nameLocks struct {
+	mu    sync.Mutex
+	locks map[string]*nameLock
+}
+
+// nameLock is the mutex of one name and how many callers hold or wait for it
+type nameLock struct {
+	sync.Mutex
+	refs int
+}
+
+// LockName serializes read-modify-write updates of a name, such as path edits that build a
+// new root on the current one, until the returned function is called. Names are locked by
+// their top-level domain, so an edit of a subname also waits for edits of its parent.
+func (r *Resolver) LockName(name string) func() {
+	name, _, _ = strings.Cut(name, "/")
+
+	r.locks.mu.Lock()
+	if r.locks.locks == nil {
+		r.locks.locks = make(map[string]*nameLock)
+	}
+	lock, ok := r.locks.locks[name]
+	if !ok {
+		lock = &nameLock{}
+		r.locks.locks[name] = lock
+	}
+	lock.refs++
+	r.locks.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		r.locks.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(r.locks.locks, name)
+		}
+		r.locks.mu.Unlock()
+	}
+}
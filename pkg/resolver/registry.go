@@ -0,0 +1,26 @@
+package resolver
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+
+	"ipfs-gin-example/pkg/contract"
+)
+
+// NameRegistry stores name -> CID mappings and who owns each name.
+// A name that is not registered resolves to "" and is owned by the zero address.
+type NameRegistry interface {
+	// ResolveCID returns the CID a name maps to
+	ResolveCID(name string) (string, error)
+	// RegisterName claims an unregistered name for auth.From and maps it to cid
+	RegisterName(auth *bind.TransactOpts, name, cid string) error
+	// UpdateCID maps a name owned by auth.From to a new CID
+	UpdateCID(auth *bind.TransactOpts, name, newCID string) error
+	// GetOwner returns the owner of a name
+	GetOwner(name string) (common.Address, error)
+	// TransferOwnership hands a name owned by auth.From to newOwner
+	TransferOwnership(auth *bind.TransactOpts, name string, newOwner common.Address) error
+}
+
+// The DecentralizedNamingSystem contract client is the on-chain registry
+var _ NameRegistry = (*contract.Client)(nil)
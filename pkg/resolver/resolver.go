@@ -1,34 +1,75 @@
 package resolver
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/lru"
 	"log"
+	"strings"
+	"time"
 
 	"ipfs-gin-example/pkg/contract"
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 )
 
-// Resolver resolves domain/subdomain to a root CID by interacting with the smart contract,
-// with an LRU cache for performance optimization.
+// ErrNotAuthorized is returned when a name is updated by an account that does not own it
+var ErrNotAuthorized = errors.New("not authorized to update this name")
+
+// ErrNotFound is returned when resolving a name that is not registered
+var ErrNotFound = errors.New("CID not found for name")
+
+// maxNameDepth bounds the "/"-separated components of a name, and so the registry lookups
+// Resolve makes for one path
+const maxNameDepth = 16
+
+// Resolver resolves domain/subdomain to a root CID through a name registry (the smart contract
+// or a local one), with an LRU cache for performance optimization. Unregistered names are cached
+// too, as are the owners Resolve checks subnames against. Cached names changed on the contract
+// by someone else are refreshed by Watch; CacheTTL bounds staleness without it.
 type Resolver struct {
-	contractClient *contract.Client
-	cache          *lru.Cache[string, string] // LRU cache for name -> CID mappings
+	registry    NameRegistry
+	cache       *lru.Cache[string, cacheEntry]  // LRU cache for name -> CID mappings; "" if unregistered
+	owners      *lru.Cache[string, ownerEntry]  // LRU cache for name -> owner, read by Resolve
+	hashes      *lru.Cache[common.Hash, string] // Name hash -> name of cached names, to match contract logs
+	pinner      *pin.Pinner                     // Pins the roots UpdateMapping maps names to
+	CacheTTL    time.Duration                   // Cached CIDs and owners older than this are reloaded; 0 keeps them until evicted
+	Delegations *Delegations                    // Subnames parent owners handed to other accounts; nil allows no delegates
+
+	locks nameLocks // Held by LockName
+}
+
+// cacheEntry is a cached CID and when it was read from the registry
+type cacheEntry struct {
+	cid   string
+	added time.Time
+}
+
+// ownerEntry is a cached owner and when it was read from the registry
+type ownerEntry struct {
+	owner common.Address
+	added time.Time
 }
 
-// NewResolver creates a new Resolver with a contract client and an LRU cache of size 2^16.
-func NewResolver(contractClient *contract.Client) *Resolver {
+// NewResolver creates a new Resolver with a name registry and an LRU cache of size 2^16.
+// Roots mapped through the resolver are pinned with pinner so GC keeps them.
+func NewResolver(registry NameRegistry, pinner *pin.Pinner) *Resolver {
 	// Initialize LRU cache with capacity 2^16 (65,536)
-	cache := lru.NewCache[string, string](1 << 16)
+	cache := lru.NewCache[string, cacheEntry](1 << 16)
 	//if err != nil {
 	//	// Should not happen with valid capacity
 	//	panic("failed to initialize LRU cache: " + err.Error())
 	//}
 	return &Resolver{
-		contractClient: contractClient,
-		cache:          cache,
+		registry: registry,
+		cache:    cache,
+		owners:   lru.NewCache[string, ownerEntry](1 << 16),
+		hashes:   lru.NewCache[common.Hash, string](1 << 16),
+		pinner:   pinner,
 	}
 }
 
@@ -39,75 +80,267 @@ func (r *Resolver) ResolveDomain(name string) (string, error) {
 	}
 
 	// Check cache first
-	if cid, ok := r.cache.Get(name); ok {
+	if cid, ok := r.cached(name); ok {
 		log.Printf("Cache hit for name %s: %s", name, cid)
+		if cid == "" {
+			return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
 		return cid, nil
 	}
 
-	log.Printf("Cache miss for name %s, querying contract", name)
-	cid, err := r.contractClient.ResolveCID(name)
+	log.Printf("Cache miss for name %s, querying registry", name)
+	cid, err := r.registry.ResolveCID(name)
 	if err != nil {
 		return "", errors.New("failed to resolve CID: " + err.Error())
 	}
-	if cid == "" {
-		return "", errors.New("CID not found for name: " + name)
+	if cid != "" {
+		cid = normalizeCID(cid)
 	}
 
-	// Store in cache
-	r.cache.Add(name, cid)
+	// Store in cache, unregistered names included
+	r.cacheAdd(name, cid)
+	if cid == "" {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
 	log.Printf("Cached name %s: %s", name, cid)
 	return cid, nil
 }
 
+// Resolve resolves the longest registered prefix of name, split at "/", and returns it with its
+// CID. The rest of the name is a path inside that CID's DAG. Subnames their parent owner did not
+// authorize are skipped, so the parent's DAG answers for them. Only the first maxNameDepth
+// components can be a registered name; lookups and owner checks are answered from the cache
+// where possible, so a path whose prefixes are cached costs no registry call.
+func (r *Resolver) Resolve(name string) (string, string, error) {
+	if name == "" {
+		return "", "", errors.New("domain name cannot be empty")
+	}
+	for prefix := truncateName(name, maxNameDepth); prefix != ""; prefix = parentName(prefix) {
+		cid, found, err := r.GetMapping(prefix)
+		if err != nil {
+			return "", "", err
+		}
+		if !found {
+			continue
+		}
+		if strings.Contains(prefix, "/") {
+			owner, err := r.cachedOwner(prefix)
+			if err != nil {
+				return "", "", err
+			}
+			err = r.checkSubname(owner, prefix, r.cachedOwner)
+			if errors.Is(err, ErrNotAuthorized) {
+				log.Printf("Skipping %s, its owner %s is not authorized by the parent owner", prefix, owner.Hex())
+				continue
+			}
+			if err != nil {
+				return "", "", err
+			}
+		}
+		return prefix, cid, nil
+	}
+	return "", "", fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
 // UpdateMapping registers or updates the CID for a given domain/path combination.
 // It checks ownership and decides whether to register or update the CID.
 func (r *Resolver) UpdateMapping(auth *bind.TransactOpts, name, cid string) error {
 	if name == "" || cid == "" {
 		return errors.New("name and CID cannot be empty")
 	}
+	if err := CheckNameDepth(name); err != nil {
+		return err
+	}
+	cid, err := merkledag.NormalizeCID(cid)
+	if err != nil {
+		return err
+	}
+
+	// Names below a registered parent belong to its owner or a delegate
+	if err := r.CheckSubname(auth.From, name); err != nil {
+		return err
+	}
 
 	// Check if name exists and get owner
-	owner, err := r.contractClient.GetOwner(name)
+	owner, err := r.registry.GetOwner(name)
 	if err == nil && owner != (common.Address{}) {
 		// Name exists, check ownership
 		if owner != auth.From {
-			return errors.New("not authorized to update this name")
+			return ErrNotAuthorized
 		}
 		// Update existing CID
-		err = r.contractClient.UpdateCID(auth, name, cid)
+		err = r.registry.UpdateCID(auth, name, cid)
 		if err != nil {
 			return err
 		}
 	} else {
 		// Name does not exist, register it
-		err = r.contractClient.RegisterName(auth, name, cid)
+		err = r.registry.RegisterName(auth, name, cid)
 		if err != nil {
 			return err
 		}
 	}
 
 	// Update cache
-	r.cache.Add(name, cid)
+	r.cacheAdd(name, cid)
+	r.ownerAdd(name, auth.From)
+
+	// The mapping is already registered, so a failed pin is only logged
+	if err := r.pinner.PinName(name, cid); err != nil {
+		log.Printf("Warning: failed to pin %s for name %s: %v", cid, name, err)
+	}
+	return nil
+}
+
+// Refresh drops the cached CID and owner of a name and reloads the CID from the registry. It is used after the
+// name was changed by a transaction the resolver did not send itself. The new root is not
+// pinned: it may point at content this node does not hold, and a pin over missing blocks would
+// stop garbage collection. Whoever built or imported the content pins it.
+func (r *Resolver) Refresh(name string) (string, error) {
+	r.cache.Remove(name)
+	r.owners.Remove(name)
+	return r.ResolveDomain(name)
+}
+
+// BackfillPins pins the current roots of names registered before name pins existed, then lets
+// garbage collection run. Only names whose DAG is stored here in full are pinned; the others
+// map to content this node never held.
+func (r *Resolver) BackfillPins(ctx context.Context, dag *merkledag.DAGBuilder, names []string) error {
+	roots := make(map[string]string)
+	for _, name := range names {
+		cid, err := r.registry.ResolveCID(name)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", name, err)
+		}
+		if _, err := merkledag.ParseCID(cid); err != nil {
+			continue // Unregistered, or not a CID
+		}
+		complete, err := dag.HasDAG(ctx, cid)
+		if err != nil {
+			return fmt.Errorf("failed to check DAG %s of %s: %w", cid, name, err)
+		}
+		if !complete {
+			log.Printf("Not pinning %s for name %s, its DAG is not stored here in full", cid, name)
+			continue
+		}
+		roots[name] = normalizeCID(cid)
+	}
+	return r.pinner.BackfillNames(roots)
+}
+
+// GetOwner returns the owner of a name, or the zero address if it is not registered.
+func (r *Resolver) GetOwner(name string) (common.Address, error) {
+	if name == "" {
+		return common.Address{}, errors.New("domain name cannot be empty")
+	}
+	return r.registry.GetOwner(name)
+}
+
+// TransferOwnership transfers a name to newOwner. Like UpdateMapping, only the current owner
+// may do so. A parent owner transferring one of its subnames delegates it to newOwner as well.
+func (r *Resolver) TransferOwnership(auth *bind.TransactOpts, name string, newOwner common.Address) error {
+	if newOwner == (common.Address{}) {
+		return errors.New("new owner cannot be the zero address")
+	}
+	owner, err := r.GetOwner(name)
+	if err != nil {
+		return err
+	}
+	if owner == (common.Address{}) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if owner != auth.From {
+		return ErrNotAuthorized
+	}
+	if err := r.registry.TransferOwnership(auth, name, newOwner); err != nil {
+		return err
+	}
+	r.ownerAdd(name, newOwner)
+	if err := r.DelegateTransferred(auth.From, name, newOwner); err != nil {
+		// The transfer is already mined, so a failed delegation is only logged
+		log.Printf("Warning: failed to delegate %s to %s: %v", name, newOwner.Hex(), err)
+	}
 	return nil
 }
 
+// DelegateTransferred delegates the subname name to newOwner after from transferred it to them,
+// if from owns its parent, so the new owner may keep updating it.
+func (r *Resolver) DelegateTransferred(from common.Address, name string, newOwner common.Address) error {
+	parent, parentOwner, err := r.RegisteredParent(name)
+	if err != nil || parent == "" || parentOwner != from || r.Delegations == nil {
+		return err
+	}
+	_, err = r.Delegate(&bind.TransactOpts{From: from}, name, newOwner)
+	return err
+}
+
 // GetMapping retrieves the current CID and existence status for a name.
 func (r *Resolver) GetMapping(name string) (string, bool, error) {
 	// Check cache first
-	if cid, ok := r.cache.Get(name); ok {
-		return cid, true, nil
+	if cid, ok := r.cached(name); ok {
+		return cid, cid != "", nil
 	}
 
-	// Query smart contract
-	cid, err := r.contractClient.ResolveCID(name)
+	// Query name registry
+	cid, err := r.registry.ResolveCID(name)
 	if err != nil {
 		return "", false, errors.New("failed to get mapping: " + err.Error())
 	}
 
-	// Store in cache if found
+	// Store in cache, unregistered names included
 	if cid != "" {
-		r.cache.Add(name, cid)
-		return cid, true, nil
+		cid = normalizeCID(cid)
+	}
+	r.cacheAdd(name, cid)
+	return cid, cid != "", nil
+}
+
+// cachedOwner returns the owner of a name, from the cache unless it is older than CacheTTL
+func (r *Resolver) cachedOwner(name string) (common.Address, error) {
+	if entry, ok := r.owners.Get(name); ok {
+		if r.CacheTTL <= 0 || time.Since(entry.added) <= r.CacheTTL {
+			return entry.owner, nil
+		}
+		r.owners.Remove(name)
+	}
+	owner, err := r.registry.GetOwner(name)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to get owner of %s: %w", name, err)
+	}
+	r.ownerAdd(name, owner)
+	return owner, nil
+}
+
+// cached returns the cached CID of a name, unless it is older than CacheTTL
+func (r *Resolver) cached(name string) (string, bool) {
+	entry, ok := r.cache.Get(name)
+	if !ok {
+		return "", false
+	}
+	if r.CacheTTL > 0 && time.Since(entry.added) > r.CacheTTL {
+		r.cache.Remove(name)
+		return "", false
+	}
+	return entry.cid, true
+}
+
+// cacheAdd caches the CID of a name
+func (r *Resolver) cacheAdd(name, cid string) {
+	r.cache.Add(name, cacheEntry{cid: cid, added: time.Now()})
+	r.hashes.Add(contract.NameHash(name), name)
+}
+
+// ownerAdd caches the owner of a name
+func (r *Resolver) ownerAdd(name string, owner common.Address) {
+	r.owners.Add(name, ownerEntry{owner: owner, added: time.Now()})
+	r.hashes.Add(contract.NameHash(name), name)
+}
+
+// normalizeCID returns the CIDv1 form of a CID read from the registry.
+// Names registered before CIDv1 point to legacy hex CIDs; values that are not CIDs are kept as-is.
+func normalizeCID(cid string) string {
+	if normalized, err := merkledag.NormalizeCID(cid); err == nil {
+		return normalized
 	}
-	return "", false, nil
+	return cid
 }
@@ -0,0 +1,177 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"ipfs-gin-example/pkg/contract/contracttest"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	cidA = "bafkreifhfgbgpbk3tj6jnkd5vhl67jnbnclsxqrpmo3zk4qqe7gel2tfta"
+	cidB = "bafkreidd3lbo3mrsutwru2tib4h6d3ivi73nb4ss74lkoi63jiq5vhxc5y"
+	// legacyHex is a CID in the hex form names were registered with before CIDv1
+	legacyHex = "a7298267855b9a7c96a87da9d7efa5a168972bc22f63b795721027cc45ea6598"
+	legacyV1  = "bagaaierau4uyez4flonhzfvipwu5p35fufujok6cf5r3pflscat4yrpkmwma"
+)
+
+// registries runs test against the contract on a simulated chain and against the local registry
+func registries(t *testing.T, test func(t *testing.T, registry resolver.NameRegistry, accounts []*bind.TransactOpts)) {
+	t.Run("contract", func(t *testing.T) {
+		chain := contracttest.New(t, 2)
+		test(t, chain.Client, chain.Accounts)
+	})
+	t.Run("local", func(t *testing.T) {
+		accounts := make([]*bind.TransactOpts, 2)
+		for i := range accounts {
+			key, err := crypto.GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			accounts[i], err = bind.NewKeyedTransactorWithChainID(key, big.NewInt(contracttest.ChainID))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		test(t, resolver.NewLocalRegistry(storage.NewMemoryStore()), accounts)
+	})
+}
+
+func TestUpdateMappingRegistersAndUpdates(t *testing.T) {
+	registries(t, func(t *testing.T, registry resolver.NameRegistry, accounts []*bind.TransactOpts) {
+		alice := accounts[0]
+		pinner := pin.NewPinner(storage.NewMemoryStore())
+		r := resolver.NewResolver(registry, pinner)
+
+		if err := r.UpdateMapping(alice, "example.com", cidA); err != nil {
+			t.Fatalf("UpdateMapping (register): %v", err)
+		}
+		if owner, err := registry.GetOwner("example.com"); err != nil || owner != alice.From {
+			t.Fatalf("GetOwner = %s, %v; want %s", owner, err, alice.From)
+		}
+
+		if err := r.UpdateMapping(alice, "example.com", cidB); err != nil {
+			t.Fatalf("UpdateMapping (update): %v", err)
+		}
+		if cid, err := registry.ResolveCID("example.com"); err != nil || cid != cidB {
+			t.Fatalf("registry CID = %q, %v; want %q", cid, err, cidB)
+		}
+		if cid, err := r.ResolveDomain("example.com"); err != nil || cid != cidB {
+			t.Fatalf("ResolveDomain = %q, %v; want %q", cid, err, cidB)
+		}
+
+		pins, err := pinner.Pins(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pins) != 1 || pins[0].Name != "example.com" || pins[0].CID != cidB {
+			t.Fatalf("pins = %+v, want example.com pinned to %s", pins, cidB)
+		}
+	})
+}
+
+func TestUpdateMappingNotAuthorized(t *testing.T) {
+	registries(t, func(t *testing.T, registry resolver.NameRegistry, accounts []*bind.TransactOpts) {
+		alice, bob := accounts[0], accounts[1]
+		r := resolver.NewResolver(registry, pin.NewPinner(storage.NewMemoryStore()))
+
+		if err := r.UpdateMapping(alice, "example.com", cidA); err != nil {
+			t.Fatalf("UpdateMapping: %v", err)
+		}
+		err := r.UpdateMapping(bob, "example.com", cidB)
+		if err == nil || err.Error() != "not authorized to update this name" {
+			t.Fatalf("UpdateMapping by non-owner: got %v, want not authorized", err)
+		}
+		if cid, _ := r.ResolveDomain("example.com"); cid != cidA {
+			t.Fatalf("ResolveDomain after rejected update = %q, want %q", cid, cidA)
+		}
+
+		// After a transfer the new owner may update and the previous one may not
+		if err := registry.TransferOwnership(alice, "example.com", bob.From); err != nil {
+			t.Fatalf("TransferOwnership: %v", err)
+		}
+		if err := r.UpdateMapping(bob, "example.com", cidB); err != nil {
+			t.Fatalf("UpdateMapping by new owner: %v", err)
+		}
+		if err := r.UpdateMapping(alice, "example.com", cidA); err == nil {
+			t.Fatal("UpdateMapping by previous owner succeeded")
+		}
+	})
+}
+
+func TestResolverCache(t *testing.T) {
+	registries(t, func(t *testing.T, registry resolver.NameRegistry, accounts []*bind.TransactOpts) {
+		alice := accounts[0]
+		r := resolver.NewResolver(registry, pin.NewPinner(storage.NewMemoryStore()))
+
+		if _, found, err := r.GetMapping("example.com"); err != nil || found {
+			t.Fatalf("GetMapping of unregistered name = %v, %v; want not found", found, err)
+		}
+		if _, err := r.ResolveDomain("example.com"); err == nil {
+			t.Fatal("ResolveDomain of unregistered name succeeded")
+		}
+
+		// Registered outside the resolver with a legacy hex CID: the cached miss holds until the
+		// name is refreshed, which reads the registry and caches the CIDv1 form
+		if err := registry.RegisterName(alice, "example.com", legacyHex); err != nil {
+			t.Fatalf("RegisterName: %v", err)
+		}
+		if _, err := r.ResolveDomain("example.com"); !errors.Is(err, resolver.ErrNotFound) {
+			t.Fatalf("ResolveDomain of a cached miss = %v, want ErrNotFound", err)
+		}
+		if cid, err := r.Refresh("example.com"); err != nil || cid != legacyV1 {
+			t.Fatalf("Refresh = %q, %v; want %q", cid, err, legacyV1)
+		}
+
+		// Without a watcher or TTL, changes made outside the resolver are not seen while the name is cached
+		if err := registry.UpdateCID(alice, "example.com", cidB); err != nil {
+			t.Fatalf("UpdateCID: %v", err)
+		}
+		if cid, _ := r.ResolveDomain("example.com"); cid != legacyV1 {
+			t.Fatalf("cached ResolveDomain = %q, want %q", cid, legacyV1)
+		}
+		if cid, found, _ := r.GetMapping("example.com"); !found || cid != legacyV1 {
+			t.Fatalf("cached GetMapping = %q, %v; want %q", cid, found, legacyV1)
+		}
+
+		// A resolver with an empty cache sees the change
+		fresh := resolver.NewResolver(registry, pin.NewPinner(storage.NewMemoryStore()))
+		if cid, _ := fresh.ResolveDomain("example.com"); cid != cidB {
+			t.Fatalf("uncached ResolveDomain = %q, want %q", cid, cidB)
+		}
+	})
+}
+
+func TestTransferOwnership(t *testing.T) {
+	registries(t, func(t *testing.T, registry resolver.NameRegistry, accounts []*bind.TransactOpts) {
+		alice, bob := accounts[0], accounts[1]
+		r := resolver.NewResolver(registry, pin.NewPinner(storage.NewMemoryStore()))
+
+		if err := r.TransferOwnership(alice, "example.com", bob.From); !errors.Is(err, resolver.ErrNotFound) {
+			t.Fatalf("TransferOwnership of unregistered name = %v, want ErrNotFound", err)
+		}
+		if err := r.UpdateMapping(alice, "example.com", cidA); err != nil {
+			t.Fatalf("UpdateMapping: %v", err)
+		}
+		if err := r.TransferOwnership(bob, "example.com", bob.From); !errors.Is(err, resolver.ErrNotAuthorized) {
+			t.Fatalf("TransferOwnership by non-owner = %v, want ErrNotAuthorized", err)
+		}
+		if err := r.TransferOwnership(alice, "example.com", bob.From); err != nil {
+			t.Fatalf("TransferOwnership: %v", err)
+		}
+		if owner, err := r.GetOwner("example.com"); err != nil || owner != bob.From {
+			t.Fatalf("GetOwner = %s, %v; want %s", owner, err, bob.From)
+		}
+		if cid, err := r.ResolveDomain("example.com"); err != nil || cid != cidA {
+			t.Fatalf("ResolveDomain after transfer = %q, %v; want %q", cid, err, cidA)
+		}
+	})
+}
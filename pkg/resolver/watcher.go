@@ -0,0 +1,85 @@
+package resolver
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"ipfs-gin-example/pkg/contract"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Watch refreshes cached names whose CID or owner changes on the contract, whoever changed them,
+// until ctx is done. It follows the contract logs through a subscription when the connection
+// supports one, and otherwise polls for new logs every pollInterval.
+func (r *Resolver) Watch(ctx context.Context, client *contract.Client, pollInterval time.Duration) {
+	changed := make(chan common.Hash)
+	sub, err := client.SubscribeChangedNames(ctx, changed)
+	if err == nil {
+		log.Println("Resolver: watching name changes through a log subscription")
+		for {
+			select {
+			case hash := <-changed:
+				r.invalidate(hash)
+			case err := <-sub.Err():
+				log.Printf("Resolver: log subscription failed, polling instead: %v", err)
+				r.poll(ctx, client, pollInterval)
+				return
+			case <-ctx.Done():
+				sub.Unsubscribe()
+				return
+			}
+		}
+	}
+	log.Printf("Resolver: log subscription unavailable, polling for name changes every %s: %v", pollInterval, err)
+	r.poll(ctx, client, pollInterval)
+}
+
+// poll checks the blocks mined since the last poll for name changes every interval
+func (r *Resolver) poll(ctx context.Context, client *contract.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last uint64
+	started := false
+	for {
+		header, err := client.Header(ctx, nil)
+		if err != nil {
+			log.Printf("Resolver: failed to get latest block: %v", err)
+		} else if latest := header.Number.Uint64(); !started {
+			last, started = latest, true
+		} else if latest > last {
+			hashes, err := client.ChangedNames(ctx, last+1, latest)
+			if err != nil {
+				log.Printf("Resolver: failed to get name changes: %v", err)
+			} else {
+				for _, hash := range hashes {
+					r.invalidate(hash)
+				}
+				last = latest
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// invalidate refreshes the cached CID and owner of the name with the given hash. Names that are
+// not cached are read from the registry on their next lookup anyway.
+func (r *Resolver) invalidate(hash common.Hash) {
+	name, ok := r.hashes.Get(hash)
+	if !ok || !r.cache.Contains(name) && !r.owners.Contains(name) {
+		return
+	}
+	cid, err := r.Refresh(name)
+	if err != nil {
+		log.Printf("Resolver: failed to refresh %s after it changed: %v", name, err)
+		return
+	}
+	log.Printf("Resolver: %s changed on the contract, now %s", name, cid)
+}
@@ -0,0 +1,121 @@
+package resolver_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ipfs-gin-example/pkg/contract"
+	"ipfs-gin-example/pkg/contract/contracttest"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/resolver"
+	"ipfs-gin-example/pkg/storage"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+// waitResolve polls the resolver until name resolves to want
+func waitResolve(t *testing.T, r *resolver.Resolver, name, want string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		cid, err := r.ResolveDomain(name)
+		if err == nil && cid == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ResolveDomain(%s) = %q, %v; want %q", name, cid, err, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResolverCacheTTL(t *testing.T) {
+	registries(t, func(t *testing.T, registry resolver.NameRegistry, accounts []*bind.TransactOpts) {
+		alice := accounts[0]
+		r := resolver.NewResolver(registry, pin.NewPinner(storage.NewMemoryStore()))
+		r.CacheTTL = 50 * time.Millisecond
+
+		if err := r.UpdateMapping(alice, "example.com", cidA); err != nil {
+			t.Fatalf("UpdateMapping: %v", err)
+		}
+		if err := registry.UpdateCID(alice, "example.com", cidB); err != nil {
+			t.Fatalf("UpdateCID: %v", err)
+		}
+		if cid, _ := r.ResolveDomain("example.com"); cid != cidA {
+			t.Fatalf("cached ResolveDomain = %q, want %q", cid, cidA)
+		}
+		time.Sleep(2 * r.CacheTTL)
+		if cid, err := r.ResolveDomain("example.com"); err != nil || cid != cidB {
+			t.Fatalf("ResolveDomain after TTL = %q, %v; want %q", cid, err, cidB)
+		}
+	})
+}
+
+// unsubscribable mines every transaction and, like a node reached over HTTP, rejects log subscriptions
+type unsubscribable struct {
+	simulated.Client
+	backend *simulated.Backend
+}
+
+func (u *unsubscribable) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := u.Client.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	u.backend.Commit()
+	return nil
+}
+
+func (u *unsubscribable) SubscribeFilterLogs(context.Context, ethereum.FilterQuery, chan<- types.Log) (ethereum.Subscription, error) {
+	return nil, errors.New("notifications not supported")
+}
+
+func TestWatchRefreshesChangedNames(t *testing.T) {
+	for _, mode := range []string{"subscription", "polling"} {
+		t.Run(mode, func(t *testing.T) {
+			chain := contracttest.New(t, 1)
+			alice := chain.Accounts[0]
+			client := chain.Client
+			if mode == "polling" {
+				var err error
+				client, err = contract.NewClientWithBackend(&unsubscribable{Client: chain.Backend.Client(), backend: chain.Backend}, chain.Address)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			pinner := pin.NewPinner(storage.NewMemoryStore())
+			r := resolver.NewResolver(client, pinner)
+			if err := r.UpdateMapping(alice, "example.com", cidA); err != nil {
+				t.Fatalf("UpdateMapping: %v", err)
+			}
+			if cid, err := r.ResolveDomain("example.com"); err != nil || cid != cidA {
+				t.Fatalf("ResolveDomain = %q, %v; want %q", cid, err, cidA)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go r.Watch(ctx, client, 10*time.Millisecond)
+			time.Sleep(100 * time.Millisecond) // Let the watcher subscribe or take its first poll
+
+			// Updated directly on the contract, as another gateway would
+			if err := client.UpdateCID(alice, "example.com", cidB); err != nil {
+				t.Fatalf("UpdateCID: %v", err)
+			}
+			waitResolve(t, r, "example.com", cidB)
+
+			// The new root was not built here, so the name keeps pinning the content it had
+			pins, err := pinner.Pins(context.Background())
+			if err != nil {
+				t.Fatalf("Pins: %v", err)
+			}
+			if len(pins) != 1 || pins[0].CID != cidA {
+				t.Fatalf("pins = %+v, want only %s", pins, cidA)
+			}
+		})
+	}
+}
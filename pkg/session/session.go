@@ -0,0 +1,337 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/storage"
+)
+
+// sessionKeyPrefix prefixes the keys sessions are persisted under
+const sessionKeyPrefix = "/sessions/"
+
+// Session states
+const (
+	Open       = "open"
+	Committing = "committing"
+	Committed  = "committed"
+)
+
+// Operations staged in a session
+const (
+	OpPut    = "put"
+	OpRemove = "rm"
+	OpMove   = "mv"
+)
+
+var (
+	// ErrNotFound is returned for an unknown session ID
+	ErrNotFound = errors.New("session not found")
+	// ErrNotOpen is returned when a session that is being or has been committed is edited
+	ErrNotOpen = errors.New("session is not open")
+)
+
+// Session stages edits of a name's directory DAG. Each edit replaces the working root; the
+// name itself only changes when the session is committed.
+type Session struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Account   string    `json:"account"`  // Address that opened the session and may edit and commit it
+	BaseCID   string    `json:"base_cid"` // CID of the name when the session opened, "" if it was not registered
+	Root      string    `json:"root"`     // Working root with every staged operation applied
+	Ops       []Op      `json:"ops"`
+	State     string    `json:"state"`
+	JobID     string    `json:"job_id,omitempty"` // Queued name update of a committed session
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Op is an operation staged in a session
+type Op struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	To   string `json:"to,omitempty"`  // Destination of a move
+	CID  string `json:"cid,omitempty"` // Content of a put
+}
+
+// Sessions persists staging sessions in the block store and pins their working roots, so
+// garbage collection keeps staged blocks until the session is closed. Reap closes sessions
+// that were abandoned or whose committed update is done.
+type Sessions struct {
+	store  storage.Store
+	pinner *pin.Pinner
+	TTL    time.Duration // How long a session may go without edits before it is closed
+
+	mu sync.Mutex // Serializes session record writes
+}
+
+// defaultTTL is the default Sessions.TTL
+const defaultTTL = 24 * time.Hour
+
+// NewSessions creates a Sessions backed by store
+func NewSessions(store storage.Store, pinner *pin.Pinner) *Sessions {
+	return &Sessions{store: store, pinner: pinner, TTL: defaultTTL}
+}
+
+// Open starts a session editing name on behalf of account, from the name's current CID
+// baseCID, which is "" for a name that is not registered yet.
+func (s *Sessions) Open(name, account, baseCID string) (*Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	session := &Session{
+		ID:        id,
+		Name:      name,
+		Account:   account,
+		BaseCID:   baseCID,
+		Root:      baseCID,
+		Ops:       []Op{},
+		State:     Open,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if baseCID != "" {
+		if err := s.pinner.PinSession(id, baseCID); err != nil {
+			return nil, fmt.Errorf("failed to pin base of session %s: %w", id, err)
+		}
+	}
+	if err := s.save(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Get returns a session by ID
+func (s *Sessions) Get(id string) (*Session, error) {
+	data, err := s.store.Get([]byte(sessionKeyPrefix + id))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %w", id, err)
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session %s: %w", id, err)
+	}
+	return &session, nil
+}
+
+// Edit stages op in an open session. edit derives the new working root from the current one;
+// edits of one session are applied one at a time, so none is lost.
+func (s *Sessions) Edit(id string, op Op, edit func(root string) (string, error)) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.State != Open {
+		return nil, fmt.Errorf("%w: %s is %s", ErrNotOpen, id, session.State)
+	}
+	root, err := edit(session.Root)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.pinner.PinSession(id, root); err != nil {
+		return nil, fmt.Errorf("failed to pin root of session %s: %w", id, err)
+	}
+	session.Root = root
+	session.Ops = append(session.Ops, op)
+	session.UpdatedAt = time.Now().UTC()
+	if err := s.saveLocked(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// StartCommit marks an open session as committing, so it takes no more edits while its root is
+// published, and returns it. AbortCommit reopens it if publishing fails.
+func (s *Sessions) StartCommit(id string) (*Session, error) {
+	return s.setState(id, Open, Committing, "")
+}
+
+// AbortCommit reopens a session whose commit failed
+func (s *Sessions) AbortCommit(id string) error {
+	_, err := s.setState(id, Committing, Open, "")
+	return err
+}
+
+// FinishCommit records that the root of a committing session was published. A queued update
+// leaves the session committed with its job, still pinning the root until the session is
+// closed; an update that is already mined closes the session.
+func (s *Sessions) FinishCommit(id, jobID string) (*Session, error) {
+	if jobID != "" {
+		return s.setState(id, Committing, Committed, jobID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	session.State = Committed
+	return session, s.closeLocked(id)
+}
+
+// Close deletes a session that is not being committed and unpins its working root. Content
+// that was committed stays pinned by its name once the update is mined.
+func (s *Sessions) Close(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if session.State == Committing {
+		return fmt.Errorf("%w: %s is %s", ErrNotOpen, id, session.State)
+	}
+	return s.closeLocked(id)
+}
+
+// Run reaps sessions every interval until ctx is done
+func (s *Sessions) Run(ctx context.Context, interval time.Duration, jobDone func(jobID string) (bool, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if closed, err := s.Reap(ctx, jobDone); err != nil && ctx.Err() == nil {
+			log.Printf("Sessions: %v", err)
+		} else if closed > 0 {
+			log.Printf("Sessions: closed %d sessions", closed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reap closes the sessions that are done with, releasing their pins, and returns how many it
+// closed: committed sessions whose queued update jobDone reports mined or failed, and sessions
+// without edits or a commit for longer than TTL. jobDone may be nil when updates are not queued.
+func (s *Sessions) Reap(ctx context.Context, jobDone func(jobID string) (bool, error)) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stops key iteration on early return
+
+	keys, keysErr := s.store.AllKeys(ctx, []byte(sessionKeyPrefix))
+	var ids []string
+	for key := range keys {
+		ids = append(ids, strings.TrimPrefix(string(key), sessionKeyPrefix))
+	}
+	if err := keysErr(); err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	for _, id := range ids {
+		done, err := s.reap(id, jobDone)
+		if err != nil {
+			return closed, err
+		}
+		if done {
+			closed++
+		}
+	}
+	return closed, nil
+}
+
+// reap closes session id if it is done with
+func (s *Sessions) reap(id string, jobDone func(jobID string) (bool, error)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.Get(id)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil // Closed meanwhile
+	}
+	if err != nil {
+		return false, err
+	}
+	done := s.TTL > 0 && time.Since(session.UpdatedAt) > s.TTL
+	if session.State == Committed && session.JobID != "" && jobDone != nil {
+		if done, err = jobDone(session.JobID); err != nil {
+			return false, fmt.Errorf("failed to check job %s of session %s: %w", session.JobID, id, err)
+		}
+	}
+	if !done {
+		return false, nil
+	}
+	return true, s.closeLocked(id)
+}
+
+// closeLocked deletes a session and its pin; s.mu must be held
+func (s *Sessions) closeLocked(id string) error {
+	if err := s.pinner.UnpinSession(id); err != nil {
+		return fmt.Errorf("failed to unpin session %s: %w", id, err)
+	}
+	if err := s.store.Delete([]byte(sessionKeyPrefix + id)); err != nil {
+		return fmt.Errorf("failed to delete session %s: %w", id, err)
+	}
+	return nil
+}
+
+// setState moves a session from state from to state to
+func (s *Sessions) setState(id, from, to, jobID string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.State != from {
+		return nil, fmt.Errorf("%w: %s is %s", ErrNotOpen, id, session.State)
+	}
+	session.State = to
+	if jobID != "" {
+		session.JobID = jobID
+	}
+	session.UpdatedAt = time.Now().UTC()
+	if err := s.saveLocked(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// save persists a session
+func (s *Sessions) save(session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked(session)
+}
+
+// saveLocked persists a session; s.mu must be held
+func (s *Sessions) saveLocked(session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Put([]byte(sessionKeyPrefix+session.ID), data); err != nil {
+		return fmt.Errorf("failed to save session %s: %w", session.ID, err)
+	}
+	return nil
+}
+
+// newSessionID returns a random session ID
+func newSessionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	return hex.EncodeToString(id), nil
+}
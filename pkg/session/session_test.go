@@ -0,0 +1,184 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ipfs-gin-example/pkg/merkledag"
+	"ipfs-gin-example/pkg/pin"
+	"ipfs-gin-example/pkg/session"
+	"ipfs-gin-example/pkg/storage"
+)
+
+const account = "0x62B7C251FeF3e6EabB3921180706aE207A46818e"
+
+// put stages a file with the given content at path
+func put(t *testing.T, s *session.Sessions, dag *merkledag.DAGBuilder, id, path, content string) (*session.Session, error) {
+	t.Helper()
+	fileCID, size, err := dag.BuildDAGFromReader(strings.NewReader(content), merkledag.NewChunker(1024))
+	if err != nil {
+		t.Fatalf("BuildDAGFromReader: %v", err)
+	}
+	return s.Edit(id, session.Op{Op: session.OpPut, Path: path, CID: fileCID}, func(root string) (string, error) {
+		return dag.PutNodeAtPath(root, path, fileCID, size)
+	})
+}
+
+func TestStagedBlocksSurviveGC(t *testing.T) {
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	if err := pinner.BackfillNames(nil); err != nil {
+		t.Fatalf("BackfillNames: %v", err)
+	}
+	dag := merkledag.NewDAGBuilder(store)
+	s := session.NewSessions(store, pinner)
+
+	opened, err := s.Open("example.com", account, "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := put(t, s, dag, opened.ID, "/docs/a.txt", "a"); err != nil {
+		t.Fatalf("put a: %v", err)
+	}
+	staged, err := put(t, s, dag, opened.ID, "/docs/b.txt", "b")
+	if err != nil {
+		t.Fatalf("put b: %v", err)
+	}
+	if len(staged.Ops) != 2 {
+		t.Fatalf("ops = %+v, want both puts", staged.Ops)
+	}
+
+	if _, err := pinner.GC(context.Background(), dag, false); err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	for _, path := range []string{"/docs/a.txt", "/docs/b.txt"} {
+		cid, err := dag.ResolvePath(staged.Root, path)
+		if err != nil {
+			t.Fatalf("ResolvePath(%s) after GC: %v", path, err)
+		}
+		if _, err := dag.GetFileData(cid); err != nil {
+			t.Fatalf("GetFileData(%s) after GC: %v", path, err)
+		}
+	}
+
+	if err := s.Close(opened.ID); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	report, err := pinner.GC(context.Background(), dag, false)
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if len(report.Removed) == 0 {
+		t.Fatal("GC after Close removed nothing, want the staged blocks collected")
+	}
+}
+
+func TestCommitStates(t *testing.T) {
+	store := storage.NewMemoryStore()
+	dag := merkledag.NewDAGBuilder(store)
+	s := session.NewSessions(store, pin.NewPinner(store))
+
+	opened, err := s.Open("example.com", account, "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := s.StartCommit(opened.ID); err != nil {
+		t.Fatalf("StartCommit: %v", err)
+	}
+	if _, err := put(t, s, dag, opened.ID, "/a.txt", "a"); !errors.Is(err, session.ErrNotOpen) {
+		t.Fatalf("Edit while committing = %v, want ErrNotOpen", err)
+	}
+	if err := s.Close(opened.ID); !errors.Is(err, session.ErrNotOpen) {
+		t.Fatalf("Close while committing = %v, want ErrNotOpen", err)
+	}
+
+	if err := s.AbortCommit(opened.ID); err != nil {
+		t.Fatalf("AbortCommit: %v", err)
+	}
+	if _, err := put(t, s, dag, opened.ID, "/a.txt", "a"); err != nil {
+		t.Fatalf("Edit after AbortCommit: %v", err)
+	}
+
+	if _, err := s.StartCommit(opened.ID); err != nil {
+		t.Fatalf("StartCommit: %v", err)
+	}
+	committed, err := s.FinishCommit(opened.ID, "job-1")
+	if err != nil {
+		t.Fatalf("FinishCommit: %v", err)
+	}
+	if committed.State != session.Committed || committed.JobID != "job-1" {
+		t.Fatalf("session = %+v, want committed with job-1", committed)
+	}
+	if _, err := s.StartCommit(opened.ID); !errors.Is(err, session.ErrNotOpen) {
+		t.Fatalf("second StartCommit = %v, want ErrNotOpen", err)
+	}
+
+	if err := s.Close(opened.ID); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := s.Get(opened.ID); !errors.Is(err, session.ErrNotFound) {
+		t.Fatalf("Get after Close = %v, want ErrNotFound", err)
+	}
+}
+
+func TestReap(t *testing.T) {
+	store := storage.NewMemoryStore()
+	pinner := pin.NewPinner(store)
+	dag := merkledag.NewDAGBuilder(store)
+	s := session.NewSessions(store, pinner)
+
+	abandoned, err := s.Open("example.com", account, "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := put(t, s, dag, abandoned.ID, "/a.txt", "a"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	committed, err := s.Open("example.org", account, "")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := put(t, s, dag, committed.ID, "/b.txt", "b"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if _, err := s.StartCommit(committed.ID); err != nil {
+		t.Fatalf("StartCommit: %v", err)
+	}
+	if _, err := s.FinishCommit(committed.ID, "job"); err != nil {
+		t.Fatalf("FinishCommit: %v", err)
+	}
+
+	mined := false
+	jobDone := func(id string) (bool, error) {
+		if id != "job" {
+			t.Fatalf("jobDone(%s), want the job of the committed session", id)
+		}
+		return mined, nil
+	}
+	if closed, err := s.Reap(context.Background(), jobDone); err != nil || closed != 0 {
+		t.Fatalf("Reap of fresh sessions = %d, %v; want none closed", closed, err)
+	}
+
+	// The committed session is closed once its job is done, the open one once it expires
+	mined = true
+	if closed, err := s.Reap(context.Background(), jobDone); err != nil || closed != 1 {
+		t.Fatalf("Reap after the job is done = %d, %v; want 1 closed", closed, err)
+	}
+	if _, err := s.Get(committed.ID); !errors.Is(err, session.ErrNotFound) {
+		t.Fatalf("Get of the reaped session = %v, want ErrNotFound", err)
+	}
+	s.TTL = time.Nanosecond
+	if closed, err := s.Reap(context.Background(), jobDone); err != nil || closed != 1 {
+		t.Fatalf("Reap after the TTL = %d, %v; want 1 closed", closed, err)
+	}
+	pins, err := pinner.Pins(context.Background())
+	if err != nil {
+		t.Fatalf("Pins: %v", err)
+	}
+	if len(pins) != 0 {
+		t.Fatalf("pins after reaping = %+v, want none", pins)
+	}
+}
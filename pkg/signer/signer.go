@@ -0,0 +1,108 @@
+package signer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrUnknownAPIKey is returned for a missing or unrecognized API key
+	ErrUnknownAPIKey = errors.New("unknown API key")
+	// ErrNoAPIKeys is returned by KeyedTransactor when no API keys file is configured
+	ErrNoAPIKeys = errors.New("no API keys are configured")
+)
+
+// apiKeyEntry is one entry of the API keys file, which maps API keys to keystore accounts:
+//
+//	{"<api key>": {"account": "0x...", "password": "<keystore passphrase>"}}
+type apiKeyEntry struct {
+	Account  string `json:"account"`
+	Password string `json:"password"`
+}
+
+// Signers holds the accounts name transactions are signed with. Each API key maps to its
+// own keystore account, so names registered by a client are owned by that client's address.
+// Without an API keys file every request is signed with the single legacy private key.
+type Signers struct {
+	keys     map[string]*bind.TransactOpts // API key -> transactor of its account
+	fallback *bind.TransactOpts            // Legacy server-wide key; nil when API keys are configured
+}
+
+// NewSigners unlocks the keystore accounts listed in apiKeysFile. If apiKeysFile is empty,
+// privateKey is used for every request instead.
+func NewSigners(keystoreDir, apiKeysFile, privateKey string, chainID int64) (*Signers, error) {
+	if apiKeysFile == "" {
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(privateKey, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(chainID))
+		if err != nil {
+			return nil, err
+		}
+		return &Signers{fallback: auth}, nil
+	}
+
+	data, err := os.ReadFile(apiKeysFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+	var entries map[string]apiKeyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+
+	ks := keystore.NewKeyStore(keystoreDir, keystore.StandardScryptN, keystore.StandardScryptP)
+	signers := &Signers{keys: make(map[string]*bind.TransactOpts, len(entries))}
+	for apiKey, entry := range entries {
+		if apiKey == "" || !common.IsHexAddress(entry.Account) {
+			return nil, fmt.Errorf("invalid API keys file entry for account %q", entry.Account)
+		}
+		account, err := ks.Find(accounts.Account{Address: common.HexToAddress(entry.Account)})
+		if err != nil {
+			return nil, fmt.Errorf("account %s not in keystore %s: %w", entry.Account, keystoreDir, err)
+		}
+		if err := ks.Unlock(account, entry.Password); err != nil {
+			return nil, fmt.Errorf("failed to unlock account %s: %w", entry.Account, err)
+		}
+		auth, err := bind.NewKeyStoreTransactorWithChainID(ks, account, big.NewInt(chainID))
+		if err != nil {
+			return nil, err
+		}
+		signers.keys[apiKey] = auth
+	}
+	return signers, nil
+}
+
+// Transactor returns a transactor for the account of apiKey. Each call returns a fresh
+// copy, so callers may set per-transaction fields such as the nonce or context.
+func (s *Signers) Transactor(apiKey string) (*bind.TransactOpts, error) {
+	auth := s.fallback
+	if auth == nil {
+		auth = s.keys[apiKey]
+	}
+	if auth == nil {
+		return nil, ErrUnknownAPIKey
+	}
+	opts := *auth
+	return &opts, nil
+}
+
+// KeyedTransactor is like Transactor but never falls back to the legacy private key, for
+// actions that must be taken by the requesting client's own account, such as giving a name away.
+func (s *Signers) KeyedTransactor(apiKey string) (*bind.TransactOpts, error) {
+	if s.fallback != nil {
+		return nil, ErrNoAPIKeys
+	}
+	return s.Transactor(apiKey)
+}
@@ -1,18 +1,12 @@
 package storage
 
 import (
+	"context"
 	"errors"
 
 	badger "github.com/dgraph-io/badger/v4"
 )
 
-// Store defines the interface for block storage
-type Store interface {
-	Put(cid []byte, data []byte) error
-	Get(cid []byte) ([]byte, error)
-	Close() error
-}
-
 // BadgerStore is a BadgerDB implementation of the Store interface
 type BadgerStore struct {
 	db *badger.DB
@@ -39,6 +33,18 @@ func (s *BadgerStore) Put(cid []byte, data []byte) error {
 	return err
 }
 
+// PutMany stores blocks in BadgerDB with a single WriteBatch
+func (s *BadgerStore) PutMany(blocks []Block) error {
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, block := range blocks {
+		if err := wb.Set(block.Key, block.Data); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
 // Get retrieves a block from BadgerDB
 func (s *BadgerStore) Get(cid []byte) ([]byte, error) {
 	var data []byte
@@ -52,11 +58,69 @@ func (s *BadgerStore) Get(cid []byte) ([]byte, error) {
 	})
 
 	if errors.Is(err, badger.ErrKeyNotFound) {
-		return nil, errors.New("block not found")
+		return nil, ErrNotFound
 	}
 	return data, err
 }
 
+// GetSize returns the size of a block in BadgerDB
+func (s *BadgerStore) GetSize(cid []byte) (int, error) {
+	var size int
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(cid)
+		if err != nil {
+			return err
+		}
+		size = int(item.ValueSize())
+		return nil
+	})
+
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return 0, ErrNotFound
+	}
+	return size, err
+}
+
+// Has reports whether a block exists in BadgerDB
+func (s *BadgerStore) Has(cid []byte) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(cid)
+		return err
+	})
+
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete removes a block from BadgerDB. Deleting a missing key is not an error.
+func (s *BadgerStore) Delete(cid []byte) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(cid)
+	})
+}
+
+// AllKeys streams the keys in BadgerDB that start with prefix
+func (s *BadgerStore) AllKeys(ctx context.Context, prefix []byte) (<-chan []byte, func() error) {
+	return streamKeys(ctx, func(send func([]byte) error) error {
+		return s.db.View(func(txn *badger.Txn) error {
+			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = false // Only keys are needed
+			opts.Prefix = prefix
+			it := txn.NewIterator(opts)
+			defer it.Close()
+
+			for it.Rewind(); it.Valid(); it.Next() {
+				if err := send(it.Item().KeyCopy(nil)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
 // Close closes the BadgerDB
 func (s *BadgerStore) Close() error {
 	return s.db.Close()
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// flatfsExt is the extension of block files; temporary files use other names and are skipped
+const flatfsExt = ".data"
+
+// flatfsMaxName is the longest file name most file systems accept (NAME_MAX), and
+// flatfsSegment the length of the directory names a longer hex-encoded key is split into
+const (
+	flatfsMaxName = 255
+	flatfsSegment = 250
+)
+
+// FlatFSStore is a flat-file implementation of the Store interface.
+// Every block is a file named after its hex-encoded key, sharded into
+// directories by the next-to-last two characters of the name, like go-ipfs's flatfs.
+// Names too long for a file, such as those of long metadata keys, are split into
+// nested directories, which hold no block files of their own.
+type FlatFSStore struct {
+	root string
+}
+
+// NewFlatFSStore creates a new FlatFSStore rooted at path
+func NewFlatFSStore(path string) (*FlatFSStore, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, err
+	}
+	return &FlatFSStore{root: path}, nil
+}
+
+// blockPath returns the directory and file path of a key.
+// Keys may contain "/" and other characters that are unsafe in file names, hence the hex encoding.
+func (s *FlatFSStore) blockPath(cid []byte) (string, string) {
+	name := hex.EncodeToString(cid)
+	shard := "__"
+	if len(name) >= 3 {
+		shard = name[len(name)-3 : len(name)-1]
+	}
+	dir := filepath.Join(s.root, shard)
+	for len(name)+len(flatfsExt) > flatfsMaxName {
+		dir = filepath.Join(dir, name[:flatfsSegment])
+		name = name[flatfsSegment:]
+	}
+	return dir, filepath.Join(dir, name+flatfsExt)
+}
+
+// pathKey returns the key of the block file at path, the inverse of blockPath
+func (s *FlatFSStore) pathKey(path string) ([]byte, bool) {
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil {
+		return nil, false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 2 {
+		return nil, false // Not in a shard directory
+	}
+	key, err := hex.DecodeString(strings.TrimSuffix(strings.Join(parts[1:], ""), flatfsExt))
+	if err != nil {
+		return nil, false
+	}
+	return key, true
+}
+
+// Put writes a block to its file. The file is written under a temporary
+// name and renamed into place, so readers never see a partial block.
+func (s *FlatFSStore) Put(cid []byte, data []byte) error {
+	dir, path := s.blockPath(cid)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".put-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// PutMany writes blocks one file at a time; the file system has no batch write
+func (s *FlatFSStore) PutMany(blocks []Block) error {
+	for _, block := range blocks {
+		if err := s.Put(block.Key, block.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get reads a block from its file
+func (s *FlatFSStore) Get(cid []byte) ([]byte, error) {
+	_, path := s.blockPath(cid)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// GetSize returns the size of a block file
+func (s *FlatFSStore) GetSize(cid []byte) (int, error) {
+	_, path := s.blockPath(cid)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(info.Size()), nil
+}
+
+// Has reports whether a block file exists
+func (s *FlatFSStore) Has(cid []byte) (bool, error) {
+	_, err := s.GetSize(cid)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete removes a block file. Deleting a missing key is not an error. The directories of a
+// split name are left in place, as a concurrent Put may be about to write into them.
+func (s *FlatFSStore) Delete(cid []byte) error {
+	_, path := s.blockPath(cid)
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// AllKeys walks the shard directories and streams the keys that start with prefix
+func (s *FlatFSStore) AllKeys(ctx context.Context, prefix []byte) (<-chan []byte, func() error) {
+	return streamKeys(ctx, func(send func([]byte) error) error {
+		return filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return fmt.Errorf("failed to list %s: %w", path, err)
+			}
+			if d.IsDir() || !strings.HasSuffix(d.Name(), flatfsExt) {
+				return nil // Skip temporary files
+			}
+			key, ok := s.pathKey(path)
+			if !ok || !bytes.HasPrefix(key, prefix) {
+				return nil
+			}
+			return send(key)
+		})
+	})
+}
+
+// Close implements Store; there is nothing to release
+func (s *FlatFSStore) Close() error {
+	return nil
+}
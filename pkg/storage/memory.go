@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is an in-memory implementation of the Store interface.
+// Its content is lost on Close; it is meant for tests and throwaway setups.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	blocks map[string][]byte
+}
+
+// NewMemoryStore creates a new, empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blocks: make(map[string][]byte)}
+}
+
+// Put stores a copy of a block in memory
+func (s *MemoryStore) Put(cid []byte, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocks[string(cid)] = bytes.Clone(data)
+	return nil
+}
+
+// PutMany stores copies of blocks in memory
+func (s *MemoryStore) PutMany(blocks []Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, block := range blocks {
+		s.blocks[string(block.Key)] = bytes.Clone(block.Data)
+	}
+	return nil
+}
+
+// Get retrieves a copy of a block from memory
+func (s *MemoryStore) Get(cid []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.blocks[string(cid)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(data), nil
+}
+
+// GetSize returns the size of a block in memory
+func (s *MemoryStore) GetSize(cid []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.blocks[string(cid)]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return len(data), nil
+}
+
+// Has reports whether a block exists in memory
+func (s *MemoryStore) Has(cid []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.blocks[string(cid)]
+	return ok, nil
+}
+
+// Delete removes a block from memory
+func (s *MemoryStore) Delete(cid []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blocks, string(cid))
+	return nil
+}
+
+// AllKeys streams a sorted snapshot of the keys that start with prefix
+func (s *MemoryStore) AllKeys(ctx context.Context, prefix []byte) (<-chan []byte, func() error) {
+	s.mu.RLock()
+	var snapshot []string
+	for key := range s.blocks {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			snapshot = append(snapshot, key)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Strings(snapshot)
+
+	return streamKeys(ctx, func(send func([]byte) error) error {
+		for _, key := range snapshot {
+			if err := send([]byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close drops all blocks
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocks = make(map[string][]byte)
+	return nil
+}
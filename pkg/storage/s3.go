@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Object name prefixes in the bucket. Metadata keys start with "/", which object
+// stores handle poorly, so the leading slash is replaced by a prefix of its own.
+const (
+	s3BlockPrefix = "blocks/"
+	s3MetaPrefix  = "meta/"
+)
+
+// S3Config holds the connection settings of an S3-compatible object store
+type S3Config struct {
+	Endpoint  string // Host and port, e.g. "127.0.0.1:9000" for a local MinIO
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+}
+
+// S3Store is an S3-compatible object store implementation of the Store interface
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Store connects to an S3-compatible object store and creates the bucket if it does not exist
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", cfg.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", cfg.Bucket, err)
+		}
+	}
+
+	return &S3Store{client: client, bucket: cfg.Bucket}, nil
+}
+
+// objectName maps a store key to an object name
+func objectName(key []byte) string {
+	if strings.HasPrefix(string(key), "/") {
+		return s3MetaPrefix + string(key[1:])
+	}
+	return s3BlockPrefix + string(key)
+}
+
+// objectKey maps an object name back to a store key
+func objectKey(name string) ([]byte, bool) {
+	if strings.HasPrefix(name, s3MetaPrefix) {
+		return []byte("/" + strings.TrimPrefix(name, s3MetaPrefix)), true
+	}
+	if strings.HasPrefix(name, s3BlockPrefix) {
+		return []byte(strings.TrimPrefix(name, s3BlockPrefix)), true
+	}
+	return nil, false
+}
+
+// isNotFound reports whether err is the object store's "no such key" error
+func isNotFound(err error) bool {
+	return minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
+
+// Put uploads a block as an object
+func (s *S3Store) Put(cid []byte, data []byte) error {
+	_, err := s.client.PutObject(context.Background(), s.bucket, objectName(cid),
+		bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	return err
+}
+
+// PutMany uploads blocks one object at a time; the S3 API has no batch upload
+func (s *S3Store) PutMany(blocks []Block) error {
+	for _, block := range blocks {
+		if err := s.Put(block.Key, block.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get downloads a block object
+func (s *S3Store) Get(cid []byte) ([]byte, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, objectName(cid), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	// GetObject is lazy; a missing object only shows up on the first read
+	data, err := io.ReadAll(obj)
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// GetSize returns the size of a block object from its metadata
+func (s *S3Store) GetSize(cid []byte) (int, error) {
+	info, err := s.client.StatObject(context.Background(), s.bucket, objectName(cid), minio.StatObjectOptions{})
+	if isNotFound(err) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(info.Size), nil
+}
+
+// Has reports whether a block object exists
+func (s *S3Store) Has(cid []byte) (bool, error) {
+	_, err := s.GetSize(cid)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete removes a block object. Deleting a missing key is not an error.
+func (s *S3Store) Delete(cid []byte) error {
+	return s.client.RemoveObject(context.Background(), s.bucket, objectName(cid), minio.RemoveObjectOptions{})
+}
+
+// AllKeys lists the objects whose keys start with prefix
+func (s *S3Store) AllKeys(ctx context.Context, prefix []byte) (<-chan []byte, func() error) {
+	// An empty prefix spans both the block and the metadata namespace
+	listPrefixes := []string{s3BlockPrefix, s3MetaPrefix}
+	if len(prefix) > 0 {
+		listPrefixes = []string{objectName(prefix)}
+	}
+
+	return streamKeys(ctx, func(send func([]byte) error) error {
+		// Cancelling stops the listing goroutine of the client when we return early
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		for _, listPrefix := range listPrefixes {
+			for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: listPrefix, Recursive: true}) {
+				if obj.Err != nil {
+					return fmt.Errorf("failed to list objects under %s: %w", listPrefix, obj.Err)
+				}
+				key, ok := objectKey(obj.Key)
+				if !ok {
+					continue
+				}
+				if err := send(key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Close implements Store; the HTTP client needs no cleanup
+func (s *S3Store) Close() error {
+	return nil
+}
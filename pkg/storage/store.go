@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned by Get when a key does not exist in the store
+var ErrNotFound = errors.New("block not found")
+
+// Block is a key and its data, as written by PutMany
+type Block struct {
+	Key  []byte
+	Data []byte
+}
+
+// Store defines the interface for block storage
+type Store interface {
+	Put(cid []byte, data []byte) error
+	// PutMany stores several blocks, in a single batch where the backend supports it
+	PutMany(blocks []Block) error
+	// Get returns ErrNotFound if the key does not exist
+	Get(cid []byte) ([]byte, error)
+	// GetSize returns the size of a block without reading it, or ErrNotFound
+	GetSize(cid []byte) (int, error)
+	Has(cid []byte) (bool, error)
+	Delete(cid []byte) error
+	// AllKeys streams every key starting with prefix (all keys for an empty prefix).
+	// The channel is closed when iteration finishes, fails or ctx is cancelled; the returned
+	// function then reports why. A nil error means every key was listed. Callers that stop
+	// reading early must cancel ctx.
+	AllKeys(ctx context.Context, prefix []byte) (<-chan []byte, func() error)
+	Close() error
+}
+
+// streamKeys runs list in a goroutine and streams the keys it sends. send fails with
+// ctx.Err() once ctx is cancelled; list should then return that error.
+func streamKeys(ctx context.Context, list func(send func(key []byte) error) error) (<-chan []byte, func() error) {
+	keys := make(chan []byte)
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		defer close(keys)
+		err = list(func(key []byte) error {
+			select {
+			case keys <- key:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err == nil {
+			err = ctx.Err()
+		}
+	}()
+	return keys, func() error {
+		<-done
+		return err
+	}
+}
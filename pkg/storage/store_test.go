@@ -0,0 +1,268 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ipfs-gin-example/pkg/storage"
+)
+
+// backends opens an empty store of every backend. The S3 backend runs against the MinIO
+// (or other S3-compatible store) at STORAGE_TEST_S3_ENDPOINT, in a bucket of its own.
+var backends = map[string]func(t *testing.T) storage.Store{
+	"memory": func(t *testing.T) storage.Store {
+		return storage.NewMemoryStore()
+	},
+	"badger": func(t *testing.T) storage.Store {
+		store, err := storage.NewBadgerStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewBadgerStore: %v", err)
+		}
+		return store
+	},
+	"flatfs": func(t *testing.T) storage.Store {
+		store, err := storage.NewFlatFSStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFlatFSStore: %v", err)
+		}
+		return store
+	},
+	"s3": func(t *testing.T) storage.Store {
+		endpoint := os.Getenv("STORAGE_TEST_S3_ENDPOINT")
+		if endpoint == "" {
+			t.Skip("STORAGE_TEST_S3_ENDPOINT not set")
+		}
+		store, err := storage.NewS3Store(storage.S3Config{
+			Endpoint:  endpoint,
+			Bucket:    fmt.Sprintf("storage-test-%d", time.Now().UnixNano()),
+			AccessKey: envOr("STORAGE_TEST_S3_ACCESS_KEY", "minioadmin"),
+			SecretKey: envOr("STORAGE_TEST_S3_SECRET_KEY", "minioadmin"),
+		})
+		if err != nil {
+			t.Fatalf("NewS3Store: %v", err)
+		}
+		t.Cleanup(func() { deleteAll(t, store) })
+		return store
+	},
+}
+
+// envOr returns the environment variable key, or fallback if it is not set
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// forEachBackend runs test against an empty store of every backend
+func forEachBackend(t *testing.T, test func(t *testing.T, store storage.Store)) {
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			t.Cleanup(func() { store.Close() })
+			test(t, store)
+		})
+	}
+}
+
+// keys lists the keys under prefix, sorted
+func keys(t *testing.T, store storage.Store, prefix string) []string {
+	t.Helper()
+	ch, wait := store.AllKeys(context.Background(), []byte(prefix))
+	var listed []string
+	for key := range ch {
+		listed = append(listed, string(key))
+	}
+	if err := wait(); err != nil {
+		t.Fatalf("AllKeys(%q): %v", prefix, err)
+	}
+	slices.Sort(listed)
+	return listed
+}
+
+// deleteAll removes every key, so an S3 test leaves no objects behind
+func deleteAll(t *testing.T, store storage.Store) {
+	for _, key := range keys(t, store, "") {
+		if err := store.Delete([]byte(key)); err != nil {
+			t.Errorf("Delete(%q): %v", key, err)
+		}
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store storage.Store) {
+		key, data := []byte("bafkreiblock"), []byte("block data")
+		if err := store.Put(key, data); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if got, err := store.Get(key); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("Get = %q, %v; want %q", got, err, data)
+		}
+		if size, err := store.GetSize(key); err != nil || size != len(data) {
+			t.Fatalf("GetSize = %d, %v; want %d", size, err, len(data))
+		}
+		if ok, err := store.Has(key); err != nil || !ok {
+			t.Fatalf("Has = %v, %v; want true", ok, err)
+		}
+
+		// Put overwrites
+		if err := store.Put(key, []byte("new")); err != nil {
+			t.Fatalf("Put again: %v", err)
+		}
+		if got, err := store.Get(key); err != nil || string(got) != "new" {
+			t.Fatalf("Get after overwrite = %q, %v; want %q", got, err, "new")
+		}
+
+		// An empty block is stored, not missing
+		if err := store.Put([]byte("bafkreiempty"), nil); err != nil {
+			t.Fatalf("Put empty: %v", err)
+		}
+		if size, err := store.GetSize([]byte("bafkreiempty")); err != nil || size != 0 {
+			t.Fatalf("GetSize of empty block = %d, %v; want 0", size, err)
+		}
+	})
+}
+
+func TestNotFound(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store storage.Store) {
+		missing := []byte("bafkreimissing")
+		if _, err := store.Get(missing); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("Get = %v, want ErrNotFound", err)
+		}
+		if _, err := store.GetSize(missing); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("GetSize = %v, want ErrNotFound", err)
+		}
+		if ok, err := store.Has(missing); err != nil || ok {
+			t.Fatalf("Has = %v, %v; want false", ok, err)
+		}
+	})
+}
+
+func TestDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store storage.Store) {
+		key := []byte("bafkreidelete")
+		if err := store.Put(key, []byte("data")); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if err := store.Delete(key); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := store.Get(key); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("Get after Delete = %v, want ErrNotFound", err)
+		}
+		if ok, err := store.Has(key); err != nil || ok {
+			t.Fatalf("Has after Delete = %v, %v; want false", ok, err)
+		}
+		// Deleting a missing key is not an error
+		if err := store.Delete(key); err != nil {
+			t.Fatalf("Delete of a missing key: %v", err)
+		}
+	})
+}
+
+func TestPutMany(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store storage.Store) {
+		blocks := []storage.Block{
+			{Key: []byte("bafkreione"), Data: []byte("one")},
+			{Key: []byte("bafkreitwo"), Data: []byte("two")},
+		}
+		if err := store.PutMany(blocks); err != nil {
+			t.Fatalf("PutMany: %v", err)
+		}
+		for _, block := range blocks {
+			if got, err := store.Get(block.Key); err != nil || !bytes.Equal(got, block.Data) {
+				t.Fatalf("Get(%s) = %q, %v; want %q", block.Key, got, err, block.Data)
+			}
+		}
+	})
+}
+
+func TestAllKeys(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store storage.Store) {
+		all := []string{"/pin/recursive/a", "/pin/recursive/b", "/pins/x", "/session/s1", "bafkreia", "bafkreib"}
+		for _, key := range all {
+			if err := store.Put([]byte(key), []byte(key)); err != nil {
+				t.Fatalf("Put(%q): %v", key, err)
+			}
+		}
+
+		for _, tt := range []struct {
+			prefix string
+			want   []string
+		}{
+			{"", all},
+			{"/pin/", []string{"/pin/recursive/a", "/pin/recursive/b"}},
+			{"/pin", []string{"/pin/recursive/a", "/pin/recursive/b", "/pins/x"}},
+			{"/", []string{"/pin/recursive/a", "/pin/recursive/b", "/pins/x", "/session/s1"}},
+			{"bafkrei", []string{"bafkreia", "bafkreib"}},
+			{"/job/", nil},
+		} {
+			if got := keys(t, store, tt.prefix); !slices.Equal(got, tt.want) {
+				t.Errorf("AllKeys(%q) = %q, want %q", tt.prefix, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestLongKeys(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store storage.Store) {
+		// Deep names make metadata keys longer than a file name may be
+		deep := "/pins/name/example.com" + strings.Repeat("/subdomain-of-the-name", 16)
+		long := []string{deep, deep + "/1", "/history/" + strings.Repeat("ab", 32) + "/1234567/0", "/pins/name/short"}
+		for _, key := range long {
+			if err := store.Put([]byte(key), []byte(key)); err != nil {
+				t.Fatalf("Put of a %d-byte key: %v", len(key), err)
+			}
+		}
+		for _, key := range long {
+			if got, err := store.Get([]byte(key)); err != nil || string(got) != key {
+				t.Fatalf("Get of a %d-byte key = %q, %v", len(key), got, err)
+			}
+			if size, err := store.GetSize([]byte(key)); err != nil || size != len(key) {
+				t.Fatalf("GetSize of a %d-byte key = %d, %v; want %d", len(key), size, err, len(key))
+			}
+		}
+
+		want := []string{deep, deep + "/1", "/pins/name/short"}
+		if got := keys(t, store, "/pins/"); !slices.Equal(got, want) {
+			t.Fatalf("AllKeys(/pins/) = %q, want %q", got, want)
+		}
+		if err := store.Delete([]byte(deep)); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if ok, err := store.Has([]byte(deep)); err != nil || ok {
+			t.Fatalf("Has after Delete = %v, %v; want false", ok, err)
+		}
+		if got := keys(t, store, deep); !slices.Equal(got, []string{deep + "/1"}) {
+			t.Fatalf("AllKeys after Delete = %q, want only the longer key", got)
+		}
+	})
+}
+
+func TestAllKeysCancel(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, store storage.Store) {
+		for i := range 10 {
+			if err := store.Put(fmt.Appendf(nil, "bafkrei%d", i), []byte("data")); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}
+
+		// Stopping after the first key ends the iteration with the context's error
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, wait := store.AllKeys(ctx, nil)
+		<-ch
+		cancel()
+		for range ch {
+		}
+		if err := wait(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("AllKeys after cancel = %v, want context.Canceled", err)
+		}
+	})
+}